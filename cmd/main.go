@@ -5,8 +5,14 @@ import (
 	"fmt"
 	"github.com/zhayt/user-storage-service/config"
 	_ "github.com/zhayt/user-storage-service/docs"
+	"github.com/zhayt/user-storage-service/internal/health"
+	"github.com/zhayt/user-storage-service/internal/loginguard"
+	"github.com/zhayt/user-storage-service/internal/mailer"
+	"github.com/zhayt/user-storage-service/internal/metrics"
+	"github.com/zhayt/user-storage-service/internal/ratelimit"
 	"github.com/zhayt/user-storage-service/internal/service"
 	"github.com/zhayt/user-storage-service/internal/storage"
+	"github.com/zhayt/user-storage-service/internal/tracing"
 	"github.com/zhayt/user-storage-service/internal/transport/http"
 	"github.com/zhayt/user-storage-service/internal/transport/http/handler"
 	"github.com/zhayt/user-storage-service/internal/transport/http/middleware"
@@ -17,6 +23,7 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
 //	@title			OneLab HomeWork API
@@ -33,6 +40,13 @@ import (
 // @in							header
 // @name						Authorization
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
 	if err := run(); err != nil {
 		return
 	}
@@ -72,17 +86,64 @@ func run() error {
 		return err
 	}
 
+	rdb := storage.NewRedis(ctx, &wg, l, cfg)
+
+	// tracing
+	if err = tracing.New(ctx, &wg, l, cfg); err != nil {
+		return err
+	}
+
+	// mailer
+	mail, err := mailer.New(cfg, l)
+	if err != nil {
+		return err
+	}
+
+	// sign-in guard
+	guard := loginguard.New(l, loginguard.NewStore(l, rdb), loginguard.DefaultAccountPolicy, loginguard.DefaultIPPolicy)
+
 	// service
-	serv := service.NewService(l, repo)
+	serv := service.NewService(ctx, &wg, l, cfg, repo, guard)
+
+	if err = metrics.RegisterOverdueLoans(l, serv.CountOverdueLoans); err != nil {
+		return err
+	}
+
+	outbox := service.NewOutboxDispatcher(l, repo, mail)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		outbox.Run(ctx)
+	}()
 
 	// middleware
 	mid := middleware.NewJWTAuth(cfg)
 
+	rate, err := middleware.NewRateLimiter(cfg, l, ratelimit.New(l, rdb), mid)
+	if err != nil {
+		return err
+	}
+
+	// readiness
+	ready := health.New(l, health.DefaultTTL)
+	ready.Register(cfg.StorageDriver, time.Second, repo.Ping)
+	ready.Register("transaction-service", 2*time.Second, service.NewTransaction(l, cfg.TransactionServiceURL).Health)
+	if rdb != nil {
+		// rate limiting and loginguard fall back to memory while redis is away
+		ready.RegisterOptional("redis", time.Second, func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
+		})
+	}
+
 	// handler
 	hand := handler.NewHandler(l, serv, mid)
 
 	// server
-	server := http.NewServer(cfg, hand, mid)
+	server, err := http.NewServer(cfg, l, hand, mid, rate, ready)
+	if err != nil {
+		return err
+	}
 
 	l.Info("Start server")
 	server.Start()
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zhayt/user-storage-service/config"
+	"github.com/zhayt/user-storage-service/internal/storage"
+	"github.com/zhayt/user-storage-service/internal/storage/postgres"
+	"github.com/zhayt/user-storage-service/logger"
+	"strconv"
+)
+
+const _migrateUsage = "usage: app migrate up | down [steps] | version"
+
+// runMigrate is the migrate subcommand, it works on the database from the same config as the server.
+func runMigrate(args []string) error {
+	config.PrepareEnv()
+
+	cfg, err := config.New()
+	if err != nil {
+		return err
+	}
+
+	if cfg.StorageDriver != storage.DriverPostgres {
+		return fmt.Errorf("migrate only works on postgres, STORAGE_DRIVER is %s", cfg.StorageDriver)
+	}
+
+	l, err := logger.Init(cfg)
+	if err != nil {
+		return fmt.Errorf("cannot init logger: %w", err)
+	}
+	defer l.Sync()
+
+	ctx := context.Background()
+
+	db, err := postgres.Dial(ctx, "pgx", cfg.DBConnectionURL, storage.PostgresOptions(cfg), l)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := postgres.NewMigrator(db, l)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errors.New(_migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("bad steps %q: %s", args[1], _migrateUsage)
+			}
+		}
+		return migrator.Down(ctx, steps)
+	case "version":
+		version, dirty, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version %d of %d, dirty %t\n", version, migrator.Latest(), dirty)
+		return nil
+	default:
+		return errors.New(_migrateUsage)
+	}
+}
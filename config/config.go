@@ -5,19 +5,33 @@ import (
 	"github.com/caarlos0/env/v8"
 	"github.com/joho/godotenv"
 	"log"
+	"time"
 )
 
 type (
 	Config struct {
 		HTTP
 		Database
+		Mail
+		Redis
+		RateLimit
+		Tracing
 		JWTKey          string `env:"JWT_KEY" envDefault:"supersecret"`
 		Level           string `env:"APP_MODE" envDefault:"dev"`
 		DBConnectionURL string
+		// PasswordResetURL is the page the reset link points to, the token is appended to it.
+		PasswordResetURL string `env:"PASSWORD_RESET_URL" envDefault:"http://localhost:8000/reset-password?token="`
+		// EmailVerifyURL is where the verification link points to, the token is appended to it.
+		EmailVerifyURL string `env:"EMAIL_VERIFY_URL" envDefault:"http://localhost:8000/api/v1/users/verify?token="`
+		// TransactionServiceURL is where the rentals are charged.
+		TransactionServiceURL string `env:"TRANSACTION_SERVICE_URL" envDefault:"http://localhost:8081"`
 	}
 
 	HTTP struct {
 		AppPort string `env:"APP_PORT" envDefault:"8080"`
+		// TrustedProxies are the IPs or CIDR ranges of the proxies in front of the service, X-Forwarded-For
+		// is only believed when they set it. Without them the client IP is the address of the peer.
+		TrustedProxies []string `env:"HTTP_TRUSTED_PROXIES" envSeparator:","`
 	}
 
 	Database struct {
@@ -27,6 +41,65 @@ type (
 		DBName     string `env:"PG_NAME" envDefault:"onelab_db"`
 		DBPassword string `env:"PG_PASSWORD"`
 		TZ         string `env:"TZ" envDefault:"Asia/Almaty"`
+		// DBMigrate applies the pending migrations on start, without it the schema is only checked.
+		DBMigrate bool `env:"PG_MIGRATE" envDefault:"true"`
+		// The pool of the postgres driver. Connections are replaced after DBConnMaxLifetime,
+		// so a failover or a restarted pgbouncer is picked up.
+		DBMaxOpenConns    int           `env:"PG_MAX_OPEN_CONNS" envDefault:"25"`
+		DBMaxIdleConns    int           `env:"PG_MAX_IDLE_CONNS" envDefault:"25"`
+		DBConnMaxLifetime time.Duration `env:"PG_CONN_MAX_LIFETIME" envDefault:"30m"`
+		DBConnMaxIdleTime time.Duration `env:"PG_CONN_MAX_IDLE_TIME" envDefault:"5m"`
+		// DBStatementTimeout makes postgres cancel statements running longer, 0 turns it off.
+		DBStatementTimeout time.Duration `env:"PG_STATEMENT_TIMEOUT" envDefault:"1m"`
+		DBApplicationName  string        `env:"PG_APPLICATION_NAME" envDefault:"user-storage-service"`
+		// DBConnectTimeout is how long the start waits for postgres to come up.
+		DBConnectTimeout time.Duration `env:"PG_CONNECT_TIMEOUT" envDefault:"1m"`
+		// DBReplicaURLs are the DSNs of read replicas, comma separated. The reads go to them in turn,
+		// except those of a client, the user or the client IP, within DBReadYourWrites after its write.
+		DBReplicaURLs    []string      `env:"PG_REPLICA_URLS" envSeparator:","`
+		DBReadYourWrites time.Duration `env:"PG_READ_YOUR_WRITES" envDefault:"5s"`
+		// StorageDriver picks the backend: "postgres", "sqlite" for a branch without a database server,
+		// or "memory" which keeps the data in the process until it stops.
+		StorageDriver string `env:"STORAGE_DRIVER" envDefault:"postgres"`
+		// SQLitePath is the database file of the sqlite driver, created with its directory if missing.
+		SQLitePath string `env:"SQLITE_PATH" envDefault:"data/library.db"`
+	}
+
+	// Redis is optional, without it the sign-in lockout state lives in memory of one replica.
+	Redis struct {
+		RedisAddr     string `env:"REDIS_ADDR"`
+		RedisPassword string `env:"REDIS_PASSWORD"`
+		RedisDB       int    `env:"REDIS_DB" envDefault:"0"`
+	}
+
+	// RateLimit holds token bucket limits like "100/m", per client within a route group
+	// and for the whole API. An empty value or "off" turns the limit off.
+	RateLimit struct {
+		RateLimitGlobal string `env:"RATE_LIMIT_GLOBAL" envDefault:"1000/s"`
+		RateLimitUsers  string `env:"RATE_LIMIT_USERS" envDefault:"60/m"`
+		RateLimitBooks  string `env:"RATE_LIMIT_BOOKS" envDefault:"300/m"`
+		RateLimitCopies string `env:"RATE_LIMIT_COPIES" envDefault:"300/m"`
+		RateLimitRents  string `env:"RATE_LIMIT_RENTS" envDefault:"120/m"`
+		RateLimitAdmin  string `env:"RATE_LIMIT_ADMIN" envDefault:"600/m"`
+	}
+
+	// Tracing picks where spans go, "otlp" or "stdout". Empty turns the export off, incoming
+	// trace context is still passed on to the transaction service then.
+	Tracing struct {
+		TraceExporter    string  `env:"TRACE_EXPORTER"`
+		TraceSampleRatio float64 `env:"TRACE_SAMPLE_RATIO" envDefault:"1"`
+		ServiceName      string  `env:"OTEL_SERVICE_NAME" envDefault:"user-storage-service"`
+	}
+
+	// Mail picks how emails leave the service, "log" only writes them to the log and to MailDir if set.
+	Mail struct {
+		MailDriver   string `env:"MAIL_DRIVER" envDefault:"log"`
+		MailFrom     string `env:"MAIL_FROM" envDefault:"no-reply@localhost"`
+		MailDir      string `env:"MAIL_DIR"`
+		SMTPHost     string `env:"SMTP_HOST" envDefault:"localhost"`
+		SMTPPort     string `env:"SMTP_PORT" envDefault:"587"`
+		SMTPUser     string `env:"SMTP_USER"`
+		SMTPPassword string `env:"SMTP_PASSWORD"`
 	}
 )
 
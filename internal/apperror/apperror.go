@@ -0,0 +1,149 @@
+// Package apperror holds the domain errors shared by storage, service and transport.
+// An error carries a kind, which the transport turns into a status code, and
+// a message that is safe to show to clients. The wrapped cause is only logged.
+package apperror
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+type Kind uint8
+
+const (
+	Internal Kind = iota
+	NotFound
+	AlreadyExists
+	Conflict
+	Validation
+	Unauthorized
+	Forbidden
+	PreconditionFailed
+	TooManyRequests
+)
+
+func (k Kind) String() string {
+	switch k {
+	case NotFound:
+		return "not found"
+	case AlreadyExists:
+		return "already exists"
+	case Conflict:
+		return "conflict"
+	case Validation:
+		return "validation failed"
+	case Unauthorized:
+		return "unauthorized"
+	case Forbidden:
+		return "forbidden"
+	case PreconditionFailed:
+		return "precondition failed"
+	case TooManyRequests:
+		return "too many requests"
+	default:
+		return "internal error"
+	}
+}
+
+// Violation is a failed rule of one input field.
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Error struct {
+	Kind       Kind
+	Message    string
+	Violations []Violation
+	// RetryAfter tells the client when the request may succeed, zero if it is unknown.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func New(kind Kind, msg string) *Error {
+	return &Error{Kind: kind, Message: msg}
+}
+
+// Invalid reports field level violations of client input.
+func Invalid(violations ...Violation) *Error {
+	return &Error{Kind: Validation, Message: "validation failed", Violations: violations}
+}
+
+// Throttled reports that the client must wait retryAfter before trying again.
+func Throttled(msg string, retryAfter time.Duration) *Error {
+	return &Error{Kind: TooManyRequests, Message: msg, RetryAfter: retryAfter}
+}
+
+// Wrap keeps err as the cause, so errors.Is and errors.As still see it.
+func Wrap(kind Kind, msg string, err error) *Error {
+	return &Error{Kind: kind, Message: msg, Err: err}
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if len(e.Violations) != 0 {
+		fields := make([]string, 0, len(e.Violations))
+		for _, v := range e.Violations {
+			fields = append(fields, v.Field+" "+v.Message)
+		}
+		msg += " (" + strings.Join(fields, "; ") + ")"
+	}
+
+	if e.Err == nil {
+		return msg
+	}
+
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of the outermost domain error in the chain, Internal if there is none.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+
+	return Internal
+}
+
+// Message returns the client message of the outermost domain error in the chain.
+// Internal errors never expose their text.
+func Message(err error) string {
+	var e *Error
+	if errors.As(err, &e) && e.Kind != Internal {
+		return e.Message
+	}
+
+	return Internal.String()
+}
+
+// Violations returns the field violations found in the chain.
+func Violations(err error) []Violation {
+	var e *Error
+	for errors.As(err, &e) {
+		if len(e.Violations) != 0 {
+			return e.Violations
+		}
+		err = e.Err
+	}
+
+	return nil
+}
+
+// RetryAfter returns the wait of the first throttled error found in the chain.
+func RetryAfter(err error) time.Duration {
+	var e *Error
+	for errors.As(err, &e) {
+		if e.RetryAfter > 0 {
+			return e.RetryAfter
+		}
+		err = e.Err
+	}
+
+	return 0
+}
@@ -0,0 +1,55 @@
+package apperror
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestKindAndMessageTableDriven(t *testing.T) {
+	bookNotFound := Wrap(NotFound, "book not found", sql.ErrNoRows)
+
+	tests := []struct {
+		name     string
+		err      error
+		wantKind Kind
+		wantMsg  string
+	}{
+		{"Plain error", errors.New("pq: relation does not exist"), Internal, "internal error"},
+		{"Domain error", New(Validation, "title is required"), Validation, "title is required"},
+		{"Cause is hidden", bookNotFound, NotFound, "book not found"},
+		{"Wrapped by fmt", fmt.Errorf("couldn't take book id#1: %w", bookNotFound), NotFound, "book not found"},
+		{"Outermost wins", Wrap(Conflict, "book has copies on loan", bookNotFound), Conflict, "book has copies on loan"},
+		{"Internal kind", Wrap(Internal, "secret", errors.New("boom")), Internal, "internal error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.wantKind {
+				t.Errorf("KindOf() = %v, want %v", got, tt.wantKind)
+			}
+			if got := Message(tt.err); got != tt.wantMsg {
+				t.Errorf("Message() = %q, want %q", got, tt.wantMsg)
+			}
+		})
+	}
+
+	if !errors.Is(fmt.Errorf("couldn't take book: %w", bookNotFound), sql.ErrNoRows) {
+		t.Error("errors.Is() lost the cause")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	throttled := Throttled("too many sign-in attempts", 90*time.Second)
+
+	if got := KindOf(throttled); got != TooManyRequests {
+		t.Errorf("KindOf() = %v, want %v", got, TooManyRequests)
+	}
+	if got := RetryAfter(fmt.Errorf("couldn't sign in: %w", throttled)); got != 90*time.Second {
+		t.Errorf("RetryAfter() = %v, want %v", got, 90*time.Second)
+	}
+	if got := RetryAfter(New(Unauthorized, "invalid email or password")); got != 0 {
+		t.Errorf("RetryAfter() = %v, want 0", got)
+	}
+}
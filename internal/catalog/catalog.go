@@ -0,0 +1,123 @@
+// Package catalog reads bibliographic records from catalog exchange formats
+// (CSV, MARC21 binary and MARCXML) one record at a time.
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"io"
+	"strings"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatMARC    = "marc"
+	FormatMARCXML = "marcxml"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown catalog format")
+	ErrInvalidISBN   = errors.New("invalid isbn")
+)
+
+// Row is a single parsed record and the line (CSV) or record number (MARC) it came from.
+type Row struct {
+	Line int
+	Book model.Book
+}
+
+// RowError is returned for a record that could not be parsed.
+// The reader stays usable and the next Read moves on to the following record.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Reader returns io.EOF after the last record.
+type Reader interface {
+	Read() (Row, error)
+}
+
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatMARC, "mrc":
+		return newMARCReader(r), nil
+	case FormatMARCXML, "xml":
+		return newMARCXMLReader(r), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// NormalizeISBN strips separators, validates the check digit and converts ISBN-10 to ISBN-13.
+func NormalizeISBN(isbn string) (string, error) {
+	var digits []byte
+	for _, c := range strings.ToUpper(isbn) {
+		switch {
+		case c >= '0' && c <= '9', c == 'X':
+			digits = append(digits, byte(c))
+		case c == '-' || c == ' ':
+		default:
+			return "", ErrInvalidISBN
+		}
+	}
+
+	switch len(digits) {
+	case 10:
+		if !validISBN10(digits) {
+			return "", ErrInvalidISBN
+		}
+
+		isbn13 := append([]byte("978"), digits[:9]...)
+		return string(append(isbn13, isbn13CheckDigit(isbn13))), nil
+	case 13:
+		if strings.IndexByte(string(digits), 'X') != -1 || isbn13CheckDigit(digits[:12]) != digits[12] {
+			return "", ErrInvalidISBN
+		}
+
+		return string(digits), nil
+	default:
+		return "", ErrInvalidISBN
+	}
+}
+
+func validISBN10(digits []byte) bool {
+	var sum int
+	for i, d := range digits {
+		v := int(d - '0')
+		if d == 'X' {
+			if i != 9 {
+				return false
+			}
+			v = 10
+		}
+
+		sum += (10 - i) * v
+	}
+
+	return sum%11 == 0
+}
+
+func isbn13CheckDigit(digits []byte) byte {
+	var sum int
+	for i, d := range digits[:12] {
+		if i%2 == 0 {
+			sum += int(d - '0')
+		} else {
+			sum += 3 * int(d-'0')
+		}
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,165 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		name    string
+		isbn    string
+		want    string
+		wantErr bool
+	}{
+		{"isbn-13", "978-0-306-40615-7", "9780306406157", false},
+		{"isbn-10 converted", "0-306-40615-2", "9780306406157", false},
+		{"isbn-10 with X", "0-8044-2957-X", "9780804429573", false},
+		{"wrong check digit", "978-0-306-40615-8", "", true},
+		{"wrong length", "12345", "", true},
+		{"letters", "97803064O6157", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeISBN(tt.isbn)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NormalizeISBN() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeISBN() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	data := "Title,ISBN,Author,Price\n" +
+		"Abai Zholy,9780306406157,Mukhtar Auezov,12.5\n" +
+		"Broken,9780306406157,Someone,abc\n" +
+		"\"Kara sozder\",0-306-40615-2,Abai,\n"
+
+	r, err := NewReader(FormatCSV, strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	row, err := r.Read()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if row.Line != 2 || row.Book.Title != "Abai Zholy" || row.Book.Author != "Mukhtar Auezov" || row.Book.Price != 12.5 {
+		t.Errorf("unexpected row: %+v", row)
+	}
+
+	var rowErr *RowError
+	if _, err = r.Read(); !errors.As(err, &rowErr) || rowErr.Line != 3 {
+		t.Errorf("want row error on line 3, got %v", err)
+	}
+
+	row, err = r.Read()
+	if err != nil || row.Book.Title != "Kara sozder" || row.Book.ISBN != "0-306-40615-2" {
+		t.Errorf("unexpected row: %+v, error %v", row, err)
+	}
+
+	if _, err = r.Read(); err != io.EOF {
+		t.Errorf("want io.EOF, got %v", err)
+	}
+}
+
+func TestCSVReaderMissingColumn(t *testing.T) {
+	if _, err := NewReader(FormatCSV, strings.NewReader("title,author\n")); err == nil {
+		t.Error("want error for header without isbn")
+	}
+}
+
+func TestMARCReader(t *testing.T) {
+	data := marcRecordBytes(map[string]string{
+		"020": "  \x1fa9780306406157 (pbk.)\x1fc$15.00",
+		"100": "1 \x1faAuezov, Mukhtar,",
+		"245": "10\x1faAbai zholy :\x1fbroman /",
+	}) + "\n" + marcRecordBytes(map[string]string{
+		"020": "  \x1fa0306406152",
+		"110": "2 \x1faOneLab.",
+		"245": "00\x1faHandbook",
+	})
+
+	r, err := NewReader(FormatMARC, strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	row, err := r.Read()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if row.Book.ISBN != "9780306406157" || row.Book.Title != "Abai zholy: roman" ||
+		row.Book.Author != "Auezov, Mukhtar" || row.Book.Price != 15 {
+		t.Errorf("unexpected book: %+v", row.Book)
+	}
+
+	row, err = r.Read()
+	if err != nil || row.Line != 2 || row.Book.Author != "OneLab." || row.Book.Title != "Handbook" {
+		t.Errorf("unexpected row: %+v, error %v", row, err)
+	}
+
+	if _, err = r.Read(); err != io.EOF {
+		t.Errorf("want io.EOF, got %v", err)
+	}
+}
+
+func TestMARCXMLReader(t *testing.T) {
+	data := `<?xml version="1.0"?>
+<collection xmlns="http://www.loc.gov/MARC21/slim">
+  <record>
+    <leader>00000nam a2200000 a 4500</leader>
+    <controlfield tag="001">1</controlfield>
+    <datafield tag="020" ind1=" " ind2=" "><subfield code="a">9780306406157</subfield></datafield>
+    <datafield tag="100" ind1="1" ind2=" "><subfield code="a">Abai,</subfield></datafield>
+    <datafield tag="245" ind1="1" ind2="0"><subfield code="a">Kara sozder /</subfield></datafield>
+    <datafield tag="365" ind1=" " ind2=" "><subfield code="a">02</subfield><subfield code="b">7.99</subfield></datafield>
+  </record>
+</collection>`
+
+	r, err := NewReader(FormatMARCXML, strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	row, err := r.Read()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if row.Book.ISBN != "9780306406157" || row.Book.Title != "Kara sozder" || row.Book.Author != "Abai" || row.Book.Price != 7.99 {
+		t.Errorf("unexpected book: %+v", row.Book)
+	}
+
+	if _, err = r.Read(); err != io.EOF {
+		t.Errorf("want io.EOF, got %v", err)
+	}
+}
+
+// marcRecordBytes builds an ISO 2709 record out of data fields keyed by tag.
+func marcRecordBytes(fields map[string]string) string {
+	var directory, data strings.Builder
+	for _, tag := range []string{"020", "100", "110", "245"} {
+		value, ok := fields[tag]
+		if !ok {
+			continue
+		}
+
+		value += "\x1e"
+		fmt.Fprintf(&directory, "%s%04d%05d", tag, len(value), data.Len())
+		data.WriteString(value)
+	}
+	directory.WriteString("\x1e")
+
+	base := 24 + directory.Len()
+	length := base + data.Len() + 1
+	leader := fmt.Sprintf("%05dnam a22%05d a 4500", length, base)
+
+	return leader + directory.String() + data.String() + "\x1d"
+}
@@ -0,0 +1,77 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+// newCSVReader expects a header row naming the columns isbn, title, author and price in any order.
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	for _, name := range []string{"isbn", "title", "author"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv header has no %q column", name)
+		}
+	}
+
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+func (c *csvReader) Read() (Row, error) {
+	record, err := c.r.Read()
+	line, _ := c.r.FieldPos(0)
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return Row{}, &RowError{Line: parseErr.StartLine, Err: parseErr.Err}
+		}
+
+		return Row{}, err
+	}
+
+	row := Row{Line: line}
+	row.Book.ISBN = c.field(record, "isbn")
+	row.Book.Title = c.field(record, "title")
+	row.Book.Author = c.field(record, "author")
+
+	if price := c.field(record, "price"); price != "" {
+		row.Book.Price, err = strconv.ParseFloat(price, 64)
+		if err != nil {
+			return Row{}, &RowError{Line: line, Err: fmt.Errorf("invalid price %q", price)}
+		}
+	}
+
+	return row, nil
+}
+
+func (c *csvReader) field(record []string, name string) string {
+	i, ok := c.columns[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+
+	return strings.TrimSpace(record[i])
+}
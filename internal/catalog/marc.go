@@ -0,0 +1,210 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	marcRecordTerminator = 0x1D
+	marcFieldTerminator  = 0x1E
+	marcSubfieldMark     = 0x1F
+	marcLeaderLength     = 24
+	marcDirEntryLength   = 12
+)
+
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcField struct {
+	Tag       string         `xml:"tag,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+type marcRecord struct {
+	Fields []marcField `xml:"datafield"`
+}
+
+func (r marcRecord) subfield(tag, code string) string {
+	for _, f := range r.Fields {
+		if f.Tag != tag {
+			continue
+		}
+
+		for _, sf := range f.Subfields {
+			if sf.Code == code {
+				return strings.TrimSpace(sf.Value)
+			}
+		}
+	}
+
+	return ""
+}
+
+// book maps 020 (ISBN and price), 245 (title), 100/110/700 (author) and 365 (price) to a model.Book.
+func (r marcRecord) book() (model.Book, error) {
+	var book model.Book
+
+	if isbn := strings.Fields(r.subfield("020", "a")); len(isbn) > 0 {
+		book.ISBN = isbn[0]
+	}
+
+	book.Title = trimISBD(r.subfield("245", "a"))
+	if subtitle := trimISBD(r.subfield("245", "b")); subtitle != "" {
+		book.Title += ": " + subtitle
+	}
+
+	for _, tag := range []string{"100", "110", "700"} {
+		if book.Author = trimISBD(r.subfield(tag, "a")); book.Author != "" {
+			break
+		}
+	}
+
+	price := r.subfield("365", "b")
+	if price == "" {
+		price = r.subfield("020", "c")
+	}
+
+	if price = strings.TrimLeft(price, "$€£¥₸ABCDEFGHIJKLMNOPQRSTUVWXYZ "); price != "" {
+		var err error
+		if book.Price, err = strconv.ParseFloat(strings.Fields(price)[0], 64); err != nil {
+			return book, fmt.Errorf("invalid price %q", price)
+		}
+	}
+
+	return book, nil
+}
+
+// trimISBD drops the trailing ISBD punctuation cataloguers put before the next subfield.
+func trimISBD(s string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(s), " /:;,="))
+}
+
+type marcReader struct {
+	r   *bufio.Reader
+	num int
+}
+
+func newMARCReader(r io.Reader) *marcReader {
+	return &marcReader{r: bufio.NewReader(r)}
+}
+
+func (m *marcReader) Read() (Row, error) {
+	raw, err := m.r.ReadBytes(marcRecordTerminator)
+	raw = bytes.TrimLeft(raw, "\r\n ")
+	if len(bytes.TrimSpace(raw)) == 0 && err != nil {
+		return Row{}, err
+	}
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Row{}, err
+	}
+
+	m.num++
+
+	record, err := parseMARCRecord(raw)
+	if err != nil {
+		return Row{}, &RowError{Line: m.num, Err: err}
+	}
+
+	book, err := record.book()
+	if err != nil {
+		return Row{}, &RowError{Line: m.num, Err: err}
+	}
+
+	return Row{Line: m.num, Book: book}, nil
+}
+
+// parseMARCRecord decodes an ISO 2709 record: leader, directory and variable fields.
+func parseMARCRecord(raw []byte) (marcRecord, error) {
+	var record marcRecord
+
+	if len(raw) < marcLeaderLength {
+		return record, errors.New("marc record is shorter than its leader")
+	}
+
+	baseAddress, err := strconv.Atoi(string(raw[12:17]))
+	if err != nil || baseAddress <= marcLeaderLength || baseAddress > len(raw) {
+		return record, errors.New("marc leader has invalid base address")
+	}
+
+	directory := raw[marcLeaderLength : baseAddress-1]
+	for len(directory) >= marcDirEntryLength {
+		entry := directory[:marcDirEntryLength]
+		directory = directory[marcDirEntryLength:]
+
+		tag := string(entry[:3])
+		length, errLen := strconv.Atoi(string(entry[3:7]))
+		start, errStart := strconv.Atoi(string(entry[7:12]))
+		if errLen != nil || errStart != nil || baseAddress+start+length > len(raw) {
+			return record, fmt.Errorf("marc directory entry %s is corrupted", tag)
+		}
+
+		// control fields 001-009 carry no indicators and subfields
+		if tag < "010" {
+			continue
+		}
+
+		data := strings.TrimRight(string(raw[baseAddress+start:baseAddress+start+length]), string(rune(marcFieldTerminator)))
+
+		field := marcField{Tag: tag}
+		for i, part := range strings.Split(data, string(rune(marcSubfieldMark))) {
+			// the part before the first delimiter holds the indicators
+			if i == 0 || part == "" {
+				continue
+			}
+
+			field.Subfields = append(field.Subfields, marcSubfield{Code: part[:1], Value: part[1:]})
+		}
+
+		record.Fields = append(record.Fields, field)
+	}
+
+	return record, nil
+}
+
+type marcXMLReader struct {
+	d   *xml.Decoder
+	num int
+}
+
+func newMARCXMLReader(r io.Reader) *marcXMLReader {
+	return &marcXMLReader{d: xml.NewDecoder(r)}
+}
+
+func (m *marcXMLReader) Read() (Row, error) {
+	for {
+		token, err := m.d.Token()
+		if err != nil {
+			return Row{}, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		m.num++
+
+		var record marcRecord
+		if err = m.d.DecodeElement(&record, &start); err != nil {
+			return Row{}, fmt.Errorf("couldn't decode marcxml record %d: %w", m.num, err)
+		}
+
+		book, err := record.book()
+		if err != nil {
+			return Row{}, &RowError{Line: m.num, Err: err}
+		}
+
+		return Row{Line: m.num, Book: book}, nil
+	}
+}
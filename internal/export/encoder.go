@@ -0,0 +1,60 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+)
+
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+	row    []string
+}
+
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) Encode(record interface{}) error {
+	v, err := structValue(record)
+	if err != nil {
+		return err
+	}
+
+	if !e.header {
+		if err = e.w.Write(columns(v.Type())); err != nil {
+			return err
+		}
+		e.header = true
+	}
+
+	e.row = e.row[:0]
+	for _, c := range cells(v) {
+		e.row = append(e.row, c.value)
+	}
+
+	return e.w.Write(e.row)
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func newJSONLEncoder(w io.Writer) *jsonlEncoder {
+	return &jsonlEncoder{enc: json.NewEncoder(w)}
+}
+
+// Encode writes the record exactly like the JSON API does, followed by a newline.
+func (e *jsonlEncoder) Encode(record interface{}) error {
+	return e.enc.Encode(record)
+}
+
+func (e *jsonlEncoder) Close() error {
+	return nil
+}
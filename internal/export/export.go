@@ -0,0 +1,161 @@
+// Package export streams records as CSV, JSON Lines or XLSX.
+// Columns are taken from the json tags of the record struct, so every
+// format shows the same field names as the JSON API.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatXLSX  = "xlsx"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Encoder writes records one by one, Close must be called to flush the output.
+type Encoder interface {
+	Encode(record interface{}) error
+	Close() error
+}
+
+func NewEncoder(format string, w io.Writer) (Encoder, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVEncoder(w), nil
+	case FormatJSONL:
+		return newJSONLEncoder(w), nil
+	case FormatXLSX:
+		return newXLSXEncoder(w), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// ContentType returns the media type of the format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// FormatFromAccept picks the export format from an Accept header.
+// It returns "" when JSON is preferred or no export format is asked for.
+func FormatFromAccept(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.Split(part, ";")[0])
+		switch mediaType {
+		case "application/json", "*/*":
+			return ""
+		case "text/csv":
+			return FormatCSV
+		case "application/x-ndjson", "application/jsonl", "application/jsonlines":
+			return FormatJSONL
+		case ContentType(FormatXLSX):
+			return FormatXLSX
+		}
+	}
+
+	return ""
+}
+
+type cell struct {
+	value   string
+	numeric bool
+}
+
+// columns lists the json names of the exported fields of a struct type.
+func columns(t reflect.Type) []string {
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := columnName(t.Field(i)); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func columnName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	default:
+		return name, true
+	}
+}
+
+// cells flattens a struct into one cell per exported field, nested values are printed with %v.
+func cells(v reflect.Value) []cell {
+	row := make([]cell, 0, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		if _, ok := columnName(v.Type().Field(i)); !ok {
+			continue
+		}
+
+		row = append(row, toCell(v.Field(i)))
+	}
+
+	return row
+}
+
+func toCell(v reflect.Value) cell {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return cell{}
+		}
+		v = v.Elem()
+	}
+
+	switch value := v.Interface().(type) {
+	case time.Time:
+		if value.IsZero() {
+			return cell{}
+		}
+		return cell{value: value.Format(time.RFC3339)}
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cell{value: strconv.FormatInt(v.Int(), 10), numeric: true}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cell{value: strconv.FormatUint(v.Uint(), 10), numeric: true}
+	case reflect.Float32, reflect.Float64:
+		return cell{value: strconv.FormatFloat(v.Float(), 'f', -1, 64), numeric: true}
+	case reflect.String:
+		return cell{value: v.String()}
+	default:
+		return cell{value: fmt.Sprintf("%v", v.Interface())}
+	}
+}
+
+func structValue(record interface{}) (reflect.Value, error) {
+	v := reflect.Indirect(reflect.ValueOf(record))
+	if v.Kind() != reflect.Struct {
+		return v, fmt.Errorf("couldn't export %T: record must be a struct", record)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,150 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testRecord struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Price     float64   `json:"price"`
+	Hidden    string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+var testRecords = []testRecord{
+	{ID: 1, Title: "Abai, Zholy", Price: 12.5, Hidden: "x", CreatedAt: time.Date(2023, 4, 18, 0, 0, 0, 0, time.UTC)},
+	{ID: 2, Title: "<Kara sozder>", Price: 7},
+}
+
+func encodeAll(t *testing.T, format string) string {
+	var buf bytes.Buffer
+
+	enc, err := NewEncoder(format, &buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, r := range testRecords {
+		if err = enc.Encode(r); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err = enc.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return buf.String()
+}
+
+func TestCSVEncoder(t *testing.T) {
+	want := "id,title,price,createdAt\n" +
+		"1,\"Abai, Zholy\",12.5,2023-04-18T00:00:00Z\n" +
+		"2,<Kara sozder>,7,\n"
+
+	if got := encodeAll(t, FormatCSV); got != want {
+		t.Errorf("unexpected csv:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestJSONLEncoder(t *testing.T) {
+	got := encodeAll(t, FormatJSONL)
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"id":1,"title":"Abai, Zholy"`) {
+		t.Errorf("unexpected jsonl:\n%s", got)
+	}
+}
+
+func TestXLSXEncoder(t *testing.T) {
+	got := encodeAll(t, FormatXLSX)
+
+	zr, err := zip.NewReader(strings.NewReader(got), int64(len(got)))
+	if err != nil {
+		t.Fatalf("output is not a zip archive: %v", err)
+	}
+
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		sheet = string(data)
+	}
+
+	for _, want := range []string{
+		`<c r="B1" t="inlineStr"><is><t xml:space="preserve">title</t></is></c>`,
+		`<c r="C2"><v>12.5</v></c>`,
+		`<t xml:space="preserve">&lt;Kara sozder&gt;</t>`,
+		`</sheetData></worksheet>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet has no %s:\n%s", want, sheet)
+		}
+	}
+}
+
+func TestXLSXEncoder_Lazy(t *testing.T) {
+	var buf bytes.Buffer
+
+	enc, err := NewEncoder(FormatXLSX, &buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// nothing is written before the first record, a failed query can still be answered with an error
+	if enc.(*xlsxEncoder).zw != nil || buf.Len() != 0 {
+		t.Fatalf("encoder started the package before any record")
+	}
+
+	if err = enc.Encode(42); err == nil {
+		t.Fatalf("expected an error for a record that is not a struct")
+	}
+	if enc.(*xlsxEncoder).zw != nil {
+		t.Fatalf("encoder started the package for a record it refused")
+	}
+
+	if err = enc.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// an empty export is still a workbook
+	if _, err = zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+		t.Errorf("output is not a zip archive: %v", err)
+	}
+}
+
+func TestColumnRef(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnRef(i); got != want {
+			t.Errorf("columnRef(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestFormatFromAccept(t *testing.T) {
+	tests := map[string]string{
+		"text/csv":                         FormatCSV,
+		"text/csv, application/json":       FormatCSV,
+		"application/json, text/csv;q=0.9": "",
+		"application/x-ndjson":             FormatJSONL,
+		ContentType(FormatXLSX):            FormatXLSX,
+		"application/json":                 "",
+		"":                                 "",
+	}
+	for accept, want := range tests {
+		if got := FormatFromAccept(accept); got != want {
+			t.Errorf("FormatFromAccept(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strconv"
+)
+
+// The smallest package Excel and LibreOffice accept: one worksheet with inline strings,
+// so rows can be written straight into the zip stream without a shared string table.
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Export" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+type xlsxEncoder struct {
+	w      io.Writer
+	zw     *zip.Writer
+	sheet  *bufio.Writer
+	rowNum int
+}
+
+func newXLSXEncoder(w io.Writer) *xlsxEncoder {
+	return &xlsxEncoder{w: w}
+}
+
+// start writes the package parts and opens the worksheet. It runs on the first record, or on Close
+// of an empty export, so an export failing before any record leaves the response untouched.
+func (e *xlsxEncoder) start() error {
+	if e.zw != nil {
+		return nil
+	}
+
+	e.zw = zip.NewWriter(e.w)
+
+	for _, part := range xlsxParts {
+		f, err := e.zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+
+		if _, err = io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := e.zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+
+	e.sheet = bufio.NewWriter(sheet)
+	_, err = e.sheet.WriteString(xml.Header +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	return err
+}
+
+func (e *xlsxEncoder) Encode(record interface{}) error {
+	v, err := structValue(record)
+	if err != nil {
+		return err
+	}
+
+	if err = e.start(); err != nil {
+		return err
+	}
+
+	if e.rowNum == 0 {
+		header := columns(v.Type())
+		row := make([]cell, len(header))
+		for i, name := range header {
+			row[i] = cell{value: name}
+		}
+
+		if err = e.writeRow(row); err != nil {
+			return err
+		}
+	}
+
+	return e.writeRow(cells(v))
+}
+
+func (e *xlsxEncoder) writeRow(row []cell) error {
+	e.rowNum++
+	e.sheet.WriteString(`<row r="` + strconv.Itoa(e.rowNum) + `">`)
+
+	for i, c := range row {
+		ref := columnRef(i) + strconv.Itoa(e.rowNum)
+		if c.numeric {
+			e.sheet.WriteString(`<c r="` + ref + `"><v>` + c.value + `</v></c>`)
+			continue
+		}
+
+		e.sheet.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(e.sheet, []byte(c.value)); err != nil {
+			return err
+		}
+		e.sheet.WriteString(`</t></is></c>`)
+	}
+
+	_, err := e.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (e *xlsxEncoder) Close() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	if _, err := e.sheet.WriteString(`</sheetData></worksheet>`); err != nil {
+		return err
+	}
+
+	if err := e.sheet.Flush(); err != nil {
+		return err
+	}
+
+	return e.zw.Close()
+}
+
+// columnRef turns a zero based column index into a spreadsheet column name: 0 -> A, 26 -> AA.
+func columnRef(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+
+	return name
+}
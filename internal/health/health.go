@@ -0,0 +1,148 @@
+// Package health answers the readiness probe. The registered checks run concurrently, each within
+// its own timeout, and their report is reused for a short while so probes do not pile up on the dependencies.
+// An optional dependency the service can do without is reported as degraded and does not fail the probe.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+
+	DefaultTTL = 2 * time.Second
+)
+
+// CheckFunc reports the dependency as down by returning an error.
+type CheckFunc func(ctx context.Context) error
+
+type Component struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status     string      `json:"status"`
+	Components []Component `json:"components"`
+	CheckedAt  time.Time   `json:"checkedAt"`
+}
+
+type check struct {
+	name     string
+	timeout  time.Duration
+	fn       CheckFunc
+	optional bool
+}
+
+type Checker struct {
+	checks []check
+	ttl    time.Duration
+	log    *zap.Logger
+
+	mu     sync.Mutex
+	report Report
+}
+
+func New(logger *zap.Logger, ttl time.Duration) *Checker {
+	return &Checker{ttl: ttl, log: logger}
+}
+
+// Register adds a check, it must be called before the checker serves requests.
+func (c *Checker) Register(name string, timeout time.Duration, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, timeout: timeout, fn: fn})
+}
+
+// RegisterOptional adds a check of a dependency the service falls back from, its failure
+// marks the report degraded but leaves the instance ready.
+func (c *Checker) RegisterOptional(name string, timeout time.Duration, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, timeout: timeout, fn: fn, optional: true})
+}
+
+// Check returns the cached report if it is fresh, or runs the checks. Callers arriving
+// while the checks run wait for their result instead of starting another round.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.report.CheckedAt.IsZero() && time.Since(c.report.CheckedAt) < c.ttl {
+		return c.report
+	}
+
+	report := Report{Status: StatusUp, Components: make([]Component, len(c.checks)), CheckedAt: time.Now()}
+
+	var wg sync.WaitGroup
+	for i, ch := range c.checks {
+		wg.Add(1)
+		go func(i int, ch check) {
+			defer wg.Done()
+			report.Components[i] = c.run(ctx, ch)
+		}(i, ch)
+	}
+	wg.Wait()
+
+	for _, component := range report.Components {
+		switch component.Status {
+		case StatusDown:
+			report.Status = StatusDown
+			c.log.Warn("Dependency is down", zap.String("component", component.Name), zap.String("error", component.Error))
+		case StatusDegraded:
+			if report.Status == StatusUp {
+				report.Status = StatusDegraded
+			}
+			c.log.Warn("Optional dependency is down", zap.String("component", component.Name), zap.String("error", component.Error))
+		}
+	}
+
+	c.report = report
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, ch check) Component {
+	ctx, cancel := context.WithTimeout(ctx, ch.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := ch.fn(ctx)
+
+	component := Component{
+		Name:      ch.name,
+		Status:    StatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		component.Status, component.Error = StatusDown, err.Error()
+		if ch.optional {
+			component.Status = StatusDegraded
+		}
+	}
+
+	return component
+}
+
+// ServeHTTP answers 503 when a required dependency is down and 200 otherwise, both with the report.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the round is shared with other probes, one of them going away must not fail it
+	report := c.Check(context.Background())
+
+	status := http.StatusOK
+	if report.Status == StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		c.log.Error("Write readiness report error", zap.Error(err))
+	}
+}
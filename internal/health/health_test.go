@@ -0,0 +1,98 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChecker_ServeHTTP(t *testing.T) {
+	var dbDown atomic.Bool
+
+	c := New(zap.NewNop(), 0)
+	c.Register("postgres", time.Second, func(ctx context.Context) error {
+		if dbDown.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	c.Register("redis", time.Second, func(ctx context.Context) error { return nil })
+
+	serve := func() (int, Report) {
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+		var report Report
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+		return rec.Code, report
+	}
+
+	code, report := serve()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusUp, report.Status)
+	assert.Len(t, report.Components, 2)
+
+	dbDown.Store(true)
+
+	code, report = serve()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, Component{Name: "postgres", Status: StatusDown, LatencyMs: report.Components[0].LatencyMs, Error: "connection refused"},
+		report.Components[0])
+	assert.Equal(t, StatusUp, report.Components[1].Status)
+}
+
+func TestChecker_Optional(t *testing.T) {
+	c := New(zap.NewNop(), 0)
+	c.Register("postgres", time.Second, func(ctx context.Context) error { return nil })
+	c.RegisterOptional("redis", time.Second, func(ctx context.Context) error { return errors.New("connection refused") })
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	var report Report
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	assert.Equal(t, http.StatusOK, rec.Code, "an optional dependency does not take the instance out")
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, StatusUp, report.Components[0].Status)
+	assert.Equal(t, StatusDegraded, report.Components[1].Status)
+	assert.Equal(t, "connection refused", report.Components[1].Error)
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	c := New(zap.NewNop(), 0)
+	c.Register("transaction-service", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	report := c.Check(context.Background())
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Components[0].Error)
+}
+
+func TestChecker_Cache(t *testing.T) {
+	var calls atomic.Int32
+
+	c := New(zap.NewNop(), time.Minute)
+	c.Register("postgres", time.Second, func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+
+	first := c.Check(context.Background())
+	second := c.Check(context.Background())
+
+	assert.Equal(t, int32(1), calls.Load(), "the second probe is answered from the cache")
+	assert.Equal(t, first.CheckedAt, second.CheckedAt)
+}
@@ -0,0 +1,122 @@
+// Package loginguard slows down and then locks out password guessing. Failed sign-ins are
+// counted per account and per client IP, both must be clear for an attempt to go through.
+package loginguard
+
+import (
+	"context"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/logger"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// Policy says how failures turn into waits. The first FreeFailures cost nothing, each next one locks
+// the key for BaseDelay doubled per failure, MaxFailures and more lock it for Lockout.
+// Failures are forgotten Window after the last one.
+type Policy struct {
+	FreeFailures int
+	MaxFailures  int
+	BaseDelay    time.Duration
+	Lockout      time.Duration
+	Window       time.Duration
+}
+
+var (
+	DefaultAccountPolicy = Policy{FreeFailures: 3, MaxFailures: 10, BaseDelay: time.Second, Lockout: 15 * time.Minute, Window: 15 * time.Minute}
+	// DefaultIPPolicy is looser, many readers may sit behind one NAT.
+	DefaultIPPolicy = Policy{FreeFailures: 20, MaxFailures: 100, BaseDelay: time.Second, Lockout: 15 * time.Minute, Window: 15 * time.Minute}
+)
+
+// delay returns how long the key is locked after its n-th failure.
+func (p Policy) delay(n int) time.Duration {
+	if n <= p.FreeFailures {
+		return 0
+	}
+
+	if n >= p.MaxFailures {
+		return p.Lockout
+	}
+
+	d := p.BaseDelay
+	for i := p.FreeFailures + 1; i < n && d < p.Lockout; i++ {
+		d *= 2
+	}
+
+	if d > p.Lockout {
+		return p.Lockout
+	}
+
+	return d
+}
+
+type Guard struct {
+	store   Store
+	account Policy
+	ip      Policy
+	log     *zap.Logger
+}
+
+func New(log *zap.Logger, store Store, account, ip Policy) *Guard {
+	return &Guard{store: store, account: account, ip: ip, log: log}
+}
+
+// Check fails with a TooManyRequests error while the account or the IP is locked. The answer does not
+// depend on whether the account exists.
+func (g *Guard) Check(ctx context.Context, email, ip string) error {
+	var wait time.Duration
+
+	for _, key := range g.keys(email, ip) {
+		d, err := g.store.LockedFor(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if d > wait {
+			wait = d
+		}
+	}
+
+	if wait > 0 {
+		return apperror.Throttled("too many failed sign-in attempts, try again later", wait)
+	}
+
+	return nil
+}
+
+// Fail counts a failed attempt and locks the account or the IP if the policy says so.
+func (g *Guard) Fail(ctx context.Context, email, ip string) {
+	policies := []Policy{g.account, g.ip}
+
+	for i, key := range g.keys(email, ip) {
+		n, err := g.store.Fail(ctx, key, policies[i].Window)
+		if err != nil {
+			logger.FromContext(ctx, g.log).Error("Count failed sign-in error", zap.String("key", key), zap.Error(err))
+			continue
+		}
+
+		if d := policies[i].delay(n); d > 0 {
+			if err = g.store.Lock(ctx, key, d); err != nil {
+				logger.FromContext(ctx, g.log).Error("Lock sign-in error", zap.String("key", key), zap.Error(err))
+				continue
+			}
+			logger.FromContext(ctx, g.log).Warn("Sign-in locked", zap.String("key", key), zap.Int("failures", n), zap.Duration("for", d))
+		}
+	}
+}
+
+// Succeed clears the account. The IP keeps its count, signing in to one's own account
+// must not reset guessing at others.
+func (g *Guard) Succeed(ctx context.Context, email string) {
+	if err := g.store.Reset(ctx, accountKey(email)); err != nil {
+		logger.FromContext(ctx, g.log).Error("Reset sign-in failures error", zap.Error(err))
+	}
+}
+
+func (g *Guard) keys(email, ip string) []string {
+	return []string{accountKey(email), "ip:" + ip}
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,111 @@
+package loginguard
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestPolicy_delay(t *testing.T) {
+	p := Policy{FreeFailures: 3, MaxFailures: 10, BaseDelay: time.Second, Lockout: 15 * time.Minute}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{9, 32 * time.Second},
+		{10, 15 * time.Minute},
+		{50, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := p.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestGuard_LockAccount(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	g := New(zap.NewNop(), store, Policy{FreeFailures: 1, MaxFailures: 3, BaseDelay: time.Second, Lockout: time.Hour, Window: time.Hour}, DefaultIPPolicy)
+
+	g.Fail(ctx, "Reader@mail.ru", "10.0.0.1")
+	assert.NoError(t, g.Check(ctx, "reader@mail.ru", "10.0.0.2"), "free failure")
+
+	g.Fail(ctx, "reader@mail.ru", "10.0.0.1")
+	err := g.Check(ctx, "reader@mail.ru", "10.0.0.2")
+	assert.Equal(t, apperror.TooManyRequests, apperror.KindOf(err), "email is case insensitive")
+	assert.InDelta(t, time.Second, apperror.RetryAfter(err), float64(100*time.Millisecond))
+
+	assert.NoError(t, g.Check(ctx, "other@mail.ru", "10.0.0.2"), "other accounts are not affected")
+
+	g.Fail(ctx, "reader@mail.ru", "10.0.0.1")
+	assert.InDelta(t, time.Hour, apperror.RetryAfter(g.Check(ctx, "reader@mail.ru", "")), float64(time.Second))
+
+	g.Succeed(ctx, "reader@mail.ru")
+	assert.NoError(t, g.Check(ctx, "reader@mail.ru", "10.0.0.1"))
+}
+
+func TestGuard_LockIP(t *testing.T) {
+	ctx := context.Background()
+	g := New(zap.NewNop(), NewMemoryStore(), DefaultAccountPolicy, Policy{MaxFailures: 2, Lockout: time.Minute, Window: time.Minute})
+
+	g.Fail(ctx, "a@mail.ru", "10.0.0.1")
+	g.Fail(ctx, "b@mail.ru", "10.0.0.1")
+
+	assert.Equal(t, apperror.TooManyRequests, apperror.KindOf(g.Check(ctx, "c@mail.ru", "10.0.0.1")))
+	assert.NoError(t, g.Check(ctx, "c@mail.ru", "10.0.0.2"))
+}
+
+func TestMemoryStore_Window(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	n, _ := s.Fail(ctx, "k", time.Minute)
+	assert.Equal(t, 1, n)
+	n, _ = s.Fail(ctx, "k", time.Minute)
+	assert.Equal(t, 2, n)
+
+	now = now.Add(2 * time.Minute)
+	n, _ = s.Fail(ctx, "k", time.Minute)
+	assert.Equal(t, 1, n, "failures are forgotten after the window")
+}
+
+type brokenStore struct{}
+
+func (brokenStore) Fail(context.Context, string, time.Duration) (int, error) {
+	return 0, errors.New("connection refused")
+}
+
+func (brokenStore) Lock(context.Context, string, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (brokenStore) LockedFor(context.Context, string) (time.Duration, error) {
+	return 0, errors.New("connection refused")
+}
+
+func (brokenStore) Reset(context.Context, string) error {
+	return errors.New("connection refused")
+}
+
+func TestFallbackStore(t *testing.T) {
+	ctx := context.Background()
+	g := New(zap.NewNop(), NewFallbackStore(zap.NewNop(), brokenStore{}, NewMemoryStore()),
+		Policy{MaxFailures: 1, Lockout: time.Minute, Window: time.Minute}, DefaultIPPolicy)
+
+	g.Fail(ctx, "reader@mail.ru", "10.0.0.1")
+
+	assert.Equal(t, apperror.TooManyRequests, apperror.KindOf(g.Check(ctx, "reader@mail.ru", "10.0.0.1")))
+}
@@ -0,0 +1,17 @@
+package loginguard
+
+import (
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// NewStore keeps the state in Redis if there is a client, falling back to memory while it is unavailable.
+// Without Redis the state is kept in memory only.
+func NewStore(logger *zap.Logger, client *redis.Client) Store {
+	memory := NewMemoryStore()
+	if client == nil {
+		return memory
+	}
+
+	return NewFallbackStore(logger, NewRedisStore(client), memory)
+}
@@ -0,0 +1,63 @@
+package loginguard
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const _redisKeyPrefix = "loginguard:"
+
+// RedisStore shares the state between replicas and keeps it over restarts.
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	failures := _redisKeyPrefix + key + ":failures"
+
+	pipe := s.client.TxPipeline()
+	incr := pipe.Incr(ctx, failures)
+	pipe.PExpire(ctx, failures, window)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("couldn't count failed attempt: %w", err)
+	}
+
+	return int(incr.Val()), nil
+}
+
+func (s *RedisStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	if err := s.client.Set(ctx, _redisKeyPrefix+key+":lock", 1, d).Err(); err != nil {
+		return fmt.Errorf("couldn't lock %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (s *RedisStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	d, err := s.client.PTTL(ctx, _redisKeyPrefix+key+":lock").Result()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't read lock of %s: %w", key, err)
+	}
+
+	// missing keys give negative ttl
+	if d < 0 {
+		return 0, nil
+	}
+
+	return d, nil
+}
+
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, _redisKeyPrefix+key+":failures", _redisKeyPrefix+key+":lock").Err(); err != nil {
+		return fmt.Errorf("couldn't reset %s: %w", key, err)
+	}
+
+	return nil
+}
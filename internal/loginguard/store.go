@@ -0,0 +1,169 @@
+package loginguard
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// Store keeps failed attempts and locks by key. Counters expire after the window given to Fail,
+// locks after the duration given to Lock.
+type Store interface {
+	Fail(ctx context.Context, key string, window time.Duration) (int, error)
+	Lock(ctx context.Context, key string, d time.Duration) error
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	Reset(ctx context.Context, key string) error
+}
+
+type memoryEntry struct {
+	failures     int
+	failuresTill time.Time
+	lockedTill   time.Time
+}
+
+// MemoryStore keeps the state in the process, it is lost on restart and not shared between replicas.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry), now: time.Now}
+}
+
+func (s *MemoryStore) Fail(_ context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.evict(now)
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+
+	if !now.Before(entry.failuresTill) {
+		entry.failures = 0
+	}
+
+	entry.failures++
+	entry.failuresTill = now.Add(window)
+
+	return entry.failures, nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+
+	entry.lockedTill = s.now().Add(d)
+
+	return nil
+}
+
+func (s *MemoryStore) LockedFor(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return 0, nil
+	}
+
+	if d := entry.lockedTill.Sub(s.now()); d > 0 {
+		return d, nil
+	}
+
+	return 0, nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+
+	return nil
+}
+
+// evict drops the entries which have neither live counter nor lock, must be called with mu held.
+func (s *MemoryStore) evict(now time.Time) {
+	for key, entry := range s.entries {
+		if !now.Before(entry.failuresTill) && !now.Before(entry.lockedTill) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// FallbackStore uses primary and switches to fallback for the calls primary fails,
+// so an unavailable Redis does not turn sign-in off or unprotected.
+type FallbackStore struct {
+	primary  Store
+	fallback Store
+	log      *zap.Logger
+}
+
+func NewFallbackStore(log *zap.Logger, primary, fallback Store) *FallbackStore {
+	return &FallbackStore{primary: primary, fallback: fallback, log: log}
+}
+
+func (s *FallbackStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	n, err := s.primary.Fail(ctx, key, window)
+	if err != nil {
+		s.log.Warn("Login guard store error, using fallback", zap.Error(err))
+		return s.fallback.Fail(ctx, key, window)
+	}
+
+	return n, nil
+}
+
+func (s *FallbackStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	if err := s.primary.Lock(ctx, key, d); err != nil {
+		s.log.Warn("Login guard store error, using fallback", zap.Error(err))
+		return s.fallback.Lock(ctx, key, d)
+	}
+
+	return nil
+}
+
+// LockedFor asks both stores, a lock taken while primary was down must still hold once it is back.
+func (s *FallbackStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	d, err := s.fallback.LockedFor(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	primary, err := s.primary.LockedFor(ctx, key)
+	if err != nil {
+		s.log.Warn("Login guard store error, using fallback", zap.Error(err))
+		return d, nil
+	}
+
+	if primary > d {
+		d = primary
+	}
+
+	return d, nil
+}
+
+func (s *FallbackStore) Reset(ctx context.Context, key string) error {
+	if err := s.fallback.Reset(ctx, key); err != nil {
+		return err
+	}
+
+	if err := s.primary.Reset(ctx, key); err != nil {
+		s.log.Warn("Login guard store error, using fallback", zap.Error(err))
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LogMailer sends nothing, it logs every message and keeps a copy as .eml file when dir is set.
+// It is meant for local runs and tests.
+type LogMailer struct {
+	log  *zap.Logger
+	from string
+	dir  string
+}
+
+func NewLogMailer(logger *zap.Logger, from, dir string) *LogMailer {
+	return &LogMailer{log: logger, from: from, dir: dir}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.log.Info("Email", zap.String("to", msg.To), zap.String("subject", msg.Subject), zap.String("body", msg.Body))
+
+	if m.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("couldn't create mail dir: %w", err)
+	}
+
+	now := time.Now()
+	name := filepath.Join(m.dir, fmt.Sprintf("%d-%s.eml", now.UnixNano(), msg.To))
+
+	if err := os.WriteFile(name, format(m.from, msg, now), 0o644); err != nil {
+		return fmt.Errorf("couldn't write email to %s: %w", msg.To, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogMailer_Send(t *testing.T) {
+	dir := t.TempDir()
+	m := NewLogMailer(zap.NewNop(), "library@example.com", dir)
+
+	err := m.Send(context.Background(), Message{To: "reader@example.com", Subject: "Hello", Body: "line 1\nline 2"})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+
+	assert.Contains(t, string(data), "From: library@example.com\r\n")
+	assert.Contains(t, string(data), "To: reader@example.com\r\n")
+	assert.Contains(t, string(data), "Subject: Hello\r\n")
+	assert.Contains(t, string(data), "\r\n\r\nline 1\r\nline 2")
+}
+
+func TestLogMailer_SendWithoutDir(t *testing.T) {
+	m := NewLogMailer(zap.NewNop(), "library@example.com", "")
+
+	assert.NoError(t, m.Send(context.Background(), Message{To: "reader@example.com", Subject: "Hello"}))
+}
+
+func TestLogMailer_SendCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, NewLogMailer(zap.NewNop(), "", t.TempDir()).Send(ctx, Message{To: "reader@example.com"}), context.Canceled)
+}
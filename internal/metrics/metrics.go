@@ -0,0 +1,137 @@
+// Package metrics holds the Prometheus collectors of the service. They live in the default
+// registry, which GET /metrics serves.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+const (
+	_namespace      = "library"
+	_collectTimeout = 3 * time.Second
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: _namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	TransactionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: _namespace,
+		Subsystem: "transaction_service",
+		Name:      "call_duration_seconds",
+		Help:      "Latency of calls to the transaction service by operation and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "outcome"})
+
+	TransactionErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _namespace,
+		Subsystem: "transaction_service",
+		Name:      "errors_total",
+		Help:      "Failed calls to the transaction service by operation.",
+	}, []string{"operation"})
+
+	RentsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: _namespace,
+		Name:      "rents_created_total",
+		Help:      "Rentals opened, by book list or by copy checkout.",
+	})
+
+	BookReturns = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: _namespace,
+		Name:      "book_returns_total",
+		Help:      "Rentals closed.",
+	})
+
+	RevenueCharged = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: _namespace,
+		Name:      "revenue_charged_total",
+		Help:      "Sum charged through the transaction service for rentals.",
+	})
+)
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveTransaction records a call to the transaction service which started at start and ended with err.
+func ObserveTransaction(operation string, start time.Time, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+		TransactionErrors.WithLabelValues(operation).Inc()
+	}
+
+	TransactionDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+// RegisterDB exposes the pool stats of db, like open and idle connections and waits for one.
+func RegisterDB(db *sql.DB, name string) error {
+	return register(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterOverdueLoans exposes the number of loans past due, count runs on every scrape.
+func RegisterOverdueLoans(logger *zap.Logger, count func(ctx context.Context) (int, error)) error {
+	return register(&countCollector{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(_namespace, "", "overdue_loans"),
+			"Open loans past their due date.", nil, nil),
+		count: count,
+		log:   logger,
+	})
+}
+
+// register tolerates collectors registered before, the service may be wired more than once in tests.
+func register(c prometheus.Collector) error {
+	if err := prometheus.Register(c); err != nil {
+		var already prometheus.AlreadyRegisteredError
+		if !errors.As(err, &already) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type countCollector struct {
+	desc  *prometheus.Desc
+	count func(ctx context.Context) (int, error)
+	log   *zap.Logger
+}
+
+func (c *countCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *countCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), _collectTimeout)
+	defer cancel()
+
+	n, err := c.count(ctx)
+	if err != nil {
+		c.log.Error("Collect metric error", zap.String("metric", c.desc.String()), zap.Error(err))
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n))
+}
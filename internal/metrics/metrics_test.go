@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObserveTransaction(t *testing.T) {
+	before := testutil.ToFloat64(TransactionErrors.WithLabelValues("test"))
+
+	ObserveTransaction("test", time.Now(), nil)
+	ObserveTransaction("test", time.Now(), errors.New("connection refused"))
+
+	assert.Equal(t, before+1, testutil.ToFloat64(TransactionErrors.WithLabelValues("test")))
+	assert.Equal(t, 2, testutil.CollectAndCount(TransactionDuration, "library_transaction_service_call_duration_seconds"))
+}
+
+func TestCountCollector(t *testing.T) {
+	overdue := 3
+	c := &countCollector{
+		desc:  prometheus.NewDesc("library_overdue_loans", "Open loans past their due date.", nil, nil),
+		count: func(ctx context.Context) (int, error) { return overdue, nil },
+		log:   zap.NewNop(),
+	}
+
+	expected := `
+# HELP library_overdue_loans Open loans past their due date.
+# TYPE library_overdue_loans gauge
+library_overdue_loans 3
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+
+	c.count = func(ctx context.Context) (int, error) { return 0, errors.New("db is down") }
+	assert.Error(t, testutil.CollectAndCompare(c, strings.NewReader(expected)), "a failed count is reported, not zero")
+}
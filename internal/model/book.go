@@ -1,8 +1,13 @@
 package model
 
+import "time"
+
 type Book struct {
-	ID     int     `json:"id"`
-	Title  string  `json:"title"`
-	Author string  `json:"author"`
-	Price  float64 `json:"price"`
+	ID        int        `json:"id" db:"id"`
+	Title     string     `json:"title" db:"title" validate:"len=1:50"`
+	Author    string     `json:"author" db:"author" validate:"len=1:70"`
+	Price     float64    `json:"price" db:"price" validate:"min=0"`
+	ISBN      string     `json:"isbn" db:"isbn" validate:"omitempty,isbn"`
+	Version   int        `json:"version" db:"version"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty" db:"deleted_at"`
 }
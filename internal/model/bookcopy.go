@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+const (
+	CopyStatusAvailable = "available"
+	CopyStatusOnLoan    = "on_loan"
+	CopyStatusLost      = "lost"
+	CopyStatusWithdrawn = "withdrawn"
+)
+
+type BookCopy struct {
+	ID         int       `json:"id" db:"id"`
+	BookID     int       `json:"bookID" db:"book_id"`
+	Barcode    string    `json:"barcode" db:"barcode" validate:"pattern=barcode"`
+	Condition  string    `json:"condition" db:"condition" validate:"omitempty,len=1:50"`
+	AcquiredAt time.Time `json:"acquiredAt" db:"acquired_at"`
+	Status     string    `json:"status" db:"status"`
+}
+
+type BookCopyUpdateStatus struct {
+	Barcode string `validate:"required"`
+	Status  string `json:"status" validate:"oneof=available lost withdrawn"`
+}
+
+type Checkout struct {
+	Barcode string `json:"barcode" validate:"required"`
+	UserID  int    `json:"userID" validate:"positive"`
+}
+
+type Checkin struct {
+	Barcode   string `json:"barcode" validate:"required"`
+	Condition string `json:"condition" validate:"omitempty,len=1:50"`
+	// UserID is the reader the loan must belong to, 0 lets staff check in any copy.
+	UserID int `json:"-"`
+}
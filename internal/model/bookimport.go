@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+const (
+	ImportStatusPending = "pending"
+	ImportStatusRunning = "running"
+	ImportStatusDone    = "done"
+	ImportStatusFailed  = "failed"
+
+	ImportRowCreated  = "created"
+	ImportRowUpdated  = "updated"
+	ImportRowRejected = "rejected"
+)
+
+type ImportJob struct {
+	ID         string      `json:"id"`
+	Format     string      `json:"format"`
+	Status     string      `json:"status"`
+	Created    int         `json:"created"`
+	Updated    int         `json:"updated"`
+	Rejected   int         `json:"rejected"`
+	Error      string      `json:"error,omitempty"`
+	Rows       []ImportRow `json:"rows"`
+	StartedAt  time.Time   `json:"startedAt"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+}
+
+type ImportRow struct {
+	Line   int    `json:"line"`
+	ISBN   string `json:"isbn"`
+	Result string `json:"result"`
+	BookID int    `json:"bookID,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
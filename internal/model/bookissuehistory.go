@@ -4,22 +4,23 @@ import "time"
 
 type BIHistory struct {
 	ID         int            `json:"id"`
-	Books      []*RentalBooks `json:"bookID"`
-	UserID     int            `json:"userID"`
+	Books      []*RentalBooks `json:"bookID" validate:"required,dive"`
+	UserID     int            `json:"userID" validate:"positive"`
 	CreatedAt  time.Time      `json:"issueDate"`
 	ReturnDate time.Time      `json:"returnDate"`
 }
 
 type RentalBooks struct {
-	ID       int `json:"ID"`
-	Quantity int `json:"quantity"`
+	ID       int `json:"ID" validate:"positive"`
+	Quantity int `json:"quantity" validate:"positive"`
 }
 
 type BorrowedBooks struct {
-	ID         int       `json:"id"`
+	ID         int       `json:"id" db:"id"`
 	UserName   string    `json:"userName" db:"fio"`
-	BookName   string    `json:"bookName" db:"name"`
+	BookName   string    `json:"bookName" db:"title"`
 	BookAuthor string    `json:"bookAuthor" db:"author"`
+	Barcode    string    `json:"barcode,omitempty" db:"barcode"`
 	Quantity   int       `json:"quantity" db:"quantity"`
 	CreatedAt  time.Time `json:"issueDate" db:"created_at"`
 }
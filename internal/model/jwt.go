@@ -5,5 +5,6 @@ import "github.com/dgrijalva/jwt-go"
 type JWTClaim struct {
 	Username string `json:"username"`
 	UserID   int    `json:"userID"`
+	Role     string `json:"role"`
 	jwt.StandardClaims
 }
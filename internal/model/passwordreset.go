@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+type PasswordForgot struct {
+	Email string `json:"email" validate:"email"`
+}
+
+type PasswordReset struct {
+	Token             string `json:"token" validate:"required"`
+	NewPassword       string `json:"newPassword" validate:"len=3:50"`
+	NewPasswordRepeat string `json:"newPasswordRepeat" validate:"required"`
+}
+
+// PasswordResetToken is stored with the sha256 of the token only, the token itself is mailed to the user.
+// TTL is counted from the clock of the storage, the one it checks the expiry against.
+type PasswordResetToken struct {
+	ID        int           `db:"id"`
+	UserID    int           `db:"user_id"`
+	TokenHash string        `db:"token_hash"`
+	TTL       time.Duration `db:"-"`
+}
+
+type OutboxEmail struct {
+	ID        int       `db:"id"`
+	Recipient string    `db:"recipient"`
+	Subject   string    `db:"subject"`
+	Body      string    `db:"body"`
+	Attempts  int       `db:"attempts"`
+	CreatedAt time.Time `db:"created_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+// Media types of the PATCH bodies, plain application/json is read as a merge patch.
+const (
+	PatchMerge = "application/merge-patch+json"
+	PatchJSON  = "application/json-patch+json"
+)
+
+// Patch is a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) document.
+type Patch struct {
+	Type string
+	Body []byte
+}
@@ -3,3 +3,19 @@ package model
 type Response struct {
 	Message interface{} `json:"message"`
 }
+
+// Problem is an RFC 7807 error response, served as application/problem+json.
+type Problem struct {
+	Type      string             `json:"type"`
+	Title     string             `json:"title"`
+	Status    int                `json:"status"`
+	Detail    string             `json:"detail,omitempty"`
+	Instance  string             `json:"instance,omitempty"`
+	RequestID string             `json:"requestId,omitempty"`
+	Errors    []ProblemViolation `json:"errors,omitempty"`
+}
+
+type ProblemViolation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
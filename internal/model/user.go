@@ -2,28 +2,57 @@ package model
 
 import "time"
 
+const (
+	RoleReader = "reader"
+	RoleAdmin  = "admin"
+)
+
 type User struct {
-	ID       int    `json:"id"`
-	FIO      string `json:"fio"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID              int        `json:"id" db:"id"`
+	FIO             string     `json:"fio" db:"fio" validate:"len=3:50"`
+	Email           string     `json:"email" db:"email" validate:"email"`
+	Password        string     `json:"password" db:"password" validate:"len=3:50"`
+	Role            string     `json:"role" db:"role"`
+	Version         int        `json:"version" db:"version"`
+	EmailVerifiedAt *time.Time `json:"-" db:"email_verified_at"`
+	DeletedAt       *time.Time `json:"deletedAt,omitempty" db:"deleted_at"`
 }
 
 type UserLogin struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+	// IP is the client address, failed attempts are counted per IP as well.
+	IP string `json:"-"`
 }
 
 type UserUpdateFIO struct {
-	ID  int
-	FIO string `json:"fio"`
+	ID      int
+	FIO     string `json:"fio" validate:"len=3:50"`
+	Version int    `json:"-"`
 }
 
 type UserUpdatePassword struct {
 	ID                int
-	CurrentPassword   string `json:"currentPassword"`
-	NewPassword       string `json:"newPassword"`
-	NewPasswordRepeat string `json:"newPasswordRepeat"`
+	CurrentPassword   string `json:"currentPassword" validate:"required"`
+	NewPassword       string `json:"newPassword" validate:"len=3:50"`
+	NewPasswordRepeat string `json:"newPasswordRepeat" validate:"required"`
+}
+
+type EmailVerificationResend struct {
+	Email string `json:"email" validate:"email"`
+}
+
+// EmailVerificationToken is stored with the sha256 of the token only, like PasswordResetToken.
+type EmailVerificationToken struct {
+	ID        int           `db:"id"`
+	UserID    int           `db:"user_id"`
+	TokenHash string        `db:"token_hash"`
+	TTL       time.Duration `db:"-"`
+}
+
+// EmailVerified reports whether the user has followed the link from the verification email.
+func (u User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
 
 type UserAccount struct {
@@ -45,3 +74,5 @@ type contextKey string
 
 const ContextUserID = contextKey("userID")
 const ContextUserName = contextKey("userName")
+const ContextUserRole = contextKey("userRole")
+const ContextClientIP = contextKey("clientIP")
@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+// PublicUser is what anyone may see of a user.
+type PublicUser struct {
+	ID  int    `json:"id"`
+	FIO string `json:"fio"`
+}
+
+// SelfUser is the profile shown to the user it belongs to.
+type SelfUser struct {
+	ID            int    `json:"id"`
+	FIO           string `json:"fio"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+	Role          string `json:"role"`
+	Version       int    `json:"version"`
+}
+
+// AdminUser is the view of a user for admins.
+type AdminUser struct {
+	ID              int        `json:"id"`
+	FIO             string     `json:"fio"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty"`
+	Role            string     `json:"role"`
+	Version         int        `json:"version"`
+	DeletedAt       *time.Time `json:"deletedAt,omitempty"`
+}
+
+func NewPublicUser(user User) PublicUser {
+	return PublicUser{ID: user.ID, FIO: user.FIO}
+}
+
+func NewSelfUser(user User) SelfUser {
+	return SelfUser{
+		ID:            user.ID,
+		FIO:           user.FIO,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified(),
+		Role:          user.Role,
+		Version:       user.Version,
+	}
+}
+
+func NewAdminUser(user User) AdminUser {
+	return AdminUser{
+		ID:              user.ID,
+		FIO:             user.FIO,
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		Role:            user.Role,
+		Version:         user.Version,
+		DeletedAt:       user.DeletedAt,
+	}
+}
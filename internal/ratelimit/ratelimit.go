@@ -0,0 +1,102 @@
+// Package ratelimit implements token buckets. A bucket holds Limit.Requests tokens and is refilled
+// at Requests per Period, every request takes one token.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Unlimited is the zero Limit, requests are never counted against it.
+func (l Limit) Unlimited() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+func (l Limit) String() string {
+	if l.Unlimited() {
+		return "off"
+	}
+
+	return fmt.Sprintf("%d/%v", l.Requests, l.Period)
+}
+
+// perNano is the refill rate in tokens per nanosecond.
+func (l Limit) perNano() float64 {
+	return float64(l.Requests) / float64(l.Period)
+}
+
+// ParseLimit reads limits like "100/m", "10/s", "5000/h" or "20/30s". An empty string and "off" mean no limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "off" {
+		return Limit{}, nil
+	}
+
+	count, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, want requests/period", s)
+	}
+
+	requests, err := strconv.Atoi(count)
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, requests must be a positive number", s)
+	}
+
+	var d time.Duration
+	switch period {
+	case "s":
+		d = time.Second
+	case "m":
+		d = time.Minute
+	case "h":
+		d = time.Hour
+	default:
+		if d, err = time.ParseDuration(period); err != nil || d <= 0 {
+			return Limit{}, fmt.Errorf("invalid rate limit %q, period must be s, m, h or a duration", s)
+		}
+	}
+
+	return Limit{Requests: requests, Period: d}, nil
+}
+
+// Result describes the bucket after a request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next token, zero when the request is allowed.
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// newResult describes a bucket left with tokens after the request.
+func newResult(limit Limit, allowed bool, tokens float64) Result {
+	rate := limit.perNano()
+
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration(math.Ceil((float64(limit.Requests) - tokens) / rate)),
+	}
+
+	if !allowed {
+		res.RetryAfter = time.Duration(math.Ceil((1 - tokens) / rate))
+	}
+
+	return res
+}
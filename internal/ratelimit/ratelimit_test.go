@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"", Limit{}, false},
+		{"off", Limit{}, false},
+		{"100/m", Limit{Requests: 100, Period: time.Minute}, false},
+		{"10/s", Limit{Requests: 10, Period: time.Second}, false},
+		{"5000/h", Limit{Requests: 5000, Period: time.Hour}, false},
+		{"20/30s", Limit{Requests: 20, Period: 30 * time.Second}, false},
+		{"100", Limit{}, true},
+		{"0/m", Limit{}, true},
+		{"ten/m", Limit{}, true},
+		{"10/week", Limit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryLimiter_Allow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	l := NewMemoryLimiter()
+	l.now = func() time.Time { return now }
+
+	limit := Limit{Requests: 2, Period: 10 * time.Second}
+
+	res, _ := l.Allow(ctx, "k", limit)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 5 * time.Second}, res)
+
+	res, _ = l.Allow(ctx, "k", limit)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	res, _ = l.Allow(ctx, "k", limit)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 5*time.Second, res.RetryAfter)
+
+	res, _ = l.Allow(ctx, "other", limit)
+	assert.True(t, res.Allowed, "buckets are per key")
+
+	now = now.Add(5 * time.Second)
+	res, _ = l.Allow(ctx, "k", limit)
+	assert.True(t, res.Allowed, "one token is back after period/requests")
+	assert.Equal(t, 0, res.Remaining)
+}
+
+func TestMemoryLimiter_Unlimited(t *testing.T) {
+	l := NewMemoryLimiter()
+
+	for i := 0; i < 100; i++ {
+		res, _ := l.Allow(context.Background(), "k", Limit{})
+		assert.True(t, res.Allowed)
+	}
+	assert.Empty(t, l.buckets)
+}
+
+type brokenLimiter struct{}
+
+func (brokenLimiter) Allow(context.Context, string, Limit) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func TestFallbackLimiter(t *testing.T) {
+	l := NewFallbackLimiter(zap.NewNop(), brokenLimiter{}, NewMemoryLimiter())
+	limit := Limit{Requests: 1, Period: time.Minute}
+
+	res, err := l.Allow(context.Background(), "k", limit)
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	res, err = l.Allow(context.Background(), "k", limit)
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+}
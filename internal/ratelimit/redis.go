@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"strconv"
+)
+
+const _redisKeyPrefix = "ratelimit:"
+
+// _tokenBucket refills and takes a token in one step, so replicas never race on a bucket.
+// The clock of Redis is used, replicas may disagree about the time.
+var _tokenBucket = redis.NewScript(`
+redis.replicate_commands()
+local burst = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * burst / period)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], period)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisLimiter shares the buckets between replicas.
+type RedisLimiter struct {
+	client redis.UniversalClient
+}
+
+func NewRedisLimiter(client redis.UniversalClient) *RedisLimiter {
+	return &RedisLimiter{client: client}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if limit.Unlimited() {
+		return Result{Allowed: true}, nil
+	}
+
+	reply, err := _tokenBucket.Run(ctx, l.client, []string{_redisKeyPrefix + key},
+		limit.Requests, limit.Period.Milliseconds()).Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("couldn't take token of %s: %w", key, err)
+	}
+
+	allowed, _ := reply[0].(int64)
+	str, _ := reply[1].(string)
+
+	tokens, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("couldn't read tokens of %s: %w", key, err)
+	}
+
+	return newResult(limit, allowed == 1, tokens), nil
+}
+
+// FallbackLimiter uses primary and switches to fallback for the calls primary fails,
+// limits then hold per replica only.
+type FallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+	log      *zap.Logger
+}
+
+func NewFallbackLimiter(log *zap.Logger, primary, fallback Limiter) *FallbackLimiter {
+	return &FallbackLimiter{primary: primary, fallback: fallback, log: log}
+}
+
+func (l *FallbackLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	res, err := l.primary.Allow(ctx, key, limit)
+	if err != nil {
+		l.log.Warn("Rate limiter error, using fallback", zap.Error(err))
+		return l.fallback.Allow(ctx, key, limit)
+	}
+
+	return res, nil
+}
+
+// New limits through Redis if there is a client, in memory otherwise.
+func New(logger *zap.Logger, client *redis.Client) Limiter {
+	memory := NewMemoryLimiter()
+	if client == nil {
+		return memory
+	}
+
+	return NewFallbackLimiter(logger, NewRedisLimiter(client), memory)
+}
@@ -2,18 +2,28 @@ package service
 
 import (
 	"context"
+	"github.com/zhayt/user-storage-service/internal/metrics"
 	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/tracing"
+	"github.com/zhayt/user-storage-service/internal/validation"
 	"go.uber.org/zap"
+	"time"
 )
 
 type IBIHistoryStorage interface {
 	GetCurrentBorrowedBooks(ctx context.Context) ([]model.BorrowedBooks, error)
 	GetBIHistoryLastMonth(ctx context.Context) ([]model.BorrowedBooks, error)
+	IterateCurrentBorrowedBooks(ctx context.Context, fn func(model.BorrowedBooks) error) error
+	IterateBIHistoryLastMonth(ctx context.Context, fn func(model.BorrowedBooks) error) error
 	CreateBIHistory(ctx context.Context, bIHistory model.BIHistory) error
 	UpdateBIHistory(ctx context.Context, bIHistoryID int) (int, error)
+	CountOverdueLoans(ctx context.Context, loanPeriod time.Duration) (int, error)
 	DeleteBIHistory(ctx context.Context, bIHistoryID int) error
 }
 
+// LoanPeriod is how long a reader may keep a book.
+const LoanPeriod = 14 * 24 * time.Hour
+
 type BIHistory struct {
 	history IBIHistoryStorage
 	log     *zap.Logger
@@ -24,25 +34,70 @@ func NewBIHistory(log *zap.Logger, history IBIHistoryStorage) *BIHistory {
 }
 
 func (s *BIHistory) CreateBIHistory(ctx context.Context, history model.BIHistory) error {
+	ctx, span := tracing.Start(ctx, "BIHistory.CreateBIHistory")
+	defer span.End()
+
 	// нужно ли проверять существует ли книга с таким ID и пользовотель,
 	// если да то в каком слое?
 	// в слое Handler, или в этом же сервисе могу вызвать метод сторадже который дастаем мне юзера
+	if err := validation.Struct(history); err != nil {
+		return err
+	}
 
 	return s.history.CreateBIHistory(ctx, history)
 }
 
 func (s *BIHistory) GetCurrentBorrowedBooks(ctx context.Context) ([]model.BorrowedBooks, error) {
+	ctx, span := tracing.Start(ctx, "BIHistory.GetCurrentBorrowedBooks")
+	defer span.End()
+
 	return s.history.GetCurrentBorrowedBooks(ctx)
 }
 
 func (s *BIHistory) GetBIHistoryLastMonth(ctx context.Context) ([]model.BorrowedBooks, error) {
+	ctx, span := tracing.Start(ctx, "BIHistory.GetBIHistoryLastMonth")
+	defer span.End()
+
 	return s.history.GetBIHistoryLastMonth(ctx)
 }
 
+func (s *BIHistory) IterateCurrentBorrowedBooks(ctx context.Context, fn func(model.BorrowedBooks) error) error {
+	ctx, span := tracing.Start(ctx, "BIHistory.IterateCurrentBorrowedBooks")
+	defer span.End()
+
+	return s.history.IterateCurrentBorrowedBooks(ctx, fn)
+}
+
+func (s *BIHistory) IterateBIHistoryLastMonth(ctx context.Context, fn func(model.BorrowedBooks) error) error {
+	ctx, span := tracing.Start(ctx, "BIHistory.IterateBIHistoryLastMonth")
+	defer span.End()
+
+	return s.history.IterateBIHistoryLastMonth(ctx, fn)
+}
+
 func (s *BIHistory) UpdateBIHistory(ctx context.Context, bIHistoryID int) (int, error) {
-	return s.history.UpdateBIHistory(ctx, bIHistoryID)
+	ctx, span := tracing.Start(ctx, "BIHistory.UpdateBIHistory")
+	defer span.End()
+
+	id, err := s.history.UpdateBIHistory(ctx, bIHistoryID)
+	if err == nil {
+		metrics.BookReturns.Inc()
+	}
+
+	return id, err
+}
+
+// CountOverdueLoans counts the loans kept longer than LoanPeriod.
+func (s *BIHistory) CountOverdueLoans(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "BIHistory.CountOverdueLoans")
+	defer span.End()
+
+	return s.history.CountOverdueLoans(ctx, LoanPeriod)
 }
 
 func (s *BIHistory) DeleteBIHistory(ctx context.Context, bIHistoryID int) error {
+	ctx, span := tracing.Start(ctx, "BIHistory.DeleteBIHistory")
+	defer span.End()
+
 	return s.history.DeleteBIHistory(ctx, bIHistoryID)
 }
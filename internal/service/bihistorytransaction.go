@@ -3,23 +3,34 @@ package service
 import (
 	"context"
 	"fmt"
+	"github.com/zhayt/user-storage-service/internal/metrics"
 	"github.com/zhayt/user-storage-service/internal/model"
 	"github.com/zhayt/user-storage-service/internal/storage"
+	"github.com/zhayt/user-storage-service/internal/tracing"
+	"github.com/zhayt/user-storage-service/internal/validation"
+	"github.com/zhayt/user-storage-service/logger"
 	"go.uber.org/zap"
+	"time"
 )
 
+// _chargeTimeout bounds each call to the transaction service made for a rent.
+const _chargeTimeout = 5 * time.Second
+
 type IBIHistoryService interface {
 	CreateBIHistory(ctx context.Context, history model.BIHistory) error
 	GetCurrentBorrowedBooks(ctx context.Context) ([]model.BorrowedBooks, error)
 	GetBIHistoryLastMonth(ctx context.Context) ([]model.BorrowedBooks, error)
+	IterateCurrentBorrowedBooks(ctx context.Context, fn func(model.BorrowedBooks) error) error
+	IterateBIHistoryLastMonth(ctx context.Context, fn func(model.BorrowedBooks) error) error
 	UpdateBIHistory(ctx context.Context, bIHistoryID int) (int, error)
+	CountOverdueLoans(ctx context.Context) (int, error)
 	DeleteBIHistory(ctx context.Context, bIHistoryID int) error
 }
 
 type ITransactionService interface {
-	CreateTransaction(transaction model.Transaction) (int, error)
-	CreateTransactionItem(item model.TransactionItem) error
-	DeleteTransaction(transactionID int) error
+	CreateTransaction(ctx context.Context, transaction model.Transaction) (int, error)
+	CreateTransactionItem(ctx context.Context, item model.TransactionItem) error
+	DeleteTransaction(ctx context.Context, transactionID int) error
 }
 
 type IGetBookUser interface {
@@ -31,16 +42,26 @@ type RentTransactionService struct {
 	IBIHistoryService
 	ITransactionService
 	IGetBookUser
-	l *zap.Logger
+	tx ITxManager
+	l  *zap.Logger
 }
 
-func NewRentTransactionService(logger *zap.Logger, storage *storage.Storage) *RentTransactionService {
-	return &RentTransactionService{IBIHistoryService: NewBIHistory(logger, storage), ITransactionService: NewTransaction(logger), IGetBookUser: storage}
+func NewRentTransactionService(logger *zap.Logger, transactionURL string, storage *storage.Storage) *RentTransactionService {
+	return &RentTransactionService{IBIHistoryService: NewBIHistory(logger, storage), ITransactionService: NewTransaction(logger, transactionURL),
+		IGetBookUser: storage, tx: storage, l: logger}
 }
 
+// RentBook is open only to users who have verified their email. The request is validated and its
+// user and books are looked up before anything is charged. The rent is charged first, outside
+// any transaction: no lock is held while the transaction service answers, and each call to it is
+// bounded by _chargeTimeout. The history is then written in a short transaction which checks the
+// user again, a charge whose history could not be saved is deleted from the transaction service.
 func (s *RentTransactionService) RentBook(ctx context.Context, history model.BIHistory) error {
-	if err := s.CreateBIHistory(ctx, history); err != nil {
-		return fmt.Errorf("couldn't create bihistory: %w", err)
+	ctx, span := tracing.Start(ctx, "RentTransactionService.RentBook")
+	defer span.End()
+
+	if err := validation.Struct(history); err != nil {
+		return err
 	}
 
 	user, err := s.GetUserByID(ctx, history.UserID)
@@ -48,9 +69,12 @@ func (s *RentTransactionService) RentBook(ctx context.Context, history model.BIH
 		return fmt.Errorf("couldn't create bihistory: %w", err)
 	}
 
-	books := make([]model.Book, 0, len(history.Books))
+	if !user.EmailVerified() {
+		return ErrEmailNotVerified
+	}
 
 	var amount float64
+	books := make([]model.Book, 0, len(history.Books))
 
 	for _, rentBook := range history.Books {
 		book, err := s.GetBookByID(ctx, rentBook.ID)
@@ -63,31 +87,73 @@ func (s *RentTransactionService) RentBook(ctx context.Context, history model.BIH
 		books = append(books, book)
 	}
 
-	transaction := model.Transaction{
-		UserName: user.FIO,
-		Amount:   amount,
+	transactionID, err := s.charge(ctx, model.Transaction{UserName: user.FIO, Amount: amount}, books)
+	if err != nil {
+		if transactionID != 0 {
+			s.cancelTransaction(ctx, transactionID)
+		}
+
+		return fmt.Errorf("couldn't create bihistory: %w", err)
 	}
 
-	transactionID, err := s.CreateTransaction(transaction)
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := s.GetUserByID(ctx, history.UserID)
+		if err != nil {
+			return err
+		}
+
+		if !user.EmailVerified() {
+			return ErrEmailNotVerified
+		}
+
+		return s.CreateBIHistory(ctx, history)
+	})
 	if err != nil {
+		s.cancelTransaction(ctx, transactionID)
+
 		return fmt.Errorf("couldn't create bihistory: %w", err)
 	}
 
+	metrics.RentsCreated.Inc()
+	metrics.RevenueCharged.Add(amount)
+
+	return nil
+}
+
+// charge creates the transaction and its items. It returns the id of the transaction as soon as
+// it is created, so the caller can delete it when an item fails.
+func (s *RentTransactionService) charge(ctx context.Context, transaction model.Transaction, books []model.Book) (int, error) {
+	callCtx, cancel := context.WithTimeout(ctx, _chargeTimeout)
+	transactionID, err := s.CreateTransaction(callCtx, transaction)
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+
 	for _, book := range books {
 		item := model.TransactionItem{
 			TransactionID: uint(transactionID),
 			Book:          &book,
 		}
 
-		if err = s.CreateTransactionItem(item); err != nil {
-			if err = s.DeleteTransaction(transactionID); err != nil {
-				return fmt.Errorf("delete transaction error")
-			}
-
-			// удалить записи из BIHistory
-			return fmt.Errorf("couldn't create bihistory: %w", err)
+		callCtx, cancel = context.WithTimeout(ctx, _chargeTimeout)
+		err = s.CreateTransactionItem(callCtx, item)
+		cancel()
+		if err != nil {
+			return transactionID, err
 		}
 	}
 
-	return nil
+	return transactionID, nil
+}
+
+// cancelTransaction deletes a charge whose rent failed. The rent has failed already,
+// so an error here is only logged.
+func (s *RentTransactionService) cancelTransaction(ctx context.Context, transactionID int) {
+	ctx, cancel := context.WithTimeout(ctx, _chargeTimeout)
+	defer cancel()
+
+	if err := s.DeleteTransaction(ctx, transactionID); err != nil {
+		logger.FromContext(ctx, s.l).Error("Delete transaction error", zap.Int("transactionID", transactionID), zap.Error(err))
+	}
 }
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zhayt/user-storage-service/config"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/storage"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRentTransactionService_RentBook_RollsBackFailedCharge(t *testing.T) {
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+		case r.URL.Path == "/api/v1/transactions/items":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			_, _ = w.Write([]byte("7"))
+		}
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{}
+	cfg.StorageDriver = storage.DriverMemory
+	repo, err := storage.NewStorage(context.Background(), &sync.WaitGroup{}, zap.NewNop(), cfg)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	userID, err := repo.CreateUser(ctx, model.User{FIO: "Aybek", Email: "reader@mail.ru", Password: "hash", Role: model.RoleReader})
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateEmailVerificationToken(ctx,
+		model.EmailVerificationToken{UserID: userID, TokenHash: "hash", TTL: time.Hour},
+		model.OutboxEmail{Recipient: "reader@mail.ru", Subject: "Verify", Body: "link"}))
+	_, err = repo.VerifyEmail(ctx, "hash")
+	require.NoError(t, err)
+
+	bookID, err := repo.CreateBook(ctx, model.Book{Title: "Rolled Back", Author: "Author", Price: 10})
+	require.NoError(t, err)
+
+	s := NewRentTransactionService(zap.NewNop(), srv.URL, repo)
+	err = s.RentBook(ctx, model.BIHistory{UserID: userID, Books: []*model.RentalBooks{{ID: bookID, Quantity: 1}}})
+	require.Error(t, err)
+
+	open, err := repo.HasOpenLoans(ctx, bookID)
+	require.NoError(t, err)
+	assert.False(t, open, "the history of a failed rent must be rolled back")
+	assert.Equal(t, []string{"/api/v1/transactions/7"}, deleted)
+}
+
+func TestRentTransactionService_RentBook_ChargesOutsideTx(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.StorageDriver = storage.DriverMemory
+	repo, err := storage.NewStorage(context.Background(), &sync.WaitGroup{}, zap.NewNop(), cfg)
+	require.NoError(t, err)
+
+	// a write while the transaction service answers would wait for the lock of a transaction held across the call
+	written := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/transactions" {
+			go func() {
+				_, err := repo.CreateBook(context.Background(), model.Book{Title: "Meanwhile", Author: "Author", Price: 1})
+				written <- err
+			}()
+
+			select {
+			case err := <-written:
+				assert.NoError(t, err)
+			case <-time.After(time.Second):
+				t.Error("the store is locked while the rent is charged")
+			}
+		}
+		_, _ = w.Write([]byte("7"))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	userID, err := repo.CreateUser(ctx, model.User{FIO: "Aybek", Email: "reader@mail.ru", Password: "hash", Role: model.RoleReader})
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateEmailVerificationToken(ctx,
+		model.EmailVerificationToken{UserID: userID, TokenHash: "hash", TTL: time.Hour},
+		model.OutboxEmail{Recipient: "reader@mail.ru", Subject: "Verify", Body: "link"}))
+	_, err = repo.VerifyEmail(ctx, "hash")
+	require.NoError(t, err)
+
+	bookID, err := repo.CreateBook(ctx, model.Book{Title: "Charged", Author: "Author", Price: 10})
+	require.NoError(t, err)
+
+	s := NewRentTransactionService(zap.NewNop(), srv.URL, repo)
+	require.NoError(t, s.RentBook(ctx, model.BIHistory{UserID: userID, Books: []*model.RentalBooks{{ID: bookID, Quantity: 1}}}))
+
+	open, err := repo.HasOpenLoans(ctx, bookID)
+	require.NoError(t, err)
+	assert.True(t, open)
+}
+
+func TestRentTransactionService_RentBook_ValidatesBeforeCharge(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write([]byte("7"))
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{}
+	cfg.StorageDriver = storage.DriverMemory
+	repo, err := storage.NewStorage(context.Background(), &sync.WaitGroup{}, zap.NewNop(), cfg)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	userID, err := repo.CreateUser(ctx, model.User{FIO: "Aybek", Email: "reader@mail.ru", Password: "hash", Role: model.RoleReader})
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateEmailVerificationToken(ctx,
+		model.EmailVerificationToken{UserID: userID, TokenHash: "hash", TTL: time.Hour},
+		model.OutboxEmail{Recipient: "reader@mail.ru", Subject: "Verify", Body: "link"}))
+	_, err = repo.VerifyEmail(ctx, "hash")
+	require.NoError(t, err)
+
+	bookID, err := repo.CreateBook(ctx, model.Book{Title: "Not Charged", Author: "Author", Price: 10})
+	require.NoError(t, err)
+
+	s := NewRentTransactionService(zap.NewNop(), srv.URL, repo)
+
+	for name, history := range map[string]model.BIHistory{
+		"no books":      {UserID: userID},
+		"no quantity":   {UserID: userID, Books: []*model.RentalBooks{{ID: bookID}}},
+		"no user":       {Books: []*model.RentalBooks{{ID: bookID, Quantity: 1}}},
+		"missing book":  {UserID: userID, Books: []*model.RentalBooks{{ID: bookID + 1000, Quantity: 1}}},
+		"invalid books": {UserID: userID, Books: []*model.RentalBooks{{ID: -1, Quantity: 1}}},
+	} {
+		assert.Error(t, s.RentBook(ctx, history), name)
+	}
+
+	assert.Zero(t, calls, "nothing is charged for an invalid rent")
+}
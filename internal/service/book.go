@@ -2,46 +2,159 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/catalog"
 	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/tracing"
+	"github.com/zhayt/user-storage-service/internal/validation"
 	"go.uber.org/zap"
+	"strings"
+)
+
+var (
+	ErrBookOnLoan      = apperror.New(apperror.Conflict, "book has copies on loan")
+	ErrVersionMismatch = apperror.New(apperror.PreconditionFailed, "record has been changed by someone else")
 )
 
 type IBookStorage interface {
 	GetBookByID(ctx context.Context, bookID int) (model.Book, error)
 	GetAllBooks(ctx context.Context) ([]model.Book, error)
+	IterateBooks(ctx context.Context, fn func(model.Book) error) error
 	CreateBook(ctx context.Context, book model.Book) (int, error)
 	UpdateBook(ctx context.Context, book model.Book) (int, error)
+	UpsertBookByISBN(ctx context.Context, book model.Book) (int, bool, error)
+	HasOpenLoans(ctx context.Context, bookID int) (bool, error)
 	DeleteBook(ctx context.Context, bookID int) error
+	RestoreBook(ctx context.Context, bookID int) (int, error)
 }
 
 type BookService struct {
+	tx   ITxManager
 	book IBookStorage
 	log  *zap.Logger
 }
 
-func NewBookService(log *zap.Logger, book IBookStorage) *BookService {
-	return &BookService{book: book, log: log}
+func NewBookService(log *zap.Logger, tx ITxManager, book IBookStorage) *BookService {
+	return &BookService{tx: tx, book: book, log: log}
 }
 
 func (s *BookService) CreateBook(ctx context.Context, book model.Book) (int, error) {
-	// проверка валидности данных
+	ctx, span := tracing.Start(ctx, "BookService.CreateBook")
+	defer span.End()
+
+	book, err := validateBook(book)
+	if err != nil {
+		return 0, err
+	}
+
 	return s.book.CreateBook(ctx, book)
 }
 
 func (s *BookService) GetBookByID(ctx context.Context, bookId int) (model.Book, error) {
+	ctx, span := tracing.Start(ctx, "BookService.GetBookByID")
+	defer span.End()
+
 	return s.book.GetBookByID(ctx, bookId)
 }
 
 func (s *BookService) GetAllBooks(ctx context.Context) ([]model.Book, error) {
+	ctx, span := tracing.Start(ctx, "BookService.GetAllBooks")
+	defer span.End()
+
 	return s.book.GetAllBooks(ctx)
 }
 
-func (s *BookService) UpdateBook(ctx context.Context, book model.Book) (int, error) {
-	// проверка валидности данных
+func (s *BookService) IterateBooks(ctx context.Context, fn func(model.Book) error) error {
+	ctx, span := tracing.Start(ctx, "BookService.IterateBooks")
+	defer span.End()
 
-	return s.book.UpdateBook(ctx, book)
+	return s.book.IterateBooks(ctx, fn)
+}
+
+// PatchBook applies the patch on top of the stored book and writes the result if it is still valid.
+// version is the one the caller has seen, the patch is refused once the stored book has moved on.
+func (s *BookService) PatchBook(ctx context.Context, bookID, version int, patch model.Patch) (model.Book, error) {
+	ctx, span := tracing.Start(ctx, "BookService.PatchBook")
+	defer span.End()
+
+	var book model.Book
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) (err error) {
+		if book, err = s.book.GetBookByID(ctx, bookID); err != nil {
+			return err
+		}
+
+		if book.Version != version {
+			return ErrVersionMismatch
+		}
+
+		doc, err := applyPatch(bookDocument{Title: book.Title, Author: book.Author, Price: book.Price, ISBN: book.ISBN}, patch)
+		if err != nil {
+			return err
+		}
+
+		book.Title, book.Author, book.Price, book.ISBN = doc.Title, doc.Author, doc.Price, doc.ISBN
+
+		if book, err = validateBook(book); err != nil {
+			return err
+		}
+
+		if _, err = s.book.UpdateBook(ctx, book); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrVersionMismatch
+			}
+			return err
+		}
+
+		book.Version++
+
+		return nil
+	})
+
+	return book, err
 }
 
 func (s *BookService) DeleteBook(ctx context.Context, bookId int) error {
-	return s.book.DeleteBook(ctx, bookId)
+	ctx, span := tracing.Start(ctx, "BookService.DeleteBook")
+	defer span.End()
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		onLoan, err := s.book.HasOpenLoans(ctx, bookId)
+		if err != nil {
+			return err
+		}
+
+		if onLoan {
+			return ErrBookOnLoan
+		}
+
+		return s.book.DeleteBook(ctx, bookId)
+	})
+}
+
+func (s *BookService) RestoreBook(ctx context.Context, bookId int) (int, error) {
+	ctx, span := tracing.Start(ctx, "BookService.RestoreBook")
+	defer span.End()
+
+	return s.book.RestoreBook(ctx, bookId)
+}
+
+// normalizeBook trims the text fields and brings a valid ISBN to its ISBN-13 form.
+func normalizeBook(book model.Book) model.Book {
+	book.Title = strings.TrimSpace(book.Title)
+	book.Author = strings.TrimSpace(book.Author)
+
+	if isbn, err := catalog.NormalizeISBN(book.ISBN); err == nil {
+		book.ISBN = isbn
+	}
+
+	return book
+}
+
+func validateBook(book model.Book) (model.Book, error) {
+	book = normalizeBook(book)
+
+	return book, validation.Struct(book)
 }
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/metrics"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/tracing"
+	"github.com/zhayt/user-storage-service/internal/validation"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+var ErrCopyNotAvailable = apperror.New(apperror.Conflict, "book copy is not available")
+
+type IBookCopyStorage interface {
+	CreateBookCopy(ctx context.Context, bookCopy model.BookCopy) (int, error)
+	GetBookCopyByBarcode(ctx context.Context, barcode string) (model.BookCopy, error)
+	GetBookCopies(ctx context.Context, bookID int) ([]model.BookCopy, error)
+	UpdateBookCopyStatus(ctx context.Context, bookCopy model.BookCopyUpdateStatus) (int, error)
+	CheckoutBookCopy(ctx context.Context, checkout model.Checkout) (int, error)
+	CheckinBookCopy(ctx context.Context, checkin model.Checkin) (int, error)
+}
+
+type BookCopyService struct {
+	tx       ITxManager
+	bookCopy IBookCopyStorage
+	user     IUserStorage
+	log      *zap.Logger
+}
+
+func NewBookCopyService(log *zap.Logger, tx ITxManager, bookCopy IBookCopyStorage, user IUserStorage) *BookCopyService {
+	return &BookCopyService{tx: tx, bookCopy: bookCopy, user: user, log: log}
+}
+
+func (s *BookCopyService) CreateBookCopy(ctx context.Context, bookCopy model.BookCopy) (int, error) {
+	ctx, span := tracing.Start(ctx, "BookCopyService.CreateBookCopy")
+	defer span.End()
+
+	bookCopy.Barcode = strings.TrimSpace(bookCopy.Barcode)
+	if err := validation.Struct(bookCopy); err != nil {
+		return 0, err
+	}
+
+	if bookCopy.Condition == "" {
+		bookCopy.Condition = "good"
+	}
+
+	if bookCopy.AcquiredAt.IsZero() {
+		bookCopy.AcquiredAt = time.Now()
+	}
+
+	return s.bookCopy.CreateBookCopy(ctx, bookCopy)
+}
+
+func (s *BookCopyService) GetBookCopyByBarcode(ctx context.Context, barcode string) (model.BookCopy, error) {
+	ctx, span := tracing.Start(ctx, "BookCopyService.GetBookCopyByBarcode")
+	defer span.End()
+
+	return s.bookCopy.GetBookCopyByBarcode(ctx, barcode)
+}
+
+func (s *BookCopyService) GetBookCopies(ctx context.Context, bookID int) ([]model.BookCopy, error) {
+	ctx, span := tracing.Start(ctx, "BookCopyService.GetBookCopies")
+	defer span.End()
+
+	return s.bookCopy.GetBookCopies(ctx, bookID)
+}
+
+// UpdateBookCopyStatus is used to write a copy off as lost or withdrawn, or to bring it back.
+// Loans are opened and closed only through CheckoutBookCopy and CheckinBookCopy, a copy on loan
+// keeps its status until it is checked in.
+func (s *BookCopyService) UpdateBookCopyStatus(ctx context.Context, bookCopy model.BookCopyUpdateStatus) (int, error) {
+	ctx, span := tracing.Start(ctx, "BookCopyService.UpdateBookCopyStatus")
+	defer span.End()
+
+	if err := validation.Struct(bookCopy); err != nil {
+		return 0, err
+	}
+
+	var copyID int
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		current, err := s.bookCopy.GetBookCopyByBarcode(ctx, bookCopy.Barcode)
+		if err != nil {
+			return err
+		}
+
+		if current.Status == model.CopyStatusOnLoan {
+			return apperror.Wrap(apperror.Conflict, fmt.Sprintf("copy barcode#%s must be checked in", bookCopy.Barcode), ErrCopyNotAvailable)
+		}
+
+		copyID, err = s.bookCopy.UpdateBookCopyStatus(ctx, bookCopy)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return copyID, nil
+}
+
+func (s *BookCopyService) CheckoutBookCopy(ctx context.Context, checkout model.Checkout) (int, error) {
+	ctx, span := tracing.Start(ctx, "BookCopyService.CheckoutBookCopy")
+	defer span.End()
+
+	if err := validation.Struct(checkout); err != nil {
+		return 0, err
+	}
+
+	var bihID int
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := s.user.GetUserByID(ctx, checkout.UserID)
+		if err != nil {
+			return err
+		}
+
+		if !user.EmailVerified() {
+			return ErrEmailNotVerified
+		}
+
+		bookCopy, err := s.bookCopy.GetBookCopyByBarcode(ctx, checkout.Barcode)
+		if err != nil {
+			return err
+		}
+
+		if bookCopy.Status != model.CopyStatusAvailable {
+			return apperror.Wrap(apperror.Conflict, fmt.Sprintf("copy barcode#%s is %s", bookCopy.Barcode, bookCopy.Status),
+				ErrCopyNotAvailable)
+		}
+
+		bihID, err = s.bookCopy.CheckoutBookCopy(ctx, checkout)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.RentsCreated.Inc()
+
+	return bihID, nil
+}
+
+func (s *BookCopyService) CheckinBookCopy(ctx context.Context, checkin model.Checkin) (int, error) {
+	ctx, span := tracing.Start(ctx, "BookCopyService.CheckinBookCopy")
+	defer span.End()
+
+	if err := validation.Struct(checkin); err != nil {
+		return 0, err
+	}
+
+	checkin.Condition = strings.TrimSpace(checkin.Condition)
+
+	var bihID int
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		bookCopy, err := s.bookCopy.GetBookCopyByBarcode(ctx, checkin.Barcode)
+		if err != nil {
+			return err
+		}
+
+		if bookCopy.Status != model.CopyStatusOnLoan {
+			return invalidData(fmt.Sprintf("copy barcode#%s is not on loan", bookCopy.Barcode))
+		}
+
+		bihID, err = s.bookCopy.CheckinBookCopy(ctx, checkin)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.BookReturns.Inc()
+
+	return bihID, nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/storage/inmemory"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestBookCopyService_UpdateBookCopyStatus_OnLoan(t *testing.T) {
+	ctx := context.Background()
+	db := inmemory.New()
+	users, books, copies := inmemory.NewUserStorage(db), inmemory.NewBookStorage(db), inmemory.NewBookCopyStorage(db)
+
+	userID, err := users.CreateUser(ctx, model.User{FIO: "Aybek", Email: "reader@mail.ru", Password: "hash", Role: model.RoleReader})
+	require.NoError(t, err)
+	bookID, err := books.CreateBook(ctx, model.Book{Title: "On Loan", Author: "Author", Price: 10})
+	require.NoError(t, err)
+	_, err = copies.CreateBookCopy(ctx, model.BookCopy{BookID: bookID, Barcode: "LOAN-1", Condition: "good", AcquiredAt: time.Now()})
+	require.NoError(t, err)
+	_, err = copies.CheckoutBookCopy(ctx, model.Checkout{Barcode: "LOAN-1", UserID: userID})
+	require.NoError(t, err)
+
+	s := NewBookCopyService(zap.NewNop(), inmemory.NewTxManager(db), copies, users)
+
+	for _, status := range []string{model.CopyStatusAvailable, model.CopyStatusLost, model.CopyStatusWithdrawn} {
+		_, err = s.UpdateBookCopyStatus(ctx, model.BookCopyUpdateStatus{Barcode: "LOAN-1", Status: status})
+		assert.Equal(t, apperror.Conflict, apperror.KindOf(err), status)
+	}
+
+	bookCopy, err := copies.GetBookCopyByBarcode(ctx, "LOAN-1")
+	require.NoError(t, err)
+	assert.Equal(t, model.CopyStatusOnLoan, bookCopy.Status)
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/catalog"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/validation"
+	"go.uber.org/zap"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	_importRowTimeout = 5 * time.Second
+	_importJobTTL     = 24 * time.Hour
+)
+
+var ErrImportJobNotFound = apperror.New(apperror.NotFound, "import job not found")
+
+type BookImportService struct {
+	// ctx and wg are the ones of the server, the jobs stop when it shuts down and it waits for them
+	ctx  context.Context
+	wg   *sync.WaitGroup
+	book IBookStorage
+	log  *zap.Logger
+	mu   sync.RWMutex
+	jobs map[string]*model.ImportJob
+}
+
+func NewBookImportService(ctx context.Context, wg *sync.WaitGroup, log *zap.Logger, book IBookStorage) *BookImportService {
+	return &BookImportService{ctx: ctx, wg: wg, book: book, log: log, jobs: make(map[string]*model.ImportJob)}
+}
+
+// ImportBooks checks the upload header and starts a background job that upserts every record by ISBN.
+// The job owns src and closes it when done, a job cut short by the shutdown is reported failed.
+func (s *BookImportService) ImportBooks(format string, src io.ReadCloser) (model.ImportJob, error) {
+	reader, err := catalog.NewReader(format, src)
+	if err != nil {
+		src.Close()
+		return model.ImportJob{}, invalidData(err.Error())
+	}
+
+	job := &model.ImportJob{
+		ID:        uuid.NewString(),
+		Format:    strings.ToLower(format),
+		Status:    model.ImportStatusPending,
+		Rows:      []model.ImportRow{},
+		StartedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	s.evictJobs()
+	s.jobs[job.ID] = job
+	snapshot := *job
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer src.Close()
+		s.runImport(job, reader)
+	}()
+
+	return snapshot, nil
+}
+
+func (s *BookImportService) GetImportJob(jobID string) (model.ImportJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return model.ImportJob{}, ErrImportJobNotFound
+	}
+
+	snapshot := *job
+	snapshot.Rows = append([]model.ImportRow(nil), job.Rows...)
+
+	return snapshot, nil
+}
+
+func (s *BookImportService) runImport(job *model.ImportJob, reader catalog.Reader) {
+	s.setStatus(job, model.ImportStatusRunning, "")
+
+	for {
+		if err := s.ctx.Err(); err != nil {
+			s.log.Warn("Import books canceled", zap.String("job", job.ID), zap.Error(err))
+			s.setStatus(job, model.ImportStatusFailed, "import canceled: server is shutting down")
+			return
+		}
+
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var rowErr *catalog.RowError
+		if errors.As(err, &rowErr) {
+			s.addRow(job, model.ImportRow{Line: rowErr.Line, Result: model.ImportRowRejected, Reason: rowErr.Err.Error()})
+			continue
+		}
+
+		if err != nil {
+			s.log.Error("Import books error", zap.String("job", job.ID), zap.Error(err))
+			s.setStatus(job, model.ImportStatusFailed, err.Error())
+			return
+		}
+
+		s.addRow(job, s.importRow(row))
+	}
+
+	s.setStatus(job, model.ImportStatusDone, "")
+
+	report, _ := s.GetImportJob(job.ID)
+	s.log.Info("Import books finished", zap.String("job", job.ID),
+		zap.Int("created", report.Created), zap.Int("updated", report.Updated), zap.Int("rejected", report.Rejected))
+}
+
+func (s *BookImportService) importRow(row catalog.Row) model.ImportRow {
+	result := model.ImportRow{Line: row.Line, ISBN: row.Book.ISBN, Result: model.ImportRowRejected}
+
+	book, err := validateImportedBook(row.Book)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+
+	result.ISBN = book.ISBN
+
+	ctx, cancel := context.WithTimeout(s.ctx, _importRowTimeout)
+	defer cancel()
+
+	bookID, created, err := s.book.UpsertBookByISBN(ctx, book)
+	if err != nil {
+		s.log.Error("Upsert book error", zap.Int("line", row.Line), zap.Error(err))
+		result.Reason = "couldn't save book"
+		return result
+	}
+
+	result.BookID = bookID
+	result.Result = model.ImportRowUpdated
+	if created {
+		result.Result = model.ImportRowCreated
+	}
+
+	return result
+}
+
+func validateImportedBook(book model.Book) (model.Book, error) {
+	book = normalizeBook(book)
+
+	v := validation.New()
+	v.Check(book.ISBN != "", "isbn", "is required")
+	v.Struct(book)
+
+	return book, v.Err()
+}
+
+func (s *BookImportService) addRow(job *model.ImportJob, row model.ImportRow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch row.Result {
+	case model.ImportRowCreated:
+		job.Created++
+	case model.ImportRowUpdated:
+		job.Updated++
+	default:
+		job.Rejected++
+	}
+
+	job.Rows = append(job.Rows, row)
+}
+
+func (s *BookImportService) setStatus(job *model.ImportJob, status, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job.Status = status
+	job.Error = reason
+
+	if status == model.ImportStatusDone || status == model.ImportStatusFailed {
+		finishedAt := time.Now()
+		job.FinishedAt = &finishedAt
+	}
+}
+
+// evictJobs forgets reports of jobs finished more than a day ago, s.mu must be held.
+func (s *BookImportService) evictJobs() {
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > _importJobTTL {
+			delete(s.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/storage/inmemory"
+	"go.uber.org/zap"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestBookImportService_ImportBooks_StopsOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	s := NewBookImportService(ctx, &wg, zap.NewNop(), inmemory.NewBookStorage(inmemory.New()))
+
+	// the server is shutting down already when the job gets to run
+	cancel()
+
+	src := &closeTracker{Reader: strings.NewReader("isbn,title,author,price\n9780306406157,Title,Author,10\n")}
+	job, err := s.ImportBooks("csv", src)
+	require.NoError(t, err)
+
+	wg.Wait()
+	assert.True(t, src.closed, "the upload is closed before the server stops waiting")
+
+	report, err := s.GetImportJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ImportStatusFailed, report.Status)
+	assert.Zero(t, report.Created)
+}
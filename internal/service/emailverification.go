@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/tracing"
+	"github.com/zhayt/user-storage-service/internal/validation"
+	"github.com/zhayt/user-storage-service/logger"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	_emailVerificationTTL = 48 * time.Hour
+	// _emailVerificationResendInterval is how often a user may ask for one more verification email.
+	_emailVerificationResendInterval = time.Minute
+)
+
+var ErrEmailNotVerified = apperror.New(apperror.Forbidden, "email is not verified")
+
+type IEmailVerificationStorage interface {
+	CountEmailVerificationTokens(ctx context.Context, userID int, within time.Duration) (int, error)
+	CreateEmailVerificationToken(ctx context.Context, token model.EmailVerificationToken, email model.OutboxEmail) error
+	VerifyEmail(ctx context.Context, tokenHash string) (int, error)
+}
+
+type EmailVerificationService struct {
+	user      IUserStorage
+	verify    IEmailVerificationStorage
+	verifyURL string
+	log       *zap.Logger
+}
+
+func NewEmailVerificationService(log *zap.Logger, verifyURL string, user IUserStorage, verify IEmailVerificationStorage) *EmailVerificationService {
+	return &EmailVerificationService{user: user, verify: verify, verifyURL: verifyURL, log: log}
+}
+
+// SendVerification queues an email with a one-time link which confirms the address of the user.
+func (s *EmailVerificationService) SendVerification(ctx context.Context, user model.User) error {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.SendVerification")
+	defer span.End()
+
+	token, err := newOneTimeToken()
+	if err != nil {
+		return err
+	}
+
+	email := model.OutboxEmail{
+		Recipient: user.Email,
+		Subject:   "Confirm your email",
+		Body: fmt.Sprintf("Hello, %s!\n\nTo confirm your email follow the link below, it is valid for %v.\n\n%s%s\n\n"+
+			"If you did not sign up just ignore this email.\n", user.FIO, _emailVerificationTTL, s.verifyURL, token),
+	}
+
+	return s.verify.CreateEmailVerificationToken(ctx, model.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: hashOneTimeToken(token),
+		TTL:       _emailVerificationTTL,
+	}, email)
+}
+
+// ResendVerification sends a fresh link at most once per _emailVerificationResendInterval.
+// Unknown, already verified and throttled emails are not reported, so the caller can't probe accounts.
+func (s *EmailVerificationService) ResendVerification(ctx context.Context, resend model.EmailVerificationResend) error {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.ResendVerification")
+	defer span.End()
+
+	if err := validation.Struct(resend); err != nil {
+		return err
+	}
+
+	user, err := s.user.GetUserByEmail(ctx, resend.Email)
+	if err != nil {
+		if apperror.KindOf(err) == apperror.NotFound {
+			logger.FromContext(ctx, s.log).Info("Email verification for unknown email")
+			return nil
+		}
+		return err
+	}
+
+	if user.EmailVerified() {
+		return nil
+	}
+
+	recent, err := s.verify.CountEmailVerificationTokens(ctx, user.ID, _emailVerificationResendInterval)
+	if err != nil {
+		return err
+	}
+
+	if recent > 0 {
+		logger.FromContext(ctx, s.log).Info("Email verification resend throttled", zap.Int("id", user.ID))
+		return nil
+	}
+
+	return s.SendVerification(ctx, user)
+}
+
+// VerifyEmail spends the token and marks the email verified, it returns the id of the user.
+func (s *EmailVerificationService) VerifyEmail(ctx context.Context, token string) (int, error) {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.VerifyEmail")
+	defer span.End()
+
+	if token == "" {
+		return 0, apperror.Invalid(apperror.Violation{Field: "token", Message: "is required"})
+	}
+
+	userID, err := s.verify.VerifyEmail(ctx, hashOneTimeToken(token))
+	if err != nil {
+		if apperror.KindOf(err) == apperror.NotFound {
+			return 0, apperror.Invalid(apperror.Violation{Field: "token", Message: "is invalid or expired"})
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
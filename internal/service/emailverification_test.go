@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/service/mocks"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+	"time"
+)
+
+// verificationStorage keeps the issued tokens in memory.
+type verificationStorage struct {
+	tokens []model.EmailVerificationToken
+	emails []model.OutboxEmail
+	used   map[string]bool
+}
+
+// CountEmailVerificationTokens counts every token of the user, the test runs well within any interval.
+func (r *verificationStorage) CountEmailVerificationTokens(_ context.Context, userID int, _ time.Duration) (int, error) {
+	var count int
+	for _, token := range r.tokens {
+		if token.UserID == userID {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r *verificationStorage) CreateEmailVerificationToken(_ context.Context, token model.EmailVerificationToken, email model.OutboxEmail) error {
+	r.tokens = append(r.tokens, token)
+	r.emails = append(r.emails, email)
+	return nil
+}
+
+func (r *verificationStorage) VerifyEmail(_ context.Context, tokenHash string) (int, error) {
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash && !r.used[tokenHash] {
+			r.used[tokenHash] = true
+			return token.UserID, nil
+		}
+	}
+
+	return 0, fmt.Errorf("couldn't use email verification token: %w",
+		apperror.New(apperror.NotFound, "email verification token not found"))
+}
+
+func TestEmailVerificationService_SendAndVerify(t *testing.T) {
+	verify := &verificationStorage{used: map[string]bool{}}
+	s := NewEmailVerificationService(zap.NewNop(), "http://localhost/verify?token=", mocks.NewIUserStorage(t), verify)
+
+	err := s.SendVerification(context.Background(), model.User{ID: 3, FIO: "Reader", Email: "reader@mail.ru"})
+	assert.NoError(t, err)
+	if !assert.Len(t, verify.emails, 1) {
+		return
+	}
+
+	body := verify.emails[0].Body
+	token := strings.Fields(body[strings.Index(body, "token=")+len("token="):])[0]
+	assert.Equal(t, hashOneTimeToken(token), verify.tokens[0].TokenHash)
+
+	userID, err := s.VerifyEmail(context.Background(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, userID)
+
+	_, err = s.VerifyEmail(context.Background(), token)
+	assert.Equal(t, []apperror.Violation{{Field: "token", Message: "is invalid or expired"}}, apperror.Violations(err))
+}
+
+func TestEmailVerificationService_ResendVerification(t *testing.T) {
+	verifiedAt := time.Now()
+
+	userStorage := mocks.NewIUserStorage(t)
+	userStorage.On("GetUserByEmail", mock.Anything, "new@mail.ru").
+		Return(model.User{ID: 1, Email: "new@mail.ru"}, nil)
+	userStorage.On("GetUserByEmail", mock.Anything, "verified@mail.ru").
+		Return(model.User{ID: 2, Email: "verified@mail.ru", EmailVerifiedAt: &verifiedAt}, nil)
+	userStorage.On("GetUserByEmail", mock.Anything, "nobody@mail.ru").
+		Return(model.User{}, apperror.New(apperror.NotFound, "user not found"))
+
+	verify := &verificationStorage{used: map[string]bool{}}
+	s := NewEmailVerificationService(zap.NewNop(), "", userStorage, verify)
+
+	for _, email := range []string{"new@mail.ru", "new@mail.ru", "verified@mail.ru", "nobody@mail.ru"} {
+		assert.NoError(t, s.ResendVerification(context.Background(), model.EmailVerificationResend{Email: email}))
+	}
+
+	// the second request for new@mail.ru is throttled, the others have nothing to send
+	assert.Len(t, verify.emails, 1)
+}
@@ -2,44 +2,92 @@ package service
 
 import (
 	"context"
+	"github.com/zhayt/user-storage-service/config"
+	"github.com/zhayt/user-storage-service/internal/loginguard"
 	"github.com/zhayt/user-storage-service/internal/model"
 	"github.com/zhayt/user-storage-service/internal/storage"
 	"go.uber.org/zap"
+	"io"
+	"sync"
 )
 
 type IUserService interface {
 	GetUserByID(ctx context.Context, userId int) (model.User, error)
 	GetUserByEmail(ctx context.Context, login model.UserLogin) (model.User, error)
 	CreateUser(ctx context.Context, user model.User) (int, error)
-	UpdateUserFIO(ctx context.Context, user model.UserUpdateFIO) (int, error)
+	PatchUserFIO(ctx context.Context, userID, version int, patch model.Patch) (model.User, error)
 	UpdateUserPassword(ctx context.Context, userUP model.UserUpdatePassword) (int, error)
 	DeleteUser(ctx context.Context, userId int) error
+	RestoreUser(ctx context.Context, userId int) (int, error)
 }
 
 type IBookService interface {
 	CreateBook(ctx context.Context, book model.Book) (int, error)
 	GetBookByID(ctx context.Context, bookId int) (model.Book, error)
 	GetAllBooks(ctx context.Context) ([]model.Book, error)
-	UpdateBook(ctx context.Context, book model.Book) (int, error)
+	IterateBooks(ctx context.Context, fn func(model.Book) error) error
+	PatchBook(ctx context.Context, bookID, version int, patch model.Patch) (model.Book, error)
 	DeleteBook(ctx context.Context, bookId int) error
+	RestoreBook(ctx context.Context, bookId int) (int, error)
+}
+
+type IBookImportService interface {
+	ImportBooks(format string, src io.ReadCloser) (model.ImportJob, error)
+	GetImportJob(jobID string) (model.ImportJob, error)
+}
+
+type IBookCopyService interface {
+	CreateBookCopy(ctx context.Context, bookCopy model.BookCopy) (int, error)
+	GetBookCopyByBarcode(ctx context.Context, barcode string) (model.BookCopy, error)
+	GetBookCopies(ctx context.Context, bookID int) ([]model.BookCopy, error)
+	UpdateBookCopyStatus(ctx context.Context, bookCopy model.BookCopyUpdateStatus) (int, error)
+	CheckoutBookCopy(ctx context.Context, checkout model.Checkout) (int, error)
+	CheckinBookCopy(ctx context.Context, checkin model.Checkin) (int, error)
+}
+
+type IPasswordResetService interface {
+	ForgotPassword(ctx context.Context, forgot model.PasswordForgot) error
+	ResetPassword(ctx context.Context, reset model.PasswordReset) (int, error)
+}
+
+type IEmailVerificationService interface {
+	ResendVerification(ctx context.Context, resend model.EmailVerificationResend) error
+	VerifyEmail(ctx context.Context, token string) (int, error)
 }
 
 type IRentTransactionService interface {
 	RentBook(ctx context.Context, history model.BIHistory) error
 }
 
+// ITxManager runs several store calls as one unit of work. The stores called with the context fn gets
+// take part in it, an error returned by fn undoes all of them.
+type ITxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 type Service struct {
 	IUserService
 	IBookService
+	IBookImportService
 	IBIHistoryService
+	IBookCopyService
 	IRentTransactionService
+	IPasswordResetService
+	IEmailVerificationService
 }
 
-func NewService(logger *zap.Logger, storage *storage.Storage) *Service {
+// NewService builds the services, ctx and wg are the lifecycle of the server the background jobs are bound to.
+func NewService(ctx context.Context, wg *sync.WaitGroup, logger *zap.Logger, cfg *config.Config, storage *storage.Storage, guard *loginguard.Guard) *Service {
+	verification := NewEmailVerificationService(logger, cfg.EmailVerifyURL, storage, storage)
+
 	return &Service{
-		IUserService:            NewUserService(logger, storage),
-		IBookService:            NewBookService(logger, storage),
-		IBIHistoryService:       NewBIHistory(logger, storage),
-		IRentTransactionService: NewRentTransactionService(logger, storage),
+		IUserService:              NewUserService(logger, storage, storage, verification, guard),
+		IBookService:              NewBookService(logger, storage, storage),
+		IBookImportService:        NewBookImportService(ctx, wg, logger, storage),
+		IBIHistoryService:         NewBIHistory(logger, storage),
+		IBookCopyService:          NewBookCopyService(logger, storage, storage, storage),
+		IRentTransactionService:   NewRentTransactionService(logger, cfg.TransactionServiceURL, storage),
+		IPasswordResetService:     NewPasswordResetService(logger, cfg.PasswordResetURL, storage, storage),
+		IEmailVerificationService: verification,
 	}
 }
@@ -100,6 +100,30 @@ func (_m *IUserStorage) GetUserByID(ctx context.Context, userID int) (model.User
 	return r0, r1
 }
 
+// RestoreUser provides a mock function with given fields: ctx, userID
+func (_m *IUserStorage) RestoreUser(ctx context.Context, userID int) (int, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int) (int, error)); ok {
+		return rf(ctx, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int) int); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UpdateUserFIO provides a mock function with given fields: ctx, user
 func (_m *IUserStorage) UpdateUserFIO(ctx context.Context, user model.UserUpdateFIO) (int, error) {
 	ret := _m.Called(ctx, user)
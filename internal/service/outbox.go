@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"github.com/zhayt/user-storage-service/internal/mailer"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	_outboxInterval    = 5 * time.Second
+	_outboxBatch       = 20
+	_outboxMaxAttempts = 5
+	_outboxSendTimeout = 30 * time.Second
+	// _outboxLease is how long a batch is claimed, enough to send all of it.
+	_outboxLease = _outboxBatch * _outboxSendTimeout
+	// _outboxRetention is how long the sent emails are kept, without their bodies, for troubleshooting.
+	_outboxRetention = 24 * time.Hour
+)
+
+type IOutboxStorage interface {
+	ClaimPendingEmails(ctx context.Context, maxAttempts, limit int, lease time.Duration) ([]model.OutboxEmail, error)
+	MarkEmailSent(ctx context.Context, emailID int) error
+	MarkEmailFailed(ctx context.Context, emailID int, reason string) error
+	PurgeEmails(ctx context.Context, maxAttempts int, retention time.Duration) (int64, error)
+}
+
+// OutboxDispatcher sends the queued emails. The emails are written in the same transaction
+// as the data they belong to, so a mail server being down never fails a request. Every replica
+// runs one, each batch is claimed first so no email is sent twice.
+type OutboxDispatcher struct {
+	outbox IOutboxStorage
+	mail   mailer.Mailer
+	log    *zap.Logger
+}
+
+func NewOutboxDispatcher(log *zap.Logger, outbox IOutboxStorage, mail mailer.Mailer) *OutboxDispatcher {
+	return &OutboxDispatcher{outbox: outbox, mail: mail, log: log}
+}
+
+// Run polls the outbox until ctx is done.
+func (d *OutboxDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(_outboxInterval)
+	defer ticker.Stop()
+
+	for {
+		d.Dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch sends one batch of pending emails. Failed emails stay queued until they run out of attempts,
+// then they are purged along with the old sent ones: the bodies hold one-time links.
+func (d *OutboxDispatcher) Dispatch(ctx context.Context) {
+	defer d.purge(ctx)
+
+	emails, err := d.outbox.ClaimPendingEmails(ctx, _outboxMaxAttempts, _outboxBatch, _outboxLease)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.log.Error("Claim pending emails error", zap.Error(err))
+		}
+		return
+	}
+
+	for _, email := range emails {
+		if ctx.Err() != nil {
+			return
+		}
+
+		d.send(ctx, email)
+	}
+}
+
+func (d *OutboxDispatcher) send(ctx context.Context, email model.OutboxEmail) {
+	sendCtx, cancel := context.WithTimeout(ctx, _outboxSendTimeout)
+	defer cancel()
+
+	err := d.mail.Send(sendCtx, mailer.Message{To: email.Recipient, Subject: email.Subject, Body: email.Body})
+	if err != nil {
+		d.log.Error("Send email error", zap.Int("id", email.ID), zap.Int("attempt", email.Attempts+1), zap.Error(err))
+		if err = d.outbox.MarkEmailFailed(ctx, email.ID, err.Error()); err != nil {
+			d.log.Error("Mark email failed error", zap.Int("id", email.ID), zap.Error(err))
+		}
+		return
+	}
+
+	if err = d.outbox.MarkEmailSent(ctx, email.ID); err != nil {
+		d.log.Error("Mark email sent error", zap.Int("id", email.ID), zap.Error(err))
+	}
+}
+
+func (d *OutboxDispatcher) purge(ctx context.Context) {
+	purged, err := d.outbox.PurgeEmails(ctx, _outboxMaxAttempts, _outboxRetention)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.log.Error("Purge emails error", zap.Error(err))
+		}
+		return
+	}
+
+	if purged > 0 {
+		d.log.Info("Emails purged", zap.Int64("count", purged))
+	}
+}
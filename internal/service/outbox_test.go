@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zhayt/user-storage-service/internal/mailer"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/storage/inmemory"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+type fakeMailer struct {
+	sent []mailer.Message
+	err  error
+}
+
+func (m *fakeMailer) Send(_ context.Context, msg mailer.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestOutboxDispatcher_Dispatch_LeavesNoLinks(t *testing.T) {
+	ctx := context.Background()
+	db := inmemory.New()
+	users, resets, outbox := inmemory.NewUserStorage(db), inmemory.NewPasswordResetStorage(db), inmemory.NewOutboxStorage(db)
+
+	userID, err := users.CreateUser(ctx, model.User{FIO: "Aybek", Email: "reader@mail.ru", Password: "hash", Role: model.RoleReader})
+	require.NoError(t, err)
+	for _, hash := range []string{"sent", "failed"} {
+		require.NoError(t, resets.CreatePasswordResetToken(ctx,
+			model.PasswordResetToken{UserID: userID, TokenHash: hash, TTL: time.Hour},
+			model.OutboxEmail{Recipient: "reader@mail.ru", Subject: "Password reset", Body: "https://example.com/reset?token=" + hash}))
+	}
+
+	mail := &fakeMailer{}
+	d := NewOutboxDispatcher(zap.NewNop(), outbox, mail)
+
+	// the first email goes out, the second fails until it runs out of attempts
+	pending, err := outbox.ClaimPendingEmails(ctx, _outboxMaxAttempts, 1, _outboxLease)
+	require.NoError(t, err)
+	d.send(ctx, pending[0])
+	require.Len(t, mail.sent, 1)
+
+	mail.err = errors.New("mailbox is full")
+	for i := 0; i < _outboxMaxAttempts; i++ {
+		d.Dispatch(ctx)
+	}
+
+	pending, err = outbox.ClaimPendingEmails(ctx, _outboxMaxAttempts, 10, _outboxLease)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	purged, err := outbox.PurgeEmails(ctx, _outboxMaxAttempts, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged, "the failed email was purged by Dispatch, the sent one is left")
+}
+
+func TestOutboxStorage_ClaimPendingEmails_OnlyOnce(t *testing.T) {
+	ctx := context.Background()
+	db := inmemory.New()
+	users, resets, outbox := inmemory.NewUserStorage(db), inmemory.NewPasswordResetStorage(db), inmemory.NewOutboxStorage(db)
+
+	userID, err := users.CreateUser(ctx, model.User{FIO: "Aybek", Email: "reader@mail.ru", Password: "hash", Role: model.RoleReader})
+	require.NoError(t, err)
+	require.NoError(t, resets.CreatePasswordResetToken(ctx,
+		model.PasswordResetToken{UserID: userID, TokenHash: "hash", TTL: time.Hour},
+		model.OutboxEmail{Recipient: "reader@mail.ru", Subject: "Password reset", Body: "link"}))
+
+	first, err := outbox.ClaimPendingEmails(ctx, _outboxMaxAttempts, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+
+	second, err := outbox.ClaimPendingEmails(ctx, _outboxMaxAttempts, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, second, "another dispatcher must not get a claimed email")
+
+	require.NoError(t, outbox.MarkEmailFailed(ctx, first[0].ID, "mailbox is full"))
+	again, err := outbox.ClaimPendingEmails(ctx, _outboxMaxAttempts, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, again, 1, "a failed email is claimable again")
+}
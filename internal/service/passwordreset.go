@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/tracing"
+	"github.com/zhayt/user-storage-service/internal/validation"
+	"github.com/zhayt/user-storage-service/logger"
+	"go.uber.org/zap"
+	"time"
+)
+
+const _passwordResetTTL = time.Hour
+
+type IPasswordResetStorage interface {
+	CreatePasswordResetToken(ctx context.Context, token model.PasswordResetToken, email model.OutboxEmail) error
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error)
+}
+
+type PasswordResetService struct {
+	user     IUserStorage
+	reset    IPasswordResetStorage
+	resetURL string
+	log      *zap.Logger
+}
+
+func NewPasswordResetService(log *zap.Logger, resetURL string, user IUserStorage, reset IPasswordResetStorage) *PasswordResetService {
+	return &PasswordResetService{user: user, reset: reset, resetURL: resetURL, log: log}
+}
+
+// ForgotPassword queues an email with a one-time reset link. Unknown emails are not reported,
+// the caller must not learn which accounts exist.
+func (s *PasswordResetService) ForgotPassword(ctx context.Context, forgot model.PasswordForgot) error {
+	ctx, span := tracing.Start(ctx, "PasswordResetService.ForgotPassword")
+	defer span.End()
+
+	if err := validation.Struct(forgot); err != nil {
+		return err
+	}
+
+	user, err := s.user.GetUserByEmail(ctx, forgot.Email)
+	if err != nil {
+		if apperror.KindOf(err) == apperror.NotFound {
+			logger.FromContext(ctx, s.log).Info("Password reset for unknown email")
+			return nil
+		}
+		return err
+	}
+
+	token, err := newOneTimeToken()
+	if err != nil {
+		return err
+	}
+
+	email := model.OutboxEmail{
+		Recipient: user.Email,
+		Subject:   "Password reset",
+		Body: fmt.Sprintf("Hello, %s!\n\nTo set a new password follow the link below, it is valid for %v.\n\n%s%s\n\n"+
+			"If you did not ask for it just ignore this email.\n", user.FIO, _passwordResetTTL, s.resetURL, token),
+	}
+
+	return s.reset.CreatePasswordResetToken(ctx, model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashOneTimeToken(token),
+		TTL:       _passwordResetTTL,
+	}, email)
+}
+
+// ResetPassword spends the token and sets the new password, it returns the id of the user.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, reset model.PasswordReset) (int, error) {
+	ctx, span := tracing.Start(ctx, "PasswordResetService.ResetPassword")
+	defer span.End()
+
+	v := validation.New()
+	v.Struct(reset)
+	v.Check(reset.NewPassword == reset.NewPasswordRepeat, "newPasswordRepeat", "must match newPassword")
+	if err := v.Err(); err != nil {
+		return 0, err
+	}
+
+	passwdHash, err := generatePasswordHash(reset.NewPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	userID, err := s.reset.ResetPassword(ctx, hashOneTimeToken(reset.Token), passwdHash)
+	if err != nil {
+		if apperror.KindOf(err) == apperror.NotFound {
+			return 0, apperror.Invalid(apperror.Violation{Field: "token", Message: "is invalid or expired"})
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/service/mocks"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+)
+
+// resetStorage keeps the last queued token in memory.
+type resetStorage struct {
+	token model.PasswordResetToken
+	email model.OutboxEmail
+	used  bool
+}
+
+func (r *resetStorage) CreatePasswordResetToken(_ context.Context, token model.PasswordResetToken, email model.OutboxEmail) error {
+	r.token, r.email, r.used = token, email, false
+	return nil
+}
+
+func (r *resetStorage) ResetPassword(_ context.Context, tokenHash, _ string) (int, error) {
+	if r.used || tokenHash != r.token.TokenHash {
+		return 0, fmt.Errorf("couldn't use password reset token: %w",
+			apperror.New(apperror.NotFound, "password reset token not found"))
+	}
+
+	r.used = true
+	return r.token.UserID, nil
+}
+
+func TestPasswordResetService_ForgotAndReset(t *testing.T) {
+	userStorage := mocks.NewIUserStorage(t)
+	userStorage.On("GetUserByEmail", mock.Anything, "reader@mail.ru").
+		Return(model.User{ID: 7, FIO: "Reader", Email: "reader@mail.ru"}, nil)
+
+	reset := &resetStorage{}
+	s := NewPasswordResetService(zap.NewNop(), "http://localhost/reset?token=", userStorage, reset)
+
+	err := s.ForgotPassword(context.Background(), model.PasswordForgot{Email: "reader@mail.ru"})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, reset.token.UserID)
+	assert.Equal(t, "reader@mail.ru", reset.email.Recipient)
+
+	i := strings.Index(reset.email.Body, "token=")
+	if !assert.NotEqual(t, -1, i) {
+		return
+	}
+	token := strings.Fields(reset.email.Body[i+len("token="):])[0]
+
+	assert.NotEqual(t, token, reset.token.TokenHash, "only the hash of the token is stored")
+	assert.Equal(t, hashOneTimeToken(token), reset.token.TokenHash)
+
+	req := model.PasswordReset{Token: token, NewPassword: "newpass", NewPasswordRepeat: "newpass"}
+
+	userID, err := s.ResetPassword(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, userID)
+
+	_, err = s.ResetPassword(context.Background(), req)
+	assert.Equal(t, apperror.Validation, apperror.KindOf(err), "token works once")
+	assert.Equal(t, []apperror.Violation{{Field: "token", Message: "is invalid or expired"}}, apperror.Violations(err))
+}
+
+func TestPasswordResetService_ForgotUnknownEmail(t *testing.T) {
+	userStorage := mocks.NewIUserStorage(t)
+	userStorage.On("GetUserByEmail", mock.Anything, "nobody@mail.ru").
+		Return(model.User{}, apperror.New(apperror.NotFound, "user not found"))
+
+	reset := &resetStorage{}
+	s := NewPasswordResetService(zap.NewNop(), "", userStorage, reset)
+
+	assert.NoError(t, s.ForgotPassword(context.Background(), model.PasswordForgot{Email: "nobody@mail.ru"}))
+	assert.Empty(t, reset.email.Recipient)
+}
+
+func TestPasswordResetService_ResetPasswordMismatch(t *testing.T) {
+	s := NewPasswordResetService(zap.NewNop(), "", mocks.NewIUserStorage(t), &resetStorage{})
+
+	_, err := s.ResetPassword(context.Background(), model.PasswordReset{Token: "t", NewPassword: "newpass", NewPasswordRepeat: "other"})
+	assert.Equal(t, apperror.Validation, apperror.KindOf(err))
+}
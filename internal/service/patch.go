@@ -0,0 +1,58 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/zhayt/user-storage-service/internal/model"
+)
+
+// bookDocument holds the book fields a client is allowed to patch.
+type bookDocument struct {
+	Title  string  `json:"title"`
+	Author string  `json:"author"`
+	Price  float64 `json:"price"`
+	ISBN   string  `json:"isbn"`
+}
+
+// profileDocument holds the user fields a client is allowed to patch.
+type profileDocument struct {
+	FIO string `json:"fio"`
+}
+
+// applyPatch applies the patch to the JSON form of doc and decodes the result into a new document,
+// so members removed by the patch come back as zero values.
+// Unknown fields and wrong types in the result are reported as ErrInvalidData.
+func applyPatch[T any](doc T, patch model.Patch) (T, error) {
+	var result T
+
+	original, err := json.Marshal(doc)
+	if err != nil {
+		return result, fmt.Errorf("couldn't encode document: %w", err)
+	}
+
+	var patched []byte
+	switch patch.Type {
+	case model.PatchMerge:
+		patched, err = jsonpatch.MergePatch(original, patch.Body)
+	case model.PatchJSON:
+		var ops jsonpatch.Patch
+		if ops, err = jsonpatch.DecodePatch(patch.Body); err == nil {
+			patched, err = ops.Apply(original)
+		}
+	default:
+		return result, invalidData(fmt.Sprintf("unsupported patch type %q", patch.Type))
+	}
+	if err != nil {
+		return result, invalidData(err.Error())
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&result); err != nil {
+		return result, invalidData(err.Error())
+	}
+
+	return result, nil
+}
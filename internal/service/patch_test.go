@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/storage/inmemory"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestApplyPatchTableDriven(t *testing.T) {
+	doc := bookDocument{Title: "Dune", Author: "Frank Herbert", Price: 10, ISBN: "9780441013593"}
+
+	tests := []struct {
+		name    string
+		patch   model.Patch
+		want    bookDocument
+		wantErr bool
+	}{
+		{"Merge keeps missing fields", model.Patch{Type: model.PatchMerge, Body: []byte(`{"price":12.5}`)},
+			bookDocument{Title: "Dune", Author: "Frank Herbert", Price: 12.5, ISBN: "9780441013593"}, false},
+		{"Merge null removes field", model.Patch{Type: model.PatchMerge, Body: []byte(`{"isbn":null}`)},
+			bookDocument{Title: "Dune", Author: "Frank Herbert", Price: 10}, false},
+		{"Merge unknown field", model.Patch{Type: model.PatchMerge, Body: []byte(`{"name":"Dune"}`)}, bookDocument{}, true},
+		{"Merge wrong type", model.Patch{Type: model.PatchMerge, Body: []byte(`{"price":"free"}`)}, bookDocument{}, true},
+		{"JSON Patch replace", model.Patch{Type: model.PatchJSON, Body: []byte(`[{"op":"replace","path":"/title","value":"Dune Messiah"}]`)},
+			bookDocument{Title: "Dune Messiah", Author: "Frank Herbert", Price: 10, ISBN: "9780441013593"}, false},
+		{"JSON Patch failed test", model.Patch{Type: model.PatchJSON, Body: []byte(`[{"op":"test","path":"/title","value":"Emma"}]`)},
+			bookDocument{}, true},
+		{"JSON Patch malformed", model.Patch{Type: model.PatchJSON, Body: []byte(`{"op":"remove"}`)}, bookDocument{}, true},
+		{"Unsupported type", model.Patch{Type: "application/xml", Body: []byte(`<book/>`)}, bookDocument{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyPatch(doc, tt.patch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidData) {
+				t.Errorf("applyPatch() error = %v, want ErrInvalidData", err)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("applyPatch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBookService_PatchBook_Version(t *testing.T) {
+	ctx := context.Background()
+	db := inmemory.New()
+	books := inmemory.NewBookStorage(db)
+
+	bookID, err := books.CreateBook(ctx, model.Book{Title: "Dune", Author: "Frank Herbert", Price: 10})
+	require.NoError(t, err)
+
+	s := NewBookService(zap.NewNop(), inmemory.NewTxManager(db), books)
+	patch := model.Patch{Type: model.PatchMerge, Body: []byte(`{"price":12.5}`)}
+
+	for _, version := range []int{0, 2} {
+		_, err = s.PatchBook(ctx, bookID, version, patch)
+		assert.ErrorIs(t, err, ErrVersionMismatch, version)
+	}
+
+	book, err := s.PatchBook(ctx, bookID, 1, patch)
+	require.NoError(t, err)
+	assert.Equal(t, 12.5, book.Price)
+	assert.Equal(t, 2, book.Version)
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// newOneTimeToken returns a random token to be mailed to the user.
+func newOneTimeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("can't generate token: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// hashOneTimeToken is what gets stored, a leaked table does not let anyone use the tokens.
+func hashOneTimeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,40 +2,81 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/zhayt/user-storage-service/internal/metrics"
 	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/semconv/v1.17.0/httpconv"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Transaction struct {
+	healthURL      string
 	transactionURL string
 	itemURL        string
 	deleteURL      string
 	log            *zap.Logger
 }
 
-func NewTransaction(log *zap.Logger) *Transaction {
+// NewTransaction talks to the transaction service at baseURL, like http://localhost:8081.
+func NewTransaction(log *zap.Logger, baseURL string) *Transaction {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
 	return &Transaction{
-		transactionURL: "http://localhost:8081/api/v1/transactions",
-		itemURL:        "http://localhost:8081/api/v1/transactions/items",
-		deleteURL:      "http://localhost:8081/api/v1/transactions/",
+		healthURL:      baseURL + "/",
+		transactionURL: baseURL + "/api/v1/transactions",
+		itemURL:        baseURL + "/api/v1/transactions/items",
+		deleteURL:      baseURL + "/api/v1/transactions/",
 		log:            log}
 }
 
-func (s *Transaction) CreateTransaction(transaction model.Transaction) (int, error) {
+// Health reports whether the transaction service answers. It has no health route of its own,
+// so any answer below 500 counts.
+func (s *Transaction) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.healthURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("transaction service is unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("transaction service answers %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (s *Transaction) CreateTransaction(ctx context.Context, transaction model.Transaction) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "Transaction.CreateTransaction", trace.WithSpanKind(trace.SpanKindClient))
+	defer func(start time.Time) {
+		metrics.ObserveTransaction("create_transaction", start, err)
+		tracing.End(span, err)
+	}(time.Now())
+
 	jsonData, _ := json.Marshal(transaction)
 
-	req, err := prepareRequest(http.MethodPost, s.transactionURL, jsonData)
+	req, err := prepareRequest(ctx, http.MethodPost, s.transactionURL, jsonData)
 	if err != nil {
 		return 0, fmt.Errorf("pepare request error: %w", err)
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doRequest(ctx, req)
 	if err != nil {
 		return 0, fmt.Errorf("do request error: %w", err)
 	}
@@ -51,23 +92,32 @@ func (s *Transaction) CreateTransaction(transaction model.Transaction) (int, err
 
 		return transactionID, nil
 	} else {
+		discard(resp.Body)
 		return 0, errors.New("transaction service error")
 	}
 }
 
-func (s *Transaction) CreateTransactionItem(item model.TransactionItem) error {
+func (s *Transaction) CreateTransactionItem(ctx context.Context, item model.TransactionItem) (err error) {
+	ctx, span := tracing.Start(ctx, "Transaction.CreateTransactionItem", trace.WithSpanKind(trace.SpanKindClient))
+	defer func(start time.Time) {
+		metrics.ObserveTransaction("create_transaction_item", start, err)
+		tracing.End(span, err)
+	}(time.Now())
+
 	jsonData, _ := json.Marshal(item)
 
-	req, err := prepareRequest(http.MethodPost, s.itemURL, jsonData)
+	req, err := prepareRequest(ctx, http.MethodPost, s.itemURL, jsonData)
 	if err != nil {
 		return fmt.Errorf("pepare request error: %w", err)
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doRequest(ctx, req)
 	if err != nil {
 		return fmt.Errorf("do request error: %w", err)
 	}
+	defer resp.Body.Close()
+	// the answer is not needed, read it out so the connection goes back to the pool
+	discard(resp.Body)
 
 	if resp.StatusCode == http.StatusOK {
 		return nil
@@ -76,17 +126,25 @@ func (s *Transaction) CreateTransactionItem(item model.TransactionItem) error {
 	}
 }
 
-func (s *Transaction) DeleteTransaction(transactionID int) error {
-	req, err := prepareRequest(http.MethodDelete, s.deleteURL+strconv.Itoa(transactionID), []byte{})
+func (s *Transaction) DeleteTransaction(ctx context.Context, transactionID int) (err error) {
+	ctx, span := tracing.Start(ctx, "Transaction.DeleteTransaction", trace.WithSpanKind(trace.SpanKindClient))
+	defer func(start time.Time) {
+		metrics.ObserveTransaction("delete_transaction", start, err)
+		tracing.End(span, err)
+	}(time.Now())
+
+	req, err := prepareRequest(ctx, http.MethodDelete, s.deleteURL+strconv.Itoa(transactionID), []byte{})
 	if err != nil {
 		return fmt.Errorf("pepare request error: %w", err)
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doRequest(ctx, req)
 	if err != nil {
 		return fmt.Errorf("do request error: %w", err)
 	}
+	defer resp.Body.Close()
+	// the answer is not needed, read it out so the connection goes back to the pool
+	discard(resp.Body)
 
 	if resp.StatusCode == http.StatusOK {
 		return nil
@@ -95,13 +153,37 @@ func (s *Transaction) DeleteTransaction(transactionID int) error {
 	}
 }
 
-func prepareRequest(method string, url string, data []byte) (*http.Request, error) {
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
+// prepareRequest builds the request with the trace context of ctx in its headers,
+// so the transaction service can continue the trace.
+func prepareRequest(ctx context.Context, method string, url string, data []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	return req, nil
 }
+
+// discard reads body to the end, a response closed before it is not reused for the next request.
+func discard(body io.Reader) {
+	_, _ = io.Copy(io.Discard, body)
+}
+
+// doRequest sends the request and notes it and the response status on the span in ctx.
+func doRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(httpconv.ClientRequest(req)...)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(httpconv.ClientResponse(resp)...)
+
+	return resp, nil
+}
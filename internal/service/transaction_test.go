@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTransaction_PropagatesTraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("7"))
+	}))
+	defer srv.Close()
+
+	s := NewTransaction(zap.NewNop(), srv.URL)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "RentBook")
+	id, err := s.CreateTransaction(ctx, model.Transaction{UserName: "Aybek", Amount: 10})
+	parent.End()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 7, id)
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+
+	call := spans[0]
+	assert.Equal(t, "Transaction.CreateTransaction", call.Name())
+	assert.Equal(t, trace.SpanKindClient, call.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), call.Parent().SpanID())
+	assert.Contains(t, traceparent, call.SpanContext().TraceID().String(), "the service gets the trace of the call")
+	assert.Contains(t, traceparent, call.SpanContext().SpanID().String())
+
+	assert.Error(t, s.DeleteTransaction(context.Background(), id))
+	assert.Equal(t, codes.Error, recorder.Ended()[2].Status().Code)
+}
+
+func TestTransaction_ReusesConnections(t *testing.T) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(`{"error":"upstream is down"}`))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	s := NewTransaction(zap.NewNop(), srv.URL)
+
+	for i := 0; i < 3; i++ {
+		_, err := s.CreateTransaction(context.Background(), model.Transaction{UserName: "Aybek", Amount: 10})
+		assert.Error(t, err)
+		assert.Error(t, s.CreateTransactionItem(context.Background(), model.TransactionItem{TransactionID: 7}))
+		assert.Error(t, s.DeleteTransaction(context.Background(), 7))
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns), "the failed answers are read out and the connection is reused")
+}
@@ -2,21 +2,29 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/zhayt/user-storage-service/internal/apperror"
 	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/tracing"
+	"github.com/zhayt/user-storage-service/internal/validation"
+	"github.com/zhayt/user-storage-service/logger"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
-	"net/mail"
-	"regexp"
 	"strings"
 )
 
 var (
-	EmailRX        = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
-	ErrInvalidData = errors.New("invalid data")
+	ErrInvalidData        = apperror.New(apperror.Validation, "invalid data")
+	ErrInvalidCredentials = apperror.New(apperror.Unauthorized, "invalid email or password")
 )
 
+// invalidData reports a validation failure, the reason is shown to the client.
+func invalidData(reason string) error {
+	return apperror.Wrap(apperror.Validation, reason, ErrInvalidData)
+}
+
 //go:generate mockery --name IUserStorage
 type IUserStorage interface {
 	GetUserByID(ctx context.Context, userID int) (model.User, error)
@@ -25,73 +33,169 @@ type IUserStorage interface {
 	UpdateUserFIO(ctx context.Context, user model.UserUpdateFIO) (int, error)
 	UpdateUserPassword(ctx context.Context, user model.UserUpdatePassword) (int, error)
 	DeleteUser(ctx context.Context, userID int) error
+	RestoreUser(ctx context.Context, userID int) (int, error)
+}
+
+// _dummyPasswordHash is compared against when the email is unknown,
+// so the answer takes as long as for a wrong password.
+const _dummyPasswordHash = "$2a$10$qHYbNCqLmnPlpoL2VxHHp.J2pMUTIC5F7wVuh3JmxL5W2NqNxRFQO"
+
+type emailVerifier interface {
+	SendVerification(ctx context.Context, user model.User) error
+}
+
+type loginGuard interface {
+	Check(ctx context.Context, email, ip string) error
+	Fail(ctx context.Context, email, ip string)
+	Succeed(ctx context.Context, email string)
 }
 
 type UserService struct {
-	user IUserStorage
-	log  *zap.Logger
+	tx     ITxManager
+	user   IUserStorage
+	verify emailVerifier
+	guard  loginGuard
+	log    *zap.Logger
 }
 
-func NewUserService(logger *zap.Logger, user IUserStorage) *UserService {
-	return &UserService{log: logger, user: user}
+func NewUserService(logger *zap.Logger, tx ITxManager, user IUserStorage, verify emailVerifier, guard loginGuard) *UserService {
+	return &UserService{log: logger, tx: tx, user: user, verify: verify, guard: guard}
 }
 
 func (s *UserService) GetUserByID(ctx context.Context, userId int) (model.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByID")
+	defer span.End()
+
 	return s.user.GetUserByID(ctx, userId)
 }
 
+// GetUserByEmail signs the user in. Unknown email and wrong password look the same to the caller,
+// and both count towards the lockout of the account and the client IP.
 func (s *UserService) GetUserByEmail(ctx context.Context, login model.UserLogin) (model.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByEmail")
+	defer span.End()
+
+	if err := validation.Struct(login); err != nil {
+		return model.User{}, err
+	}
+
+	if err := s.guard.Check(ctx, login.Email, login.IP); err != nil {
+		return model.User{}, err
+	}
+
 	user, err := s.user.GetUserByEmail(ctx, login.Email)
 	if err != nil {
-		return user, err
+		if apperror.KindOf(err) != apperror.NotFound {
+			return user, err
+		}
+		_ = compareHashAndPassword(_dummyPasswordHash, login.Password)
+	} else {
+		err = compareHashAndPassword(user.Password, login.Password)
 	}
 
-	if err = compareHashAndPassword(user.Password, login.Password); err != nil {
-		return user, err
+	if err != nil {
+		s.guard.Fail(ctx, login.Email, login.IP)
+		return model.User{}, apperror.Wrap(apperror.Unauthorized, ErrInvalidCredentials.Message, err)
 	}
 
+	s.guard.Succeed(ctx, login.Email)
+
 	return user, nil
 }
 
 func (s *UserService) CreateUser(ctx context.Context, user model.User) (int, error) {
-	if err := checkDate(3, 50, user.FIO, user.Password); err != nil {
-		s.log.Error("Check date error", zap.Error(err))
-		return 0, err
-	}
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer span.End()
 
-	if err := matchesPattern(user.Email, EmailRX); err != nil {
+	if err := validation.Struct(user); err != nil {
+		logger.FromContext(ctx, s.log).Error("Validation error", zap.Error(err))
 		return 0, err
 	}
 
 	passwdHash, err := generatePasswordHash(user.Password)
 	if err != nil {
-		s.log.Error("Passwd hash error", zap.Error(err))
+		logger.FromContext(ctx, s.log).Error("Passwd hash error", zap.Error(err))
 		return 0, err
 	}
 
 	user.Password = passwdHash
+	user.Role = model.RoleReader
+
+	// the account and its verification email are written together, no account is left without a link
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		userID, err := s.user.CreateUser(ctx, user)
+		if err != nil {
+			logger.FromContext(ctx, s.log).Error("Service error", zap.Error(err))
+			return err
+		}
+
+		// the account stays unverified until the link is followed, a lost email can be asked for again
+		user.ID = userID
+		if err = s.verify.SendVerification(ctx, user); err != nil {
+			logger.FromContext(ctx, s.log).Error("Send verification error", zap.Int("id", userID), zap.Error(err))
+			return err
+		}
 
-	userID, err := s.user.CreateUser(ctx, user)
+		return nil
+	})
 	if err != nil {
-		s.log.Error("Service error", zap.Error(err))
 		return 0, err
 	}
 
-	return userID, nil
+	return user.ID, nil
 }
 
-func (s *UserService) UpdateUserFIO(ctx context.Context, user model.UserUpdateFIO) (int, error) {
-	if err := checkDate(3, 50, user.FIO); err != nil {
-		return 0, err
-	}
+// PatchUserFIO applies the patch on top of the stored profile and writes the result if it is still valid.
+// The returned user carries the new version.
+func (s *UserService) PatchUserFIO(ctx context.Context, userID, version int, patch model.Patch) (model.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.PatchUserFIO")
+	defer span.End()
+
+	var user model.User
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) (err error) {
+		if user, err = s.user.GetUserByID(ctx, userID); err != nil {
+			return err
+		}
+
+		if user.Version != version {
+			return ErrVersionMismatch
+		}
 
-	user.FIO = strings.TrimSpace(user.FIO)
+		doc, err := applyPatch(profileDocument{FIO: user.FIO}, patch)
+		if err != nil {
+			return err
+		}
+
+		if err = validation.Struct(model.UserUpdateFIO{ID: user.ID, FIO: doc.FIO}); err != nil {
+			return err
+		}
+
+		user.FIO = strings.TrimSpace(doc.FIO)
+
+		if _, err = s.user.UpdateUserFIO(ctx, model.UserUpdateFIO{ID: user.ID, FIO: user.FIO, Version: user.Version}); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrVersionMismatch
+			}
+			return err
+		}
+
+		user.Version++
 
-	return s.user.UpdateUserFIO(ctx, user)
+		return nil
+	})
+
+	return user, err
 }
 
 func (s *UserService) UpdateUserPassword(ctx context.Context, userUP model.UserUpdatePassword) (int, error) {
-	if err := checkDate(3, 50, userUP.NewPassword); err != nil {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUserPassword")
+	defer span.End()
+
+	v := validation.New()
+	v.Struct(userUP)
+	v.Check(userUP.NewPassword == userUP.NewPasswordRepeat, "newPasswordRepeat", "must match newPassword")
+	if err := v.Err(); err != nil {
 		return 0, err
 	}
 
@@ -102,11 +206,7 @@ func (s *UserService) UpdateUserPassword(ctx context.Context, userUP model.UserU
 	}
 
 	if err = compareHashAndPassword(user.Password, userUP.CurrentPassword); err != nil {
-		return 0, err
-	}
-
-	if userUP.NewPassword != userUP.NewPasswordRepeat {
-		return 0, errors.New("not same password")
+		return 0, apperror.Invalid(apperror.Violation{Field: "currentPassword", Message: "is wrong"})
 	}
 
 	passwdHash, err := generatePasswordHash(userUP.NewPassword)
@@ -120,11 +220,21 @@ func (s *UserService) UpdateUserPassword(ctx context.Context, userUP model.UserU
 }
 
 func (s *UserService) DeleteUser(ctx context.Context, userID int) error {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer span.End()
+
 	// Можно сделать чтобы пользователь ввел пароль
 	// и проверять сответствие пароля перед тем удалять пользователя
 	return s.user.DeleteUser(ctx, userID)
 }
 
+func (s *UserService) RestoreUser(ctx context.Context, userID int) (int, error) {
+	ctx, span := tracing.Start(ctx, "UserService.RestoreUser")
+	defer span.End()
+
+	return s.user.RestoreUser(ctx, userID)
+}
+
 func generatePasswordHash(passwd string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(passwd), bcrypt.DefaultCost)
 	if err != nil {
@@ -137,29 +247,3 @@ func generatePasswordHash(passwd string) (string, error) {
 func compareHashAndPassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
-
-func checkDate(minLen, maxLen int, data ...string) error {
-	for _, d := range data {
-		d = strings.TrimSpace(d)
-		if len([]rune(d)) < minLen && len([]rune(d)) > maxLen {
-			return ErrInvalidData
-		}
-	}
-
-	return nil
-}
-
-func matchesPattern(value string, pattern *regexp.Regexp) error {
-	if value == "" {
-		return ErrInvalidData
-	}
-	_, err := mail.ParseAddress(value)
-	if err != nil {
-		return ErrInvalidData
-	}
-	if !pattern.MatchString(value) {
-		return ErrInvalidData
-	}
-
-	return nil
-}
@@ -3,52 +3,33 @@ package service
 import (
 	"context"
 	"errors"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/loginguard"
 	"github.com/zhayt/user-storage-service/internal/model"
 	"github.com/zhayt/user-storage-service/internal/service/mocks"
+	"github.com/zhayt/user-storage-service/internal/storage/inmemory"
 	"go.uber.org/zap"
-	"regexp"
+	"golang.org/x/crypto/bcrypt"
 	"testing"
+	"time"
 )
 
-func TestMatchesPatternTableDriven(t *testing.T) {
-	type args struct {
-		value   string
-		pattern *regexp.Regexp
-	}
-	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
-	}{
-		{"Valid email", args{"example@email.ru", EmailRX}, false},
-		{"Invalid email missing .", args{"example@emailru", EmailRX}, true},
-		{"Invalid email missing @", args{"exampleemailru", EmailRX}, true},
-		{"Invalid email has only домен", args{"@mail.ru", EmailRX}, true},
-		{"Valid email", args{"example@gemail.com", EmailRX}, false},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if err := matchesPattern(tt.args.value, tt.args.pattern); (err != nil) != tt.wantErr {
-				t.Errorf("matchesPattern() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
 func TestUserService_CreateUser(t *testing.T) {
 	type args struct {
 		ctx  context.Context
 		user model.User
 	}
 	tests := []struct {
-		name    string
-		args    args
-		want    int
-		wantErr bool
+		name        string
+		args        args
+		want        int
+		wantErr     bool
+		wantStorage bool
 	}{
-		{name: "success", args: args{ctx: nil, user: model.User{FIO: "Aybek", Email: "example@mail.ru", Password: "asd"}}, want: 2, wantErr: false},
-		{name: "email already exists", args: args{ctx: nil, user: model.User{FIO: "Test User", Email: "existexample@mail.ru", Password: "asd"}}, want: 0, wantErr: true},
+		{name: "success", args: args{ctx: nil, user: model.User{FIO: "Aybek", Email: "example@mail.ru", Password: "asd"}}, want: 2, wantErr: false, wantStorage: true},
+		{name: "email already exists", args: args{ctx: nil, user: model.User{FIO: "Test User", Email: "existexample@mail.ru", Password: "asd"}}, want: 0, wantErr: true, wantStorage: true},
 		{name: "short name", args: args{ctx: nil, user: model.User{FIO: "sh", Email: "example@email.ru", Password: "asd"}}, want: 0, wantErr: true},
 		{name: "invalid email", args: args{ctx: nil, user: model.User{FIO: "I don't have email", Email: "invalid@mailru", Password: "sad"}}, want: 0, wantErr: true},
 	}
@@ -57,13 +38,15 @@ func TestUserService_CreateUser(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			userStorage := mocks.NewIUserStorage(t)
 
-			if tt.args.user.Email == "existexample@mail.ru" {
+			switch {
+			case !tt.wantStorage:
+			case tt.args.user.Email == "existexample@mail.ru":
 				userStorage.
 					On("CreateUser", mock.Anything, mock.AnythingOfType("model.User")).
 					Return(func(ctx context.Context, user model.User) (int, error) {
 						return 0, errors.New("user with this email already exists")
 					})
-			} else {
+			default:
 				userStorage.
 					On("CreateUser", mock.Anything, mock.AnythingOfType("model.User")).
 					Return(func(ctx context.Context, user model.User) (int, error) {
@@ -71,9 +54,12 @@ func TestUserService_CreateUser(t *testing.T) {
 					})
 			}
 
+			var sent []model.User
 			s := &UserService{
-				user: userStorage,
-				log:  zap.NewExample(),
+				tx:     inlineTx{},
+				user:   userStorage,
+				verify: verifierFunc(func(user model.User) { sent = append(sent, user) }),
+				log:    zap.NewExample(),
 			}
 			got, err := s.CreateUser(tt.args.ctx, tt.args.user)
 			if (err != nil) != tt.wantErr {
@@ -83,6 +69,82 @@ func TestUserService_CreateUser(t *testing.T) {
 			if got != tt.want {
 				t.Errorf("CreateUser() got = %v, want %v", got, tt.want)
 			}
+			if !tt.wantErr && (len(sent) != 1 || sent[0].ID != got) {
+				t.Errorf("CreateUser() verification sent to %v, want user %v", sent, got)
+			}
 		})
 	}
 }
+
+type verifierFunc func(user model.User)
+
+func (f verifierFunc) SendVerification(_ context.Context, user model.User) error {
+	f(user)
+	return nil
+}
+
+func TestUserService_CreateUser_RollsBackWithoutVerification(t *testing.T) {
+	db := inmemory.New()
+	users := inmemory.NewUserStorage(db)
+
+	failing := failingVerifier{errors.New("outbox is full")}
+	s := NewUserService(zap.NewNop(), inmemory.NewTxManager(db), users, failing, nil)
+
+	_, err := s.CreateUser(context.Background(), model.User{FIO: "Aybek", Email: "reader@mail.ru", Password: "asd"})
+	assert.Error(t, err)
+
+	_, err = users.GetUserByEmail(context.Background(), "reader@mail.ru")
+	assert.Equal(t, apperror.NotFound, apperror.KindOf(err), "the account is rolled back with its verification")
+}
+
+type failingVerifier struct{ err error }
+
+func (f failingVerifier) SendVerification(context.Context, model.User) error {
+	return f.err
+}
+
+// inlineTx runs the unit of work as it is, the mocks have nothing to roll back.
+type inlineTx struct{}
+
+func (inlineTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func TestUserService_GetUserByEmail(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userStorage := mocks.NewIUserStorage(t)
+	userStorage.On("GetUserByEmail", mock.Anything, "reader@mail.ru").
+		Return(model.User{ID: 1, Email: "reader@mail.ru", Password: string(hash)}, nil)
+	userStorage.On("GetUserByEmail", mock.Anything, "nobody@mail.ru").
+		Return(model.User{}, apperror.New(apperror.NotFound, "user not found"))
+
+	guard := loginguard.New(zap.NewNop(), loginguard.NewMemoryStore(),
+		loginguard.Policy{FreeFailures: 1, MaxFailures: 2, Lockout: time.Minute, Window: time.Minute}, loginguard.DefaultIPPolicy)
+	s := NewUserService(zap.NewNop(), inlineTx{}, userStorage, nil, guard)
+	ctx := context.Background()
+
+	_, wrongPassword := s.GetUserByEmail(ctx, model.UserLogin{Email: "reader@mail.ru", Password: "guess", IP: "10.0.0.1"})
+	_, unknownEmail := s.GetUserByEmail(ctx, model.UserLogin{Email: "nobody@mail.ru", Password: "guess", IP: "10.0.0.1"})
+
+	if apperror.KindOf(wrongPassword) != apperror.Unauthorized || apperror.Message(wrongPassword) != apperror.Message(unknownEmail) ||
+		apperror.KindOf(wrongPassword) != apperror.KindOf(unknownEmail) {
+		t.Errorf("GetUserByEmail() wrong password = %v, unknown email = %v, want the same answer", wrongPassword, unknownEmail)
+	}
+
+	if user, err := s.GetUserByEmail(ctx, model.UserLogin{Email: "reader@mail.ru", Password: "secret", IP: "10.0.0.1"}); err != nil || user.ID != 1 {
+		t.Errorf("GetUserByEmail() = %v, %v, want user 1", user.ID, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = s.GetUserByEmail(ctx, model.UserLogin{Email: "reader@mail.ru", Password: "guess", IP: "10.0.0.1"})
+	}
+
+	_, err = s.GetUserByEmail(ctx, model.UserLogin{Email: "reader@mail.ru", Password: "secret", IP: "10.0.0.1"})
+	if apperror.KindOf(err) != apperror.TooManyRequests {
+		t.Errorf("GetUserByEmail() after lockout error = %v, want too many requests", err)
+	}
+}
@@ -0,0 +1,183 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"time"
+)
+
+// loanRow is a row of book_issue_history, copyID is zero for a rental without a copy.
+type loanRow struct {
+	bookID     int
+	userID     int
+	copyID     int
+	quantity   int
+	createdAt  time.Time
+	returnDate *time.Time
+	deletedAt  *time.Time
+}
+
+type BIHistoryStorage struct {
+	db *DB
+}
+
+func NewBIHistory(db *DB) *BIHistoryStorage {
+	return &BIHistoryStorage{db: db}
+}
+
+// CreateBIHistory opens a rental for every book, all of them or none.
+func (r *BIHistoryStorage) CreateBIHistory(ctx context.Context, bIHistory model.BIHistory) error {
+	defer r.db.lock(ctx)()
+
+	for _, book := range bIHistory.Books {
+		if err := r.db.checkLoan(book.ID, bIHistory.UserID); err != nil {
+			return fmt.Errorf("couldn't execute query: %w", err)
+		}
+	}
+
+	now := time.Now()
+	for _, book := range bIHistory.Books {
+		r.db.loans.insert(&loanRow{bookID: book.ID, userID: bIHistory.UserID, quantity: book.Quantity, createdAt: now})
+	}
+
+	return nil
+}
+
+func (r *BIHistoryStorage) GetCurrentBorrowedBooks(ctx context.Context) ([]model.BorrowedBooks, error) {
+	defer r.db.rlock(ctx)()
+
+	return r.db.borrowedBooks(time.Time{}, true), nil
+}
+
+func (r *BIHistoryStorage) GetBIHistoryLastMonth(ctx context.Context) ([]model.BorrowedBooks, error) {
+	defer r.db.rlock(ctx)()
+
+	return r.db.borrowedBooks(time.Now().AddDate(0, -1, 0), false), nil
+}
+
+func (r *BIHistoryStorage) IterateCurrentBorrowedBooks(ctx context.Context, fn func(model.BorrowedBooks) error) error {
+	unlock := r.db.rlock(ctx)
+	borrowedBooks := r.db.borrowedBooks(time.Time{}, true)
+	unlock()
+
+	for _, b := range borrowedBooks {
+		if err := fn(b); err != nil {
+			return fmt.Errorf("couldn't iterate book issue history: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *BIHistoryStorage) IterateBIHistoryLastMonth(ctx context.Context, fn func(model.BorrowedBooks) error) error {
+	unlock := r.db.rlock(ctx)
+	borrowedBooks := r.db.borrowedBooks(time.Now().AddDate(0, -1, 0), false)
+	unlock()
+
+	for _, b := range borrowedBooks {
+		if err := fn(b); err != nil {
+			return fmt.Errorf("couldn't iterate book issue history for last month: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// UpdateBIHistory closes an open rental, a rental of a copy puts the copy back on the shelf as well.
+func (r *BIHistoryStorage) UpdateBIHistory(ctx context.Context, bIHistoryID int) (int, error) {
+	defer r.db.lock(ctx)()
+
+	loan, ok := r.db.loans.get(bIHistoryID)
+	if !ok || loan.returnDate != nil {
+		return 0, fmt.Errorf("couldn't update book issue history returning date: %w", notFound("book issue history"))
+	}
+
+	now := time.Now()
+	loan.returnDate = &now
+
+	if bookCopy, ok := r.db.copies.get(loan.copyID); ok && bookCopy.Status == model.CopyStatusOnLoan {
+		bookCopy.Status = model.CopyStatusAvailable
+	}
+
+	return bIHistoryID, nil
+}
+
+// CountOverdueLoans counts the open loans issued longer than loanPeriod ago.
+func (r *BIHistoryStorage) CountOverdueLoans(ctx context.Context, loanPeriod time.Duration) (int, error) {
+	defer r.db.rlock(ctx)()
+
+	dueBefore := time.Now().Add(-loanPeriod)
+	var count int
+	for _, loan := range r.db.loans.rows {
+		if loan.returnDate == nil && loan.createdAt.Before(dueBefore) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// DeleteBIHistory soft deletes the rental, the row stays in the history. An open rental is closed
+// with it, so it no longer counts as a loan, and its copy goes back on the shelf. Deleting a missing
+// or deleted rental is not an error.
+func (r *BIHistoryStorage) DeleteBIHistory(ctx context.Context, bIHistoryID int) error {
+	defer r.db.lock(ctx)()
+
+	loan, ok := r.db.loans.get(bIHistoryID)
+	if !ok || loan.deletedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	loan.deletedAt = &now
+	if loan.returnDate != nil {
+		return nil
+	}
+
+	loan.returnDate = &now
+	if bookCopy, ok := r.db.copies.get(loan.copyID); ok && bookCopy.Status == model.CopyStatusOnLoan {
+		bookCopy.Status = model.CopyStatusAvailable
+	}
+
+	return nil
+}
+
+// borrowedBooks joins the open loans with their readers, books and copies. The monthly report
+// leaves out the quantity and the loans issued before since, like its query does.
+func (db *DB) borrowedBooks(since time.Time, withQuantity bool) []model.BorrowedBooks {
+	var borrowedBooks []model.BorrowedBooks
+	for _, id := range db.loans.ids() {
+		loan := db.loans.rows[id]
+		if loan.returnDate != nil || loan.createdAt.Before(since) {
+			continue
+		}
+
+		user, book := db.users.rows[loan.userID], db.books.rows[loan.bookID]
+		b := model.BorrowedBooks{ID: id, UserName: user.FIO, BookName: book.Title, BookAuthor: book.Author,
+			CreatedAt: loan.createdAt}
+		if bookCopy, ok := db.copies.get(loan.copyID); ok {
+			b.Barcode = bookCopy.Barcode
+		}
+		if withQuantity {
+			b.Quantity = loan.quantity
+		}
+
+		borrowedBooks = append(borrowedBooks, b)
+	}
+
+	return borrowedBooks
+}
+
+// checkLoan mirrors the foreign keys of book_issue_history, they hold for deleted books and users too.
+func (db *DB) checkLoan(bookID, userID int) error {
+	if _, ok := db.books.get(bookID); !ok {
+		return conflict("book issue history")
+	}
+
+	if _, ok := db.users.get(userID); !ok {
+		return conflict("book issue history")
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"time"
+)
+
+type bookRow = model.Book
+
+type BookStorage struct {
+	db *DB
+}
+
+func NewBookStorage(db *DB) *BookStorage {
+	return &BookStorage{db: db}
+}
+
+func (r *BookStorage) GetBookByID(ctx context.Context, bookID int) (model.Book, error) {
+	defer r.db.rlock(ctx)()
+
+	book, ok := r.db.books.get(bookID)
+	if !ok || book.DeletedAt != nil {
+		return model.Book{}, fmt.Errorf("couldn't take book id#%v: %w", bookID, notFound("book"))
+	}
+
+	return *book, nil
+}
+
+func (r *BookStorage) GetAllBooks(ctx context.Context) ([]model.Book, error) {
+	defer r.db.rlock(ctx)()
+
+	return r.db.activeBooks(), nil
+}
+
+func (r *BookStorage) IterateBooks(ctx context.Context, fn func(model.Book) error) error {
+	// the rows are copied out first, fn may call the stores itself
+	unlock := r.db.rlock(ctx)
+	books := r.db.activeBooks()
+	unlock()
+
+	for _, book := range books {
+		if err := fn(book); err != nil {
+			return fmt.Errorf("couldn't iterate books: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *BookStorage) CreateBook(ctx context.Context, book model.Book) (int, error) {
+	defer r.db.lock(ctx)()
+
+	if err := r.db.checkBook(0, book); err != nil {
+		return 0, fmt.Errorf("couldn't create book: %w", err)
+	}
+
+	row := model.Book{Title: book.Title, Author: book.Author, Price: book.Price, ISBN: book.ISBN, Version: 1}
+	row.ID = r.db.books.insert(&row)
+
+	return row.ID, nil
+}
+
+// UpdateBook overwrites the book only while its version is still book.Version.
+func (r *BookStorage) UpdateBook(ctx context.Context, book model.Book) (int, error) {
+	defer r.db.lock(ctx)()
+
+	row, ok := r.db.books.get(book.ID)
+	if !ok || row.DeletedAt != nil || row.Version != book.Version {
+		return 0, fmt.Errorf("couldn't update book id#%v: %w", book.ID, notFound("book"))
+	}
+
+	if err := r.db.checkBook(book.ID, book); err != nil {
+		return 0, fmt.Errorf("couldn't update book id#%v: %w", book.ID, err)
+	}
+
+	row.Title, row.Author, row.Price, row.ISBN = book.Title, book.Author, book.Price, book.ISBN
+	row.Version++
+
+	return row.ID, nil
+}
+
+// UpsertBookByISBN creates the book or overwrites the one with the same ISBN, restoring it if it was deleted.
+// created reports whether a new row was inserted.
+func (r *BookStorage) UpsertBookByISBN(ctx context.Context, book model.Book) (int, bool, error) {
+	defer r.db.lock(ctx)()
+
+	_, row, ok := r.db.bookByISBN(book.ISBN)
+	if !ok {
+		if err := r.db.checkBook(0, book); err != nil {
+			return 0, false, fmt.Errorf("couldn't upsert book isbn#%s: %w", book.ISBN, err)
+		}
+
+		row = &model.Book{Title: book.Title, Author: book.Author, Price: book.Price, ISBN: book.ISBN, Version: 1}
+		row.ID = r.db.books.insert(row)
+
+		return row.ID, true, nil
+	}
+
+	if err := r.db.checkBook(row.ID, book); err != nil {
+		return 0, false, fmt.Errorf("couldn't upsert book isbn#%s: %w", book.ISBN, err)
+	}
+
+	row.Title, row.Author, row.Price, row.DeletedAt = book.Title, book.Author, book.Price, nil
+	row.Version++
+
+	return row.ID, false, nil
+}
+
+func (r *BookStorage) HasOpenLoans(ctx context.Context, bookID int) (bool, error) {
+	defer r.db.rlock(ctx)()
+
+	return r.db.hasOpenLoans(bookID), nil
+}
+
+// DeleteBook only marks the book as deleted, its rental history stays for reporting.
+// A book that is still on loan is left untouched and sql.ErrNoRows is returned.
+func (r *BookStorage) DeleteBook(ctx context.Context, bookID int) error {
+	defer r.db.lock(ctx)()
+
+	row, ok := r.db.books.get(bookID)
+	if !ok || row.DeletedAt != nil || r.db.hasOpenLoans(bookID) {
+		return fmt.Errorf("cannot delete book id#%v: %w", bookID, notFound("book"))
+	}
+
+	now := time.Now()
+	row.DeletedAt = &now
+
+	return nil
+}
+
+func (r *BookStorage) RestoreBook(ctx context.Context, bookID int) (int, error) {
+	defer r.db.lock(ctx)()
+
+	row, ok := r.db.books.get(bookID)
+	if !ok || row.DeletedAt == nil {
+		return 0, fmt.Errorf("couldn't restore book id#%v: %w", bookID, notFound("book"))
+	}
+
+	row.DeletedAt = nil
+
+	return row.ID, nil
+}
+
+func (db *DB) activeBooks() []model.Book {
+	var books []model.Book
+	for _, id := range db.books.ids() {
+		if book := db.books.rows[id]; book.DeletedAt == nil {
+			books = append(books, *book)
+		}
+	}
+
+	return books
+}
+
+// bookByISBN finds the book holding the ISBN, deleted or not. An empty ISBN belongs to no book.
+func (db *DB) bookByISBN(isbn string) (int, *model.Book, bool) {
+	if isbn == "" {
+		return 0, nil, false
+	}
+
+	return db.books.find(func(b *model.Book) bool { return b.ISBN == isbn })
+}
+
+func (db *DB) hasOpenLoans(bookID int) bool {
+	_, _, ok := db.loans.find(func(l *loanRow) bool { return l.bookID == bookID && l.returnDate == nil })
+	return ok
+}
+
+// checkBook mirrors the column limits of the book table and the unique index of the ISBN,
+// bookID is the row being written, zero for a new one.
+func (db *DB) checkBook(bookID int, book model.Book) error {
+	if tooLong(book.Title, 50) || tooLong(book.Author, 70) || tooLong(book.ISBN, 13) || book.Price < 0 {
+		return invalid("book")
+	}
+
+	if id, _, ok := db.bookByISBN(book.ISBN); ok && id != bookID {
+		return alreadyExists("book")
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"time"
+)
+
+type copyRow = model.BookCopy
+
+type BookCopyStorage struct {
+	db *DB
+}
+
+func NewBookCopyStorage(db *DB) *BookCopyStorage {
+	return &BookCopyStorage{db: db}
+}
+
+func (r *BookCopyStorage) CreateBookCopy(ctx context.Context, bookCopy model.BookCopy) (int, error) {
+	defer r.db.lock(ctx)()
+
+	if tooLong(bookCopy.Barcode, 32) || tooLong(bookCopy.Condition, 50) {
+		return 0, fmt.Errorf("couldn't create book copy: %w", invalid("book copy"))
+	}
+
+	if _, ok := r.db.books.get(bookCopy.BookID); !ok {
+		return 0, fmt.Errorf("couldn't create book copy: %w", conflict("book copy"))
+	}
+
+	if _, _, ok := r.db.copyByBarcode(bookCopy.Barcode); ok {
+		return 0, fmt.Errorf("couldn't create book copy: %w", alreadyExists("book copy"))
+	}
+
+	// acquired_at is a DATE column
+	y, m, d := bookCopy.AcquiredAt.Date()
+	row := model.BookCopy{BookID: bookCopy.BookID, Barcode: bookCopy.Barcode, Condition: bookCopy.Condition,
+		AcquiredAt: time.Date(y, m, d, 0, 0, 0, 0, time.UTC), Status: model.CopyStatusAvailable}
+	row.ID = r.db.copies.insert(&row)
+
+	return row.ID, nil
+}
+
+func (r *BookCopyStorage) GetBookCopyByBarcode(ctx context.Context, barcode string) (model.BookCopy, error) {
+	defer r.db.rlock(ctx)()
+
+	_, bookCopy, ok := r.db.copyByBarcode(barcode)
+	if !ok {
+		return model.BookCopy{}, fmt.Errorf("couldn't take book copy barcode#%s: %w", barcode, notFound("book copy"))
+	}
+
+	return *bookCopy, nil
+}
+
+func (r *BookCopyStorage) GetBookCopies(ctx context.Context, bookID int) ([]model.BookCopy, error) {
+	defer r.db.rlock(ctx)()
+
+	var copies []model.BookCopy
+	for _, id := range r.db.copies.ids() {
+		if bookCopy := r.db.copies.rows[id]; bookCopy.BookID == bookID {
+			copies = append(copies, *bookCopy)
+		}
+	}
+
+	return copies, nil
+}
+
+// UpdateBookCopyStatus leaves a copy on loan alone, its rental is still open.
+func (r *BookCopyStorage) UpdateBookCopyStatus(ctx context.Context, bookCopy model.BookCopyUpdateStatus) (int, error) {
+	defer r.db.lock(ctx)()
+
+	_, row, ok := r.db.copyByBarcode(bookCopy.Barcode)
+	if !ok || row.Status == model.CopyStatusOnLoan {
+		return 0, fmt.Errorf("couldn't update book copy barcode#%s: %w", bookCopy.Barcode, notFound("book copy"))
+	}
+
+	switch bookCopy.Status {
+	case model.CopyStatusAvailable, model.CopyStatusOnLoan, model.CopyStatusLost, model.CopyStatusWithdrawn:
+	default:
+		return 0, fmt.Errorf("couldn't update book copy barcode#%s: %w", bookCopy.Barcode, invalid("book copy"))
+	}
+
+	row.Status = bookCopy.Status
+
+	return row.ID, nil
+}
+
+// CheckoutBookCopy marks an available copy as on loan and opens a rental for it.
+// It returns the id of the created book issue history row.
+func (r *BookCopyStorage) CheckoutBookCopy(ctx context.Context, checkout model.Checkout) (int, error) {
+	defer r.db.lock(ctx)()
+
+	_, bookCopy, ok := r.db.copyByBarcode(checkout.Barcode)
+	if ok {
+		book := r.db.books.rows[bookCopy.BookID]
+		ok = bookCopy.Status == model.CopyStatusAvailable && book.DeletedAt == nil
+	}
+	if !ok {
+		return 0, fmt.Errorf("couldn't take available book copy barcode#%s: %w", checkout.Barcode, notFound("book copy"))
+	}
+
+	if err := r.db.checkLoan(bookCopy.BookID, checkout.UserID); err != nil {
+		return 0, fmt.Errorf("couldn't create book issue history: %w", err)
+	}
+
+	bookCopy.Status = model.CopyStatusOnLoan
+
+	return r.db.loans.insert(&loanRow{bookID: bookCopy.BookID, userID: checkout.UserID, copyID: bookCopy.ID,
+		quantity: 1, createdAt: time.Now()}), nil
+}
+
+// CheckinBookCopy closes the open rental of the copy and puts the copy back on the shelf. With a
+// user set only a rental of that user is closed. It returns the id of the closed book issue history row.
+func (r *BookCopyStorage) CheckinBookCopy(ctx context.Context, checkin model.Checkin) (int, error) {
+	defer r.db.lock(ctx)()
+
+	_, bookCopy, ok := r.db.copyByBarcode(checkin.Barcode)
+	if !ok || bookCopy.Status != model.CopyStatusOnLoan {
+		return 0, fmt.Errorf("couldn't take loaned book copy barcode#%s: %w", checkin.Barcode, notFound("book copy"))
+	}
+
+	if tooLong(checkin.Condition, 50) {
+		return 0, fmt.Errorf("couldn't take loaned book copy barcode#%s: %w", checkin.Barcode, invalid("book copy"))
+	}
+
+	loanID, loan, ok := r.db.loans.find(func(l *loanRow) bool {
+		return l.copyID == bookCopy.ID && l.returnDate == nil && (checkin.UserID == 0 || l.userID == checkin.UserID)
+	})
+	if !ok {
+		return 0, fmt.Errorf("couldn't close book issue history of copy id#%v: %w", bookCopy.ID, notFound("book issue history"))
+	}
+
+	now := time.Now()
+	loan.returnDate = &now
+	bookCopy.Status = model.CopyStatusAvailable
+	if checkin.Condition != "" {
+		bookCopy.Condition = checkin.Condition
+	}
+
+	return loanID, nil
+}
+
+func (db *DB) copyByBarcode(barcode string) (int, *model.BookCopy, bool) {
+	return db.copies.find(func(c *model.BookCopy) bool { return c.Barcode == barcode })
+}
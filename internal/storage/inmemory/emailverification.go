@@ -0,0 +1,68 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"time"
+)
+
+type EmailVerificationStorage struct {
+	db *DB
+}
+
+func NewEmailVerificationStorage(db *DB) *EmailVerificationStorage {
+	return &EmailVerificationStorage{db: db}
+}
+
+// CountEmailVerificationTokens counts the tokens issued to the user within the last within, used or not.
+func (r *EmailVerificationStorage) CountEmailVerificationTokens(ctx context.Context, userID int, within time.Duration) (int, error) {
+	defer r.db.rlock(ctx)()
+
+	since := time.Now().Add(-within)
+
+	var count int
+	for _, t := range r.db.verifies.rows {
+		if t.userID == userID && t.createdAt.After(since) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CreateEmailVerificationToken replaces the unused tokens of the user with the new one and queues the email
+// carrying it, both are written or neither is.
+func (r *EmailVerificationStorage) CreateEmailVerificationToken(ctx context.Context, token model.EmailVerificationToken, email model.OutboxEmail) error {
+	defer r.db.lock(ctx)()
+
+	if err := r.db.issueToken(&r.db.verifies, "email verification token", token.UserID, token.TokenHash,
+		time.Now().Add(token.TTL), email); err != nil {
+		return fmt.Errorf("couldn't create email verification token: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyEmail spends a live token and marks the email of its user verified. It returns the user id.
+func (r *EmailVerificationStorage) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	defer r.db.lock(ctx)()
+
+	token, ok := r.db.liveToken(&r.db.verifies, tokenHash)
+	if !ok {
+		return 0, fmt.Errorf("couldn't use email verification token: %w", notFound("email verification token"))
+	}
+
+	user := r.db.users.rows[token.userID]
+	if user.DeletedAt != nil {
+		return 0, fmt.Errorf("couldn't verify email of user ID#%v: %w", token.userID, notFound("user"))
+	}
+
+	now := time.Now()
+	token.usedAt = &now
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+	}
+
+	return user.ID, nil
+}
@@ -1,86 +1,195 @@
+// Package inmemory keeps the storage in the memory of the process, for development and tests
+// without a database. The stores follow the constraints of the Postgres schema, so the service
+// sees the same errors from both.
 package inmemory
 
 import (
 	"context"
-	"errors"
-	"fmt"
-	"github.com/zhayt/user-storage-service/internal/model"
+	"database/sql"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"sort"
 	"sync"
+	"unicode/utf8"
 )
 
-var (
-	ErrUserNotExists = errors.New("user not exists")
-	ErrNameTaken     = errors.New("couldn't add user, id taken")
-)
+// DB holds the tables of all stores. The stores built on one DB see the rows of each other
+// and a store method holding its lock works like a transaction.
+type DB struct {
+	mu sync.RWMutex
+	tables
+}
 
-type UserStorage struct {
-	mu      sync.RWMutex
-	id      int
-	storage map[int]model.User
+type tables struct {
+	users    table[userRow]
+	books    table[bookRow]
+	loans    table[loanRow]
+	copies   table[copyRow]
+	resets   table[tokenRow]
+	verifies table[tokenRow]
+	outbox   table[emailRow]
 }
 
-func NewUserStorage() *UserStorage {
-	return &UserStorage{
-		storage: make(map[int]model.User, 50),
+func New() *DB {
+	return &DB{tables: tables{
+		users:    newTable[userRow](),
+		books:    newTable[bookRow](),
+		loans:    newTable[loanRow](),
+		copies:   newTable[copyRow](),
+		resets:   newTable[tokenRow](),
+		verifies: newTable[tokenRow](),
+		outbox:   newTable[emailRow](),
+	}}
+}
+
+func (t tables) clone() tables {
+	return tables{
+		users:    t.users.clone(),
+		books:    t.books.clone(),
+		loans:    t.loans.clone(),
+		copies:   t.copies.clone(),
+		resets:   t.resets.clone(),
+		verifies: t.verifies.clone(),
+		outbox:   t.outbox.clone(),
 	}
 }
 
-func (r *UserStorage) GetUserById(ctx context.Context, id int) (model.User, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	user, ok := r.storage[id]
-	if !ok {
-		return user, fmt.Errorf("cannot take user: %w", ErrUserNotExists)
+type txKey struct{}
+
+// lock takes the write lock and returns its release. A transaction of the DB in ctx holds it already.
+func (db *DB) lock(ctx context.Context) func() {
+	if db.inTx(ctx) {
+		return func() {}
 	}
 
-	return user, nil
+	db.mu.Lock()
+	return db.mu.Unlock
 }
 
-func (r *UserStorage) GetAllUsers(ctx context.Context) ([]model.User, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	users := make([]model.User, 0, len(r.storage))
-	for _, user := range r.storage {
-		users = append(users, user)
+// rlock is lock for the stores that only read.
+func (db *DB) rlock(ctx context.Context) func() {
+	if db.inTx(ctx) {
+		return func() {}
 	}
 
-	return users, nil
+	db.mu.RLock()
+	return db.mu.RUnlock
+}
+
+func (db *DB) inTx(ctx context.Context) bool {
+	tx, _ := ctx.Value(txKey{}).(*DB)
+	return tx == db
+}
+
+// TxManager runs a unit of work holding the write lock of the DB all along, so nothing else sees it
+// half done. The tables are copied at its start and put back when it fails.
+type TxManager struct {
+	db *DB
 }
 
-func (r *UserStorage) CreateUser(ctx context.Context, user model.User) (int, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	r.id++
-	if _, ok := r.storage[r.id]; ok {
-		return 0, fmt.Errorf("cannot create user: %w", ErrNameTaken)
+func NewTxManager(db *DB) *TxManager {
+	return &TxManager{db: db}
+}
+
+// WithinTx runs fn in one transaction, the store calls made with the context fn gets take part in it.
+// An error returned by fn rolls everything back and is returned as it is.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if m.db.inTx(ctx) {
+		return fn(ctx)
 	}
 
-	r.storage[r.id] = user
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	snapshot := m.db.tables.clone()
+	committed := false
+	// a panic of fn rolls back as well
+	defer func() {
+		if !committed {
+			m.db.tables = snapshot
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, m.db)); err != nil {
+		return err
+	}
+	committed = true
 
-	return r.id, nil
+	return nil
+}
+
+// table is a serial primary key with its rows.
+type table[T any] struct {
+	seq  int
+	rows map[int]*T
 }
 
-func (r *UserStorage) UpdateUser(ctx context.Context, user model.User) (int, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func newTable[T any]() table[T] {
+	return table[T]{rows: make(map[int]*T)}
+}
 
-	if _, ok := r.storage[user.ID]; !ok {
-		return 0, fmt.Errorf("cannot update user: %w", ErrUserNotExists)
+// clone copies the rows, the stores change them in place.
+func (t table[T]) clone() table[T] {
+	rows := make(map[int]*T, len(t.rows))
+	for id, row := range t.rows {
+		r := *row
+		rows[id] = &r
 	}
 
-	r.storage[user.ID] = user
+	return table[T]{seq: t.seq, rows: rows}
+}
 
-	return user.ID, nil
+func (t *table[T]) insert(row *T) int {
+	t.seq++
+	t.rows[t.seq] = row
+	return t.seq
 }
 
-func (r *UserStorage) DeleteUser(ctx context.Context, id int) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (t *table[T]) get(id int) (*T, bool) {
+	row, ok := t.rows[id]
+	return row, ok
+}
 
-	if _, ok := r.storage[id]; !ok {
-		return fmt.Errorf("cannot delete user: %w", ErrUserNotExists)
+// find returns the first row in id order that match reports true for.
+func (t *table[T]) find(match func(*T) bool) (int, *T, bool) {
+	for _, id := range t.ids() {
+		if row := t.rows[id]; match(row) {
+			return id, row, true
+		}
 	}
 
-	delete(r.storage, id)
-	return nil
+	return 0, nil, false
+}
+
+// ids returns the keys in ascending order, rows are visited like an index scan of the primary key.
+func (t *table[T]) ids() []int {
+	ids := make([]int, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+// The errors are the ones postgres.domainError makes of the matching SQLSTATE codes.
+
+func notFound(entity string) error {
+	return apperror.Wrap(apperror.NotFound, entity+" not found", sql.ErrNoRows)
+}
+
+func alreadyExists(entity string) error {
+	return apperror.New(apperror.AlreadyExists, entity+" already exists")
+}
+
+func conflict(entity string) error {
+	return apperror.New(apperror.Conflict, entity+" refers to a missing record or is still referenced")
+}
+
+func invalid(entity string) error {
+	return apperror.New(apperror.Validation, entity+" has invalid data")
+}
+
+// tooLong checks a VARCHAR(n) limit, which counts characters rather than bytes.
+func tooLong(s string, n int) bool {
+	return utf8.RuneCountInString(s) > n
 }
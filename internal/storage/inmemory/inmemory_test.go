@@ -0,0 +1,21 @@
+package inmemory_test
+
+import (
+	"github.com/zhayt/user-storage-service/internal/storage/inmemory"
+	"github.com/zhayt/user-storage-service/internal/storage/storagetest"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Stores {
+		db := inmemory.New()
+
+		return storagetest.Stores{
+			Users:   inmemory.NewUserStorage(db),
+			Books:   inmemory.NewBookStorage(db),
+			History: inmemory.NewBIHistory(db),
+			Copies:  inmemory.NewBookCopyStorage(db),
+			Tx:      inmemory.NewTxManager(db),
+		}
+	})
+}
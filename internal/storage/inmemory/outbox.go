@@ -0,0 +1,104 @@
+package inmemory
+
+import (
+	"context"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"time"
+)
+
+// emailRow is a row of email_outbox.
+type emailRow struct {
+	recipient string
+	subject   string
+	body      string
+	attempts  int
+	lastError string
+	createdAt time.Time
+	sentAt    *time.Time
+	// claimedUntil is when the claim of the dispatcher sending the email runs out
+	claimedUntil time.Time
+}
+
+type OutboxStorage struct {
+	db *DB
+}
+
+func NewOutboxStorage(db *DB) *OutboxStorage {
+	return &OutboxStorage{db: db}
+}
+
+// ClaimPendingEmails returns the oldest emails which are not sent yet, have attempts left and
+// are not claimed by another dispatcher, and claims them for lease. Marking an email sent or failed
+// ends the claim, one whose dispatcher died is picked up again once the lease runs out.
+func (r *OutboxStorage) ClaimPendingEmails(ctx context.Context, maxAttempts, limit int, lease time.Duration) ([]model.OutboxEmail, error) {
+	defer r.db.lock(ctx)()
+
+	now := time.Now()
+
+	var emails []model.OutboxEmail
+	for _, id := range r.db.outbox.ids() {
+		if len(emails) == limit {
+			break
+		}
+
+		if e := r.db.outbox.rows[id]; e.sentAt == nil && e.attempts < maxAttempts && e.claimedUntil.Before(now) {
+			e.claimedUntil = now.Add(lease)
+			emails = append(emails, model.OutboxEmail{ID: id, Recipient: e.recipient, Subject: e.subject, Body: e.body,
+				Attempts: e.attempts, CreatedAt: e.createdAt})
+		}
+	}
+
+	return emails, nil
+}
+
+// MarkEmailSent blanks the body as well, it may hold a one-time link which must not outlive the sending.
+func (r *OutboxStorage) MarkEmailSent(ctx context.Context, emailID int) error {
+	defer r.db.lock(ctx)()
+
+	if e, ok := r.db.outbox.get(emailID); ok {
+		now := time.Now()
+		e.sentAt = &now
+		e.attempts++
+		e.body = ""
+		e.claimedUntil = time.Time{}
+	}
+
+	return nil
+}
+
+func (r *OutboxStorage) MarkEmailFailed(ctx context.Context, emailID int, reason string) error {
+	defer r.db.lock(ctx)()
+
+	if e, ok := r.db.outbox.get(emailID); ok {
+		e.attempts++
+		e.lastError = reason
+		e.claimedUntil = time.Time{}
+	}
+
+	return nil
+}
+
+// PurgeEmails deletes the emails sent longer than retention ago and the ones which ran out of attempts.
+func (r *OutboxStorage) PurgeEmails(ctx context.Context, maxAttempts int, retention time.Duration) (int64, error) {
+	defer r.db.lock(ctx)()
+
+	sentBefore := time.Now().Add(-retention)
+	var purged int64
+	for id, e := range r.db.outbox.rows {
+		if (e.sentAt != nil && e.sentAt.Before(sentBefore)) || (e.sentAt == nil && e.attempts >= maxAttempts) {
+			delete(r.db.outbox.rows, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// checkEmail mirrors the column limits of email_outbox.
+func checkEmail(email model.OutboxEmail) error {
+	if tooLong(email.Recipient, 50) || tooLong(email.Subject, 255) {
+		return invalid("email")
+	}
+
+	return nil
+}
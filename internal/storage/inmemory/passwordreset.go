@@ -0,0 +1,107 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"time"
+)
+
+// tokenRow is a row of password_reset_token or email_verification_token, both have the same columns.
+type tokenRow struct {
+	userID    int
+	tokenHash string
+	expiresAt time.Time
+	usedAt    *time.Time
+	createdAt time.Time
+}
+
+type PasswordResetStorage struct {
+	db *DB
+}
+
+func NewPasswordResetStorage(db *DB) *PasswordResetStorage {
+	return &PasswordResetStorage{db: db}
+}
+
+// CreatePasswordResetToken replaces the unused tokens of the user with the new one and queues the email
+// carrying it, both are written or neither is.
+func (r *PasswordResetStorage) CreatePasswordResetToken(ctx context.Context, token model.PasswordResetToken, email model.OutboxEmail) error {
+	defer r.db.lock(ctx)()
+
+	if err := r.db.issueToken(&r.db.resets, "password reset token", token.UserID, token.TokenHash,
+		time.Now().Add(token.TTL), email); err != nil {
+		return fmt.Errorf("couldn't create password reset token: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword spends a live token and sets the new password of its user. It returns the user id.
+func (r *PasswordResetStorage) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	defer r.db.lock(ctx)()
+
+	token, ok := r.db.liveToken(&r.db.resets, tokenHash)
+	if !ok {
+		return 0, fmt.Errorf("couldn't use password reset token: %w", notFound("password reset token"))
+	}
+
+	user := r.db.users.rows[token.userID]
+	if user.DeletedAt != nil {
+		return 0, fmt.Errorf("couldn't update user password ID#%v: %w", token.userID, notFound("user"))
+	}
+
+	if tooLong(passwordHash, 60) {
+		return 0, fmt.Errorf("couldn't update user password ID#%v: %w", token.userID, invalid("user"))
+	}
+
+	now := time.Now()
+	token.usedAt = &now
+	user.Password = passwordHash
+	user.Version++
+
+	return user.ID, nil
+}
+
+// issueToken expires the live tokens of the user, adds the new one and queues the email.
+// Everything is checked before the first write, a failure leaves the tables as they were.
+func (db *DB) issueToken(tokens *table[tokenRow], entity string, userID int, tokenHash string, expiresAt time.Time,
+	email model.OutboxEmail) error {
+	if _, ok := db.users.get(userID); !ok {
+		return conflict(entity)
+	}
+
+	if _, _, ok := tokens.find(func(t *tokenRow) bool { return t.tokenHash == tokenHash }); ok {
+		return alreadyExists(entity)
+	}
+
+	if len(tokenHash) > 64 {
+		return invalid(entity)
+	}
+
+	if err := checkEmail(email); err != nil {
+		return fmt.Errorf("couldn't queue email: %w", err)
+	}
+
+	now := time.Now()
+	for _, t := range tokens.rows {
+		if t.userID == userID && t.usedAt == nil && t.expiresAt.After(now) {
+			t.expiresAt = now
+		}
+	}
+
+	tokens.insert(&tokenRow{userID: userID, tokenHash: tokenHash, expiresAt: expiresAt, createdAt: now})
+	db.outbox.insert(&emailRow{recipient: email.Recipient, subject: email.Subject, body: email.Body, createdAt: now})
+
+	return nil
+}
+
+// liveToken finds the unused, unexpired token with the hash.
+func (db *DB) liveToken(tokens *table[tokenRow], tokenHash string) (*tokenRow, bool) {
+	now := time.Now()
+	_, token, ok := tokens.find(func(t *tokenRow) bool {
+		return t.tokenHash == tokenHash && t.usedAt == nil && t.expiresAt.After(now)
+	})
+
+	return token, ok
+}
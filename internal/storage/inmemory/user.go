@@ -0,0 +1,142 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"time"
+)
+
+type userRow = model.User
+
+type UserStorage struct {
+	db *DB
+}
+
+func NewUserStorage(db *DB) *UserStorage {
+	return &UserStorage{db: db}
+}
+
+func (r *UserStorage) GetUserByID(ctx context.Context, userID int) (model.User, error) {
+	defer r.db.rlock(ctx)()
+
+	user, ok := r.db.users.get(userID)
+	if !ok || user.DeletedAt != nil {
+		return model.User{}, fmt.Errorf("couldn't get user by ID#%v: %w", userID, notFound("user"))
+	}
+
+	return *user, nil
+}
+
+func (r *UserStorage) GetUserByEmail(ctx context.Context, email string) (model.User, error) {
+	defer r.db.rlock(ctx)()
+
+	_, user, ok := r.db.activeUserByEmail(email)
+	if !ok {
+		return model.User{}, fmt.Errorf("couldn't get user by email#%s: %w", email, notFound("user"))
+	}
+
+	return *user, nil
+}
+
+func (r *UserStorage) CreateUser(ctx context.Context, user model.User) (int, error) {
+	defer r.db.lock(ctx)()
+
+	if err := checkUser(user); err != nil {
+		return 0, fmt.Errorf("couldn't create user: %w", err)
+	}
+
+	if _, _, ok := r.db.activeUserByEmail(user.Email); ok {
+		return 0, fmt.Errorf("couldn't create user: %w", alreadyExists("user"))
+	}
+
+	row := model.User{FIO: user.FIO, Email: user.Email, Password: user.Password, Role: user.Role, Version: 1}
+	row.ID = r.db.users.insert(&row)
+
+	return row.ID, nil
+}
+
+// UpdateUserFIO overwrites the FIO only while the version of the user is still user.Version.
+func (r *UserStorage) UpdateUserFIO(ctx context.Context, user model.UserUpdateFIO) (int, error) {
+	defer r.db.lock(ctx)()
+
+	row, ok := r.db.users.get(user.ID)
+	if !ok || row.DeletedAt != nil || row.Version != user.Version {
+		return 0, fmt.Errorf("couldn't update user FIO ID#%v: %w", user.ID, notFound("user"))
+	}
+
+	if tooLong(user.FIO, 70) {
+		return 0, fmt.Errorf("couldn't update user FIO ID#%v: %w", user.ID, invalid("user"))
+	}
+
+	row.FIO = user.FIO
+	row.Version++
+
+	return row.ID, nil
+}
+
+func (r *UserStorage) UpdateUserPassword(ctx context.Context, user model.UserUpdatePassword) (int, error) {
+	defer r.db.lock(ctx)()
+
+	row, ok := r.db.users.get(user.ID)
+	if !ok || row.DeletedAt != nil {
+		return 0, fmt.Errorf("couldn't update user password ID#%v: %w", user.ID, notFound("user"))
+	}
+
+	if tooLong(user.NewPassword, 60) {
+		return 0, fmt.Errorf("couldn't update user password ID#%v: %w", user.ID, invalid("user"))
+	}
+
+	row.Password = user.NewPassword
+	row.Version++
+
+	return row.ID, nil
+}
+
+// DeleteUser only marks the account as deleted, so the loan history of the reader is kept.
+func (r *UserStorage) DeleteUser(ctx context.Context, userID int) error {
+	defer r.db.lock(ctx)()
+
+	row, ok := r.db.users.get(userID)
+	if !ok || row.DeletedAt != nil {
+		return fmt.Errorf("couldn't delete user ID#%v: %w", userID, notFound("user"))
+	}
+
+	now := time.Now()
+	row.DeletedAt = &now
+
+	return nil
+}
+
+// RestoreUser fails with AlreadyExists if the email was taken by another account meanwhile,
+// the unique index of the email only covers the accounts that are not deleted.
+func (r *UserStorage) RestoreUser(ctx context.Context, userID int) (int, error) {
+	defer r.db.lock(ctx)()
+
+	row, ok := r.db.users.get(userID)
+	if !ok || row.DeletedAt == nil {
+		return 0, fmt.Errorf("couldn't restore user ID#%v: %w", userID, notFound("user"))
+	}
+
+	if _, _, ok = r.db.activeUserByEmail(row.Email); ok {
+		return 0, fmt.Errorf("couldn't restore user ID#%v: %w", userID, alreadyExists("user"))
+	}
+
+	row.DeletedAt = nil
+
+	return row.ID, nil
+}
+
+func (db *DB) activeUserByEmail(email string) (int, *model.User, bool) {
+	return db.users.find(func(u *model.User) bool { return u.Email == email && u.DeletedAt == nil })
+}
+
+// checkUser mirrors the column limits and the role check of the user table.
+func checkUser(user model.User) error {
+	if tooLong(user.FIO, 70) || tooLong(user.Email, 50) || tooLong(user.Password, 60) ||
+		(user.Role != model.RoleReader && user.Role != model.RoleAdmin) {
+		return invalid("user")
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+// Package migration reads the numbered schema migrations the storage backends embed,
+// in the file layout of the migrate CLI.
+package migration
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Read returns the migrations in dir of fsys ordered by version,
+// every version needs both an up and a down file.
+func Read(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint]*Migration)
+	for _, entry := range entries {
+		// 000001_init.up.sql
+		name := entry.Name()
+		parts := strings.SplitN(name, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("bad migration file name %q", name)
+		}
+
+		version, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration version in %q: %w", name, err)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version)}
+			byVersion[uint(version)] = m
+		}
+
+		switch {
+		case strings.HasSuffix(parts[1], ".up.sql"):
+			if m.Up != "" {
+				return nil, fmt.Errorf("migration %d has two up files", version)
+			}
+			m.Name, m.Up = strings.TrimSuffix(parts[1], ".up.sql"), string(body)
+		case strings.HasSuffix(parts[1], ".down.sql"):
+			if m.Down != "" {
+				return nil, fmt.Errorf("migration %d has two down files", version)
+			}
+			m.Down = string(body)
+		default:
+			return nil, fmt.Errorf("bad migration file name %q", name)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both up and down files", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
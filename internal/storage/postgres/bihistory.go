@@ -2,103 +2,170 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"github.com/jmoiron/sqlx"
 	"github.com/zhayt/user-storage-service/internal/model"
 	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	_currentBorrowedBooksQuery = `SELECT book_issue_history.id, u.fio, b.title, b.author, COALESCE(c.barcode, '') AS barcode, quantity,
+           created_at FROM book_issue_history
+		   INNER JOIN "user" u on u.id = book_issue_history.user_id
+		   INNER JOIN book b on b.id = book_issue_history.book_id
+		   LEFT JOIN book_copy c on c.id = book_issue_history.copy_id
+           WHERE return_date IS NULL`
+
+	_lastMonthBorrowedBooksQuery = `SELECT book_issue_history.id, u.fio, b.title, b.author, COALESCE(c.barcode, '') AS barcode, created_at FROM 
+           book_issue_history
+		   INNER JOIN "user" u on u.id = book_issue_history.user_id
+		   INNER JOIN book b on b.id = book_issue_history.book_id
+		   LEFT JOIN book_copy c on c.id = book_issue_history.copy_id
+		   WHERE created_at >= NOW() - INTERVAL '1 month' AND return_date IS NULL;`
 )
 
 type BIHistoryStorage struct {
-	db  *sqlx.DB
+	db  *Router
 	log *zap.Logger
 }
 
-func NewBIHistory(db *sqlx.DB, logger *zap.Logger) *BIHistoryStorage {
+func NewBIHistory(db *Router, logger *zap.Logger) *BIHistoryStorage {
 	return &BIHistoryStorage{db: db, log: logger}
 }
 
+// CreateBIHistory records all the books of the rent or none of them.
 func (r *BIHistoryStorage) CreateBIHistory(ctx context.Context, bIHistory model.BIHistory) error {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("couldn't create book issue history: %w", err)
-	}
-
-	stmt, err := tx.PrepareContext(ctx, `INSERT INTO book_issue_history (book_id, quantity, user_id) 
-		   VALUES ($1, $2, $3)`)
-
-	if err != nil {
-		return fmt.Errorf("couldn't prepare query: %w", err)
-	}
-
-	for _, book := range bIHistory.Books {
-		if _, err := stmt.ExecContext(ctx, book.ID, book.Quantity, bIHistory.UserID); err != nil {
-			if err = tx.Rollback(); err != nil {
-				return err
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		for _, book := range bIHistory.Books {
+			if _, err := conn(ctx, r.db).ExecContext(ctx, `INSERT INTO book_issue_history (book_id, quantity, user_id)
+				VALUES ($1, $2, $3)`, book.ID, book.Quantity, bIHistory.UserID); err != nil {
+				return fmt.Errorf("couldn't create book issue history: %w", domainError(err, "book issue history"))
 			}
-			return fmt.Errorf("couldn't execute query: %w", err)
 		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("couldn't commit transaction: %w", err)
-	}
 
-	return nil
+		return nil
+	})
 }
-func (r *BIHistoryStorage) GetCurrentBorrowedBooks(ctx context.Context) ([]model.BorrowedBooks, error) {
-	qr := `SELECT book_issue_history.id, u.fio, b.name, b.author, quantity, created_at FROM 
-           book_issue_history
-		   INNER JOIN "user" u on u.id = book_issue_history.user_id
-		   INNER JOIN book b on b.id = book_issue_history.book_id
-           WHERE return_date IS NULL`
 
+func (r *BIHistoryStorage) GetCurrentBorrowedBooks(ctx context.Context) ([]model.BorrowedBooks, error) {
 	var borrowedBooks []model.BorrowedBooks
 
-	if err := r.db.SelectContext(ctx, &borrowedBooks, qr); err != nil {
-		return nil, fmt.Errorf("couldn't teke book issue history: %w", err)
+	if err := replica(ctx, r.db).SelectContext(ctx, &borrowedBooks, _currentBorrowedBooksQuery); err != nil {
+		return nil, fmt.Errorf("couldn't teke book issue history: %w", domainError(err, "book issue history"))
 	}
 
 	return borrowedBooks, nil
 }
 
 func (r *BIHistoryStorage) GetBIHistoryLastMonth(ctx context.Context) ([]model.BorrowedBooks, error) {
-	qr := `SELECT book_issue_history.id, u.fio, b.name, b.author, created_at FROM 
-           book_issue_history
-		   INNER JOIN "user" u on u.id = book_issue_history.user_id
-		   INNER JOIN book b on b.id = book_issue_history.book_id
-		   WHERE created_at >= NOW() - INTERVAL '1 month' AND return_date IS NULL;`
-
 	var bIHistories []model.BorrowedBooks
 
-	if err := r.db.SelectContext(ctx, &bIHistories, qr); err != nil {
-		return bIHistories, fmt.Errorf("couldn't take book issue history for last month: %w", err)
+	if err := replica(ctx, r.db).SelectContext(ctx, &bIHistories, _lastMonthBorrowedBooksQuery); err != nil {
+		return bIHistories, fmt.Errorf("couldn't take book issue history for last month: %w", domainError(err, "book issue history"))
 	}
 
 	return bIHistories, nil
 }
 
+func (r *BIHistoryStorage) IterateCurrentBorrowedBooks(ctx context.Context, fn func(model.BorrowedBooks) error) error {
+	if err := iterate(ctx, replica(ctx, r.db), fn, _currentBorrowedBooksQuery); err != nil {
+		return fmt.Errorf("couldn't iterate book issue history: %w", domainError(err, "book issue history"))
+	}
+
+	return nil
+}
+
+func (r *BIHistoryStorage) IterateBIHistoryLastMonth(ctx context.Context, fn func(model.BorrowedBooks) error) error {
+	if err := iterate(ctx, replica(ctx, r.db), fn, _lastMonthBorrowedBooksQuery); err != nil {
+		return fmt.Errorf("couldn't iterate book issue history for last month: %w", domainError(err, "book issue history"))
+	}
+
+	return nil
+}
+
+// UpdateBIHistory closes an open rental, a rental of a copy puts the copy back on the shelf as well.
 func (r *BIHistoryStorage) UpdateBIHistory(ctx context.Context, bIHistoryID int) (int, error) {
-	qr := `UPDATE book_issue_history 
-		   SET return_date = CURRENT_TIMESTAMP 
-		   WHERE id = $1 
-		   RETURNING id`
+	var loan struct {
+		ID     int64         `db:"id"`
+		CopyID sql.NullInt64 `db:"copy_id"`
+	}
+
+	err := withinTx(ctx, r.db, func(ctx context.Context) error {
+		qr := `UPDATE book_issue_history 
+			   SET return_date = CURRENT_TIMESTAMP 
+			   WHERE id = $1 AND return_date IS NULL
+			   RETURNING id, copy_id`
+
+		if err := conn(ctx, r.db).GetContext(ctx, &loan, qr, bIHistoryID); err != nil {
+			return fmt.Errorf("couldn't update book issue history returning date: %w", domainError(err, "book issue history"))
+		}
+
+		if !loan.CopyID.Valid {
+			return nil
+		}
+
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE book_copy SET status = $2 WHERE id = $1 AND status = $3`,
+			loan.CopyID.Int64, model.CopyStatusAvailable, model.CopyStatusOnLoan); err != nil {
+			return fmt.Errorf("couldn't put back book copy id#%v: %w", loan.CopyID.Int64, domainError(err, "book copy"))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
 
-	var bihId int64
+	return int(loan.ID), nil
+}
+
+// CountOverdueLoans counts the open loans issued longer than loanPeriod ago.
+func (r *BIHistoryStorage) CountOverdueLoans(ctx context.Context, loanPeriod time.Duration) (int, error) {
+	qr := `SELECT COUNT(*) FROM book_issue_history
+		   WHERE return_date IS NULL AND created_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'`
 
-	if err := r.db.GetContext(ctx, &bihId, qr, bIHistoryID); err != nil {
-		return 0, fmt.Errorf("couldn't update book issue history returning date: %w", err)
+	var count int
+	if err := replica(ctx, r.db).GetContext(ctx, &count, qr, loanPeriod.Seconds()); err != nil {
+		return 0, fmt.Errorf("couldn't count overdue loans: %w", domainError(err, "book issue history"))
 	}
 
-	return int(bihId), nil
+	return count, nil
 }
 
+// DeleteBIHistory soft deletes the rental, the row stays in the history. An open rental is closed
+// with it, so it no longer counts as a loan, and its copy goes back on the shelf. Deleting a missing
+// or deleted rental is not an error.
 func (r *BIHistoryStorage) DeleteBIHistory(ctx context.Context, bIHistoryID int) error {
-	qr := `DELETE FROM book_issue_history
-       	   WHERE id = $1`
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		var loan struct {
+			CopyID sql.NullInt64 `db:"copy_id"`
+			Open   bool          `db:"open"`
+		}
+		err := conn(ctx, r.db).GetContext(ctx, &loan, `SELECT copy_id, return_date IS NULL AS open FROM book_issue_history
+			WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, bIHistoryID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't get book issue history ID#%v: %w", bIHistoryID, domainError(err, "book issue history"))
+		}
 
-	if _, err := r.db.ExecContext(ctx, qr, bIHistoryID); err != nil {
-		return fmt.Errorf("couldn't delete book ID#%v: %w", bIHistoryID, err)
-	}
+		if _, err = conn(ctx, r.db).ExecContext(ctx, `UPDATE book_issue_history
+			SET deleted_at = CURRENT_TIMESTAMP, return_date = COALESCE(return_date, CURRENT_TIMESTAMP)
+			WHERE id = $1`, bIHistoryID); err != nil {
+			return fmt.Errorf("couldn't delete book issue history ID#%v: %w", bIHistoryID, domainError(err, "book issue history"))
+		}
 
-	return nil
+		if !loan.Open || !loan.CopyID.Valid {
+			return nil
+		}
+
+		if _, err = conn(ctx, r.db).ExecContext(ctx, `UPDATE book_copy SET status = $2 WHERE id = $1 AND status = $3`,
+			loan.CopyID.Int64, model.CopyStatusAvailable, model.CopyStatusOnLoan); err != nil {
+			return fmt.Errorf("couldn't put back book copy id#%v: %w", loan.CopyID.Int64, domainError(err, "book copy"))
+		}
+
+		return nil
+	})
 }
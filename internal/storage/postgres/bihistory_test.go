@@ -42,7 +42,7 @@ func TestBIHistoryStorage_CreateBIHistory(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &BIHistoryStorage{
-				db:  db,
+				db:  NewRouter(db, nil, 0),
 				log: zap.NewExample(),
 			}
 
@@ -80,7 +80,7 @@ func TestBIHistoryStorage_GetCurrentBorrowedBooks(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &BIHistoryStorage{
-				db:  db,
+				db:  NewRouter(db, nil, 0),
 				log: zap.NewExample(),
 			}
 
@@ -3,72 +3,135 @@ package postgres
 import (
 	"context"
 	"fmt"
-	"github.com/jmoiron/sqlx"
 	"github.com/zhayt/user-storage-service/internal/model"
 	"go.uber.org/zap"
 )
 
+// _bookColumns lists the columns model.Book is read from.
+const _bookColumns = `id, title, author, price, isbn, version, deleted_at`
+
 type BookStorage struct {
-	db  *sqlx.DB
+	db  *Router
 	log *zap.Logger
 }
 
-func NewBookStorage(db *sqlx.DB, logger *zap.Logger) *BookStorage {
+func NewBookStorage(db *Router, logger *zap.Logger) *BookStorage {
 	return &BookStorage{db: db, log: logger}
 }
 
 func (r *BookStorage) GetBookByID(ctx context.Context, bookID int) (model.Book, error) {
-	qr := `SELECT * FROM book WHERE id = $1`
+	qr := `SELECT ` + _bookColumns + ` FROM book WHERE id = $1 AND deleted_at IS NULL`
 
 	var book model.Book
-	if err := r.db.GetContext(ctx, &book, qr, bookID); err != nil {
-		return book, fmt.Errorf("couldn't take book id#%v: %w", bookID, err)
+	if err := replica(ctx, r.db).GetContext(ctx, &book, qr, bookID); err != nil {
+		return book, fmt.Errorf("couldn't take book id#%v: %w", bookID, domainError(err, "book"))
 	}
 
 	return book, nil
 }
 
 func (r *BookStorage) GetAllBooks(ctx context.Context) ([]model.Book, error) {
-	qr := `SELECT * FROM book`
+	qr := `SELECT ` + _bookColumns + ` FROM book WHERE deleted_at IS NULL`
 
 	var books []model.Book
 
-	if err := r.db.SelectContext(ctx, &books, qr); err != nil {
-		return books, fmt.Errorf("couldn't take all books: %w", err)
+	if err := replica(ctx, r.db).SelectContext(ctx, &books, qr); err != nil {
+		return books, fmt.Errorf("couldn't take all books: %w", domainError(err, "book"))
 	}
 
 	return books, nil
 }
 
+func (r *BookStorage) IterateBooks(ctx context.Context, fn func(model.Book) error) error {
+	if err := iterate(ctx, replica(ctx, r.db), fn, `SELECT `+_bookColumns+` FROM book WHERE deleted_at IS NULL ORDER BY id`); err != nil {
+		return fmt.Errorf("couldn't iterate books: %w", domainError(err, "book"))
+	}
+
+	return nil
+}
+
 func (r *BookStorage) CreateBook(ctx context.Context, book model.Book) (int, error) {
-	qr := `INSERT INTO book (name, author, price) VALUES($1, $2, $3) RETURNING id`
+	qr := `INSERT INTO book (title, author, price, isbn) VALUES($1, $2, $3, $4) RETURNING id`
 
 	var bookID int64
-	if err := r.db.GetContext(ctx, &bookID, qr, book.Title, book.Author, book.Price); err != nil {
-		return 0, fmt.Errorf("couldn't create book: %w", err)
+	if err := conn(ctx, r.db).GetContext(ctx, &bookID, qr, book.Title, book.Author, book.Price, book.ISBN); err != nil {
+		return 0, fmt.Errorf("couldn't create book: %w", domainError(err, "book"))
 	}
 
 	return int(bookID), nil
 }
 
+// UpdateBook overwrites the book only while its version is still book.Version.
 func (r *BookStorage) UpdateBook(ctx context.Context, book model.Book) (int, error) {
-	qr := `UPDATE book SET name = $2, author = $3, price = $4 WHERE id = $1 RETURNING id`
+	qr := `UPDATE book SET title = $2, author = $3, price = $4, isbn = $5, version = version + 1
+		   WHERE id = $1 AND deleted_at IS NULL AND version = $6 RETURNING id`
 
 	var bookId int64
 
-	if err := r.db.GetContext(ctx, &bookId, qr, book.ID, book.Title, book.Author, book.Price); err != nil {
-		return 0, fmt.Errorf("couldn't update book id#%v: %w", book.ID, err)
+	if err := conn(ctx, r.db).GetContext(ctx, &bookId, qr, book.ID, book.Title, book.Author, book.Price, book.ISBN,
+		book.Version); err != nil {
+		return 0, fmt.Errorf("couldn't update book id#%v: %w", book.ID, domainError(err, "book"))
 	}
 
 	return int(bookId), nil
 }
 
-func (r *BookStorage) DeleteBook(ctx context.Context, bookID int) error {
-	qr := `DELETE FROM book WHERE id = $1`
+// UpsertBookByISBN creates the book or overwrites the one with the same ISBN, restoring it if it was deleted.
+// created reports whether a new row was inserted.
+func (r *BookStorage) UpsertBookByISBN(ctx context.Context, book model.Book) (int, bool, error) {
+	qr := `INSERT INTO book (title, author, price, isbn) VALUES($1, $2, $3, $4)
+		   ON CONFLICT (isbn) WHERE isbn <> '' DO UPDATE
+		   SET title = EXCLUDED.title, author = EXCLUDED.author, price = EXCLUDED.price, deleted_at = NULL,
+		   version = book.version + 1
+		   RETURNING id, xmax = 0`
+
+	var (
+		bookID  int64
+		created bool
+	)
+
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, qr, book.Title, book.Author, book.Price, book.ISBN).
+		Scan(&bookID, &created); err != nil {
+		return 0, false, fmt.Errorf("couldn't upsert book isbn#%s: %w", book.ISBN, domainError(err, "book"))
+	}
+
+	return int(bookID), created, nil
+}
+
+func (r *BookStorage) HasOpenLoans(ctx context.Context, bookID int) (bool, error) {
+	qr := `SELECT EXISTS (SELECT 1 FROM book_issue_history WHERE book_id = $1 AND return_date IS NULL)`
 
-	if _, err := r.db.ExecContext(ctx, qr, bookID); err != nil {
-		return fmt.Errorf("cannot delete book id#%v: %w", bookID, err)
+	var exists bool
+	if err := replica(ctx, r.db).GetContext(ctx, &exists, qr, bookID); err != nil {
+		return false, fmt.Errorf("couldn't check open loans of book id#%v: %w", bookID, domainError(err, "book"))
+	}
+
+	return exists, nil
+}
+
+// DeleteBook only marks the book as deleted, its rental history stays for reporting.
+// A book that is still on loan is left untouched and sql.ErrNoRows is returned.
+func (r *BookStorage) DeleteBook(ctx context.Context, bookID int) error {
+	qr := `UPDATE book SET deleted_at = CURRENT_TIMESTAMP
+		   WHERE id = $1 AND deleted_at IS NULL
+		   AND NOT EXISTS (SELECT 1 FROM book_issue_history WHERE book_id = $1 AND return_date IS NULL)
+		   RETURNING id`
+
+	var id int64
+	if err := conn(ctx, r.db).GetContext(ctx, &id, qr, bookID); err != nil {
+		return fmt.Errorf("cannot delete book id#%v: %w", bookID, domainError(err, "book"))
 	}
 
 	return nil
 }
+
+func (r *BookStorage) RestoreBook(ctx context.Context, bookID int) (int, error) {
+	qr := `UPDATE book SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING id`
+
+	var id int64
+	if err := conn(ctx, r.db).GetContext(ctx, &id, qr, bookID); err != nil {
+		return 0, fmt.Errorf("couldn't restore book id#%v: %w", bookID, domainError(err, "book"))
+	}
+
+	return int(id), nil
+}
@@ -0,0 +1,31 @@
+package postgres_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/zhayt/user-storage-service/internal/storage/postgres"
+	"github.com/zhayt/user-storage-service/internal/storage/storagetest"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	dbContainer, db, err := postgres.SetupTestDatabase()
+	if dbContainer != nil {
+		defer dbContainer.Terminate(context.Background())
+	}
+	require.NoError(t, err)
+
+	// one database for the whole suite, the tests keep to their own rows
+	log := zap.NewNop()
+	router := postgres.NewRouter(db, nil, 0)
+	stores := storagetest.Stores{
+		Users:   postgres.NewUserStorage(router, log),
+		Books:   postgres.NewBookStorage(router, log),
+		History: postgres.NewBIHistory(router, log),
+		Copies:  postgres.NewBookCopyStorage(router, log),
+		Tx:      postgres.NewTxManager(router, log),
+	}
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Stores { return stores })
+}
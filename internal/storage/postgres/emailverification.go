@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"go.uber.org/zap"
+	"time"
+)
+
+type EmailVerificationStorage struct {
+	db  *Router
+	log *zap.Logger
+}
+
+func NewEmailVerificationStorage(db *Router, logger *zap.Logger) *EmailVerificationStorage {
+	return &EmailVerificationStorage{db: db, log: logger}
+}
+
+// CountEmailVerificationTokens counts the tokens issued to the user within the last within, used or not.
+func (r *EmailVerificationStorage) CountEmailVerificationTokens(ctx context.Context, userID int, within time.Duration) (int, error) {
+	qr := `SELECT COUNT(*) FROM email_verification_token
+		   WHERE user_id = $1 AND created_at > CURRENT_TIMESTAMP - $2 * INTERVAL '1 second'`
+
+	var count int
+	if err := primary(ctx, r.db).GetContext(ctx, &count, qr, userID, within.Seconds()); err != nil {
+		return 0, fmt.Errorf("couldn't count email verification tokens of user ID#%v: %w", userID, domainError(err, "email verification token"))
+	}
+
+	return count, nil
+}
+
+// CreateEmailVerificationToken replaces the unused tokens of the user with the new one and queues the email
+// carrying it, both are written or neither is.
+func (r *EmailVerificationStorage) CreateEmailVerificationToken(ctx context.Context, token model.EmailVerificationToken, email model.OutboxEmail) error {
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE email_verification_token SET expires_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP`, token.UserID); err != nil {
+			return fmt.Errorf("couldn't expire email verification tokens of user ID#%v: %w", token.UserID, domainError(err, "email verification token"))
+		}
+
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `INSERT INTO email_verification_token (user_id, token_hash, expires_at)
+			VALUES ($1, $2, CURRENT_TIMESTAMP + $3 * INTERVAL '1 second')`,
+			token.UserID, token.TokenHash, token.TTL.Seconds()); err != nil {
+			return fmt.Errorf("couldn't create email verification token: %w", domainError(err, "email verification token"))
+		}
+
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `INSERT INTO email_outbox (recipient, subject, body) VALUES ($1, $2, $3)`,
+			email.Recipient, email.Subject, email.Body); err != nil {
+			return fmt.Errorf("couldn't queue email: %w", domainError(err, "email"))
+		}
+
+		return nil
+	})
+}
+
+// VerifyEmail spends a live token and marks the email of its user verified. It returns the user id.
+func (r *EmailVerificationStorage) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	var userID int64
+
+	err := withinTx(ctx, r.db, func(ctx context.Context) error {
+		if err := conn(ctx, r.db).GetContext(ctx, &userID, `UPDATE email_verification_token SET used_at = CURRENT_TIMESTAMP
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+			RETURNING user_id`, tokenHash); err != nil {
+			return fmt.Errorf("couldn't use email verification token: %w", domainError(err, "email verification token"))
+		}
+
+		if err := conn(ctx, r.db).GetContext(ctx, &userID, `UPDATE "user" SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+			WHERE id = $1 AND deleted_at IS NULL RETURNING id`, userID); err != nil {
+			return fmt.Errorf("couldn't verify email of user ID#%v: %w", userID, domainError(err, "user"))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(userID), nil
+}
@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+)
+
+// SQLSTATE codes that are caused by the request rather than by the database.
+const (
+	_uniqueViolation     = "23505"
+	_foreignKeyViolation = "23503"
+	_checkViolation      = "23514"
+	_notNullViolation    = "23502"
+	_stringTooLong       = "22001"
+	_numericOutOfRange   = "22003"
+)
+
+// domainError turns driver errors into domain errors, entity names the record in the client message.
+// Other errors are returned as they are and end up as internal ones.
+func domainError(err error, entity string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperror.Wrap(apperror.NotFound, entity+" not found", err)
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case _uniqueViolation:
+		return apperror.Wrap(apperror.AlreadyExists, entity+" already exists", err)
+	case _foreignKeyViolation:
+		return apperror.Wrap(apperror.Conflict, entity+" refers to a missing record or is still referenced", err)
+	case _checkViolation, _notNullViolation, _stringTooLong, _numericOutOfRange:
+		return apperror.Wrap(apperror.Validation, entity+" has invalid data", err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,289 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-storage-service/internal/storage/migration"
+	"go.uber.org/zap"
+)
+
+// The migrations are embedded, the binary brings the schema it was built for.
+// Their bookkeeping is the one of the migrate CLI, so both can be used on the same database.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	_migrationsTable = "schema_migrations"
+	// _migrationLockID keeps replicas starting together from migrating at the same time.
+	_migrationLockID = 7051940
+)
+
+// _legacyMarkers tell how far a database without bookkeeping got, the one db-setup/app-db created
+// or one a newer schema was added to by hand: _legacyMarkers[i] holds once migration i+1 ran.
+// The first one that does not hold gives the version, the migrations above it are all repeatable.
+var _legacyMarkers = []string{
+	tableExists("user"),
+	tableExists("book") + ` AND ` + tableExists("book_issue_history"),
+	tableExists("book_copy"),
+	columnExists("book", "isbn"),
+	columnExists("book", "deleted_at"),
+	columnExists("book", "version"),
+	tableExists("password_reset_token"),
+	tableExists("email_verification_token"),
+	`NOT ` + columnExists("book", "name"),
+	columnExists("book", "price") + ` AND ` + columnExists("book_issue_history", "quantity"),
+	columnExists("email_outbox", "claimed_until"),
+	columnExists("book_issue_history", "deleted_at"),
+}
+
+func tableExists(table string) string {
+	return `to_regclass('"` + table + `"') IS NOT NULL`
+}
+
+func columnExists(table, column string) string {
+	return `EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema()
+		AND table_name = '` + table + `' AND column_name = '` + column + `')`
+}
+
+var ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+// Migrations returns the embedded migrations ordered by version.
+func Migrations() ([]migration.Migration, error) {
+	return migration.Read(migrationFiles, "migrations")
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []migration.Migration
+	log        *zap.Logger
+}
+
+func NewMigrator(db *sqlx.DB, logger *zap.Logger) (*Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read migrations: %w", err)
+	}
+
+	return &Migrator{db: db, migrations: migrations, log: logger}, nil
+}
+
+// Latest is the schema version this build expects.
+func (m *Migrator) Latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the schema version of the database, zero for an empty one.
+func (m *Migrator) Version(ctx context.Context) (version uint, dirty bool, err error) {
+	err = m.withLock(ctx, func(conn *sqlx.Conn) error {
+		version, dirty, err = m.version(ctx, conn)
+		return err
+	})
+
+	return version, dirty, err
+}
+
+// Check refuses a database which is dirty or ahead of this build, one behind is only logged.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = m.check(version, dirty); err != nil {
+		return err
+	}
+
+	if version < m.Latest() {
+		m.log.Warn("Database schema is behind, run migrate up", zap.Uint("version", version), zap.Uint("latest", m.Latest()))
+	}
+
+	return nil
+}
+
+// Up applies the pending migrations, each within its own transaction.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		version, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if err = m.check(version, dirty); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+
+			if err = m.apply(ctx, conn, migration.Up, migration.Version); err != nil {
+				return fmt.Errorf("couldn't apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			m.log.Info("Migration applied", zap.Uint("version", migration.Version), zap.String("name", migration.Name))
+		}
+
+		return nil
+	})
+}
+
+// Down reverts the last steps migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		version, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if err = m.check(version, dirty); err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if migration.Version > version {
+				continue
+			}
+
+			var previous uint
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+
+			if err = m.apply(ctx, conn, migration.Down, previous); err != nil {
+				return fmt.Errorf("couldn't revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			m.log.Info("Migration reverted", zap.Uint("version", migration.Version), zap.String("name", migration.Name))
+			steps--
+		}
+
+		return nil
+	})
+}
+
+func (m *Migrator) check(version uint, dirty bool) error {
+	switch {
+	case dirty:
+		return fmt.Errorf("database schema version %d is dirty, fix it by hand and force the version", version)
+	case version > m.Latest():
+		return fmt.Errorf("%w: database is at version %d, this build knows up to %d", ErrSchemaTooNew, version, m.Latest())
+	}
+
+	return nil
+}
+
+// apply runs the statements and moves the version in one transaction, a failed migration leaves nothing behind.
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, statements string, version uint) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, statements); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM `+_migrationsTable); err != nil {
+		return err
+	}
+
+	if version > 0 {
+		if _, err = tx.ExecContext(ctx, `INSERT INTO `+_migrationsTable+` (version, dirty) VALUES ($1, false)`, version); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// version creates the bookkeeping table if needed. A database db-setup created has the tables
+// but no bookkeeping, its version is read off the schema by legacyVersion.
+func (m *Migrator) version(ctx context.Context, conn *sqlx.Conn) (uint, bool, error) {
+	var exists bool
+	if err := conn.QueryRowxContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, _migrationsTable).Scan(&exists); err != nil {
+		return 0, false, fmt.Errorf("couldn't read schema version: %w", err)
+	}
+
+	if !exists {
+		legacy, err := m.legacyVersion(ctx, conn)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if _, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+_migrationsTable+
+			` (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`); err != nil {
+			return 0, false, fmt.Errorf("couldn't create %s: %w", _migrationsTable, err)
+		}
+
+		if legacy > 0 {
+			m.log.Warn("Schema without migrations found, taking it as baseline", zap.Uint("version", legacy))
+			if _, err = conn.ExecContext(ctx, `INSERT INTO `+_migrationsTable+` (version, dirty) VALUES ($1, false)`,
+				legacy); err != nil {
+				return 0, false, fmt.Errorf("couldn't record schema baseline: %w", err)
+			}
+			return legacy, false, nil
+		}
+	}
+
+	var (
+		version uint
+		dirty   bool
+	)
+	err := conn.QueryRowxContext(ctx, `SELECT version, dirty FROM `+_migrationsTable+` LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("couldn't read schema version: %w", err)
+	}
+
+	return version, dirty, nil
+}
+
+// legacyVersion returns the last migration whose changes the schema has, zero for an empty database.
+func (m *Migrator) legacyVersion(ctx context.Context, conn *sqlx.Conn) (uint, error) {
+	for i, marker := range _legacyMarkers {
+		var ok bool
+		if err := conn.QueryRowxContext(ctx, `SELECT `+marker).Scan(&ok); err != nil {
+			return 0, fmt.Errorf("couldn't inspect schema: %w", err)
+		}
+
+		if !ok {
+			return uint(i), nil
+		}
+	}
+
+	return uint(len(_legacyMarkers)), nil
+}
+
+// withLock runs fn on one connection holding the migration lock, the lock belongs to the session.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, _migrationLockID); err != nil {
+		return fmt.Errorf("couldn't take migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, _migrationLockID); err != nil {
+			m.log.Error("Release migration lock error", zap.Error(err))
+		}
+	}()
+
+	return fn(conn)
+}
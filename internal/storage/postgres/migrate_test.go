@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+
+	for i, m := range migrations {
+		assert.Equal(t, uint(i+1), m.Version, "versions go one by one")
+		assert.NotEmpty(t, m.Name)
+	}
+
+	assert.Len(t, _legacyMarkers, len(migrations), "every migration has a legacy marker")
+}
+
+func TestMigrator(t *testing.T) {
+	dbContainer, db, err := startTestPostgres()
+	if dbContainer != nil {
+		defer dbContainer.Terminate(context.Background())
+	}
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	m, err := NewMigrator(db, zap.NewNop())
+	require.NoError(t, err)
+
+	require.NoError(t, m.Up(ctx))
+	version, dirty, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest(), version)
+	assert.False(t, dirty)
+
+	var columns int
+	require.NoError(t, db.Get(&columns, `SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_name = 'book' AND column_name IN ('price', 'isbn', 'version', 'deleted_at')`))
+	assert.Equal(t, 4, columns)
+
+	require.NoError(t, m.Down(ctx, 1))
+	version, _, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest()-1, version)
+
+	require.NoError(t, m.Up(ctx), "up is repeatable")
+
+	_, err = db.Exec(`UPDATE schema_migrations SET version = version + 1`)
+	require.NoError(t, err)
+	assert.ErrorIs(t, m.Check(ctx), ErrSchemaTooNew)
+	assert.ErrorIs(t, m.Up(ctx), ErrSchemaTooNew)
+}
+
+func TestMigrator_Legacy(t *testing.T) {
+	dbContainer, db, err := startTestPostgres()
+	if dbContainer != nil {
+		defer dbContainer.Terminate(context.Background())
+	}
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	// the schema db-setup/app-db created, without any bookkeeping
+	legacy, err := migrationFiles.ReadFile("migrations/000002_init.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(legacy))
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO "user" (fio, email, password) VALUES ('Legacy', 'legacy@mail.com', 'secret')`)
+	require.NoError(t, err)
+
+	m, err := NewMigrator(db, zap.NewNop())
+	require.NoError(t, err)
+
+	version, _, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), version)
+
+	require.NoError(t, m.Up(ctx))
+
+	var verified bool
+	require.NoError(t, db.Get(&verified, `SELECT email_verified_at IS NOT NULL FROM "user" WHERE email = 'legacy@mail.com'`))
+	assert.True(t, verified, "existing accounts are verified by 000008")
+
+	var columns int
+	require.NoError(t, db.Get(&columns, `SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_name = 'book' AND column_name IN ('title', 'price', 'isbn', 'version', 'deleted_at')`))
+	assert.Equal(t, 5, columns)
+}
+
+func TestMigrator_SoftDeleteDown(t *testing.T) {
+	dbContainer, db, err := startTestPostgres()
+	if dbContainer != nil {
+		defer dbContainer.Terminate(context.Background())
+	}
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	m, err := NewMigrator(db, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, m.Up(ctx))
+
+	// a deleted account gave its email to a new one
+	_, err = db.Exec(`INSERT INTO "user" (fio, email, password, deleted_at) VALUES ('Old', 'reader@mail.com', 'secret', CURRENT_TIMESTAMP)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO "user" (fio, email, password) VALUES ('New', 'reader@mail.com', 'secret')`)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Down(ctx, int(m.Latest())-4), "000005 rolls back over shared emails")
+
+	var emails []string
+	require.NoError(t, db.Select(&emails, `SELECT email FROM "user" ORDER BY fio`))
+	assert.Len(t, emails, 2)
+	assert.Equal(t, "reader@mail.com", emails[0], "the live account keeps its email")
+	assert.NotEqual(t, "reader@mail.com", emails[1])
+}
@@ -0,0 +1,2 @@
+ALTER TABLE book_issue_history DROP COLUMN IF EXISTS copy_id;
+DROP TABLE book_copy;
\ No newline at end of file
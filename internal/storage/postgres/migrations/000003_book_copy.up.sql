@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS book_copy (
+    id SERIAL PRIMARY KEY,
+    book_id INTEGER NOT NULL,
+    barcode VARCHAR(32) UNIQUE NOT NULL,
+    condition VARCHAR(50) NOT NULL DEFAULT 'good',
+    acquired_at DATE NOT NULL DEFAULT CURRENT_DATE,
+    status VARCHAR(16) NOT NULL DEFAULT 'available'
+        CHECK (status IN ('available', 'on_loan', 'lost', 'withdrawn')),
+    FOREIGN KEY (book_id) REFERENCES book (id) ON DELETE CASCADE
+);
+
+ALTER TABLE book_issue_history ADD COLUMN IF NOT EXISTS copy_id INTEGER REFERENCES book_copy (id);
@@ -0,0 +1,3 @@
+ALTER TABLE book ADD COLUMN IF NOT EXISTS isbn VARCHAR(13) NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS book_isbn_key ON book (isbn) WHERE isbn <> '';
@@ -0,0 +1,19 @@
+ALTER TABLE book_issue_history DROP CONSTRAINT IF EXISTS book_issue_history_book_id_fkey;
+ALTER TABLE book_issue_history DROP CONSTRAINT IF EXISTS book_issue_history_user_id_fkey;
+ALTER TABLE book_issue_history ADD CONSTRAINT book_issue_history_book_id_fkey
+    FOREIGN KEY (book_id) REFERENCES book (id) ON DELETE CASCADE;
+ALTER TABLE book_issue_history ADD CONSTRAINT book_issue_history_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE;
+
+-- lossy: an email is unique again, so a deleted account that shares its email with another
+-- account loses it. The account itself stays, with its history, under a placeholder email.
+UPDATE "user" u SET email = 'deleted-' || u.id || '@invalid'
+WHERE u.deleted_at IS NOT NULL
+  AND EXISTS (SELECT 1 FROM "user" o WHERE o.email = u.email AND o.id <> u.id);
+
+DROP INDEX IF EXISTS user_email_key;
+ALTER TABLE "user" ADD CONSTRAINT user_email_key UNIQUE (email);
+
+ALTER TABLE "user" DROP COLUMN IF EXISTS role;
+ALTER TABLE "user" DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE book DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,16 @@
+ALTER TABLE book ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'reader'
+    CHECK (role IN ('reader', 'admin'));
+
+-- a deleted account keeps its history but gives its email back
+ALTER TABLE "user" DROP CONSTRAINT IF EXISTS user_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS user_email_key ON "user" (email) WHERE deleted_at IS NULL;
+
+-- history rows outlive books and users, they are only ever soft deleted
+ALTER TABLE book_issue_history DROP CONSTRAINT IF EXISTS book_issue_history_book_id_fkey;
+ALTER TABLE book_issue_history DROP CONSTRAINT IF EXISTS book_issue_history_user_id_fkey;
+ALTER TABLE book_issue_history ADD CONSTRAINT book_issue_history_book_id_fkey
+    FOREIGN KEY (book_id) REFERENCES book (id) ON DELETE RESTRICT;
+ALTER TABLE book_issue_history ADD CONSTRAINT book_issue_history_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE RESTRICT;
@@ -0,0 +1,2 @@
+ALTER TABLE "user" DROP COLUMN IF EXISTS version;
+ALTER TABLE book DROP COLUMN IF EXISTS version;
\ No newline at end of file
@@ -0,0 +1,14 @@
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
+
+-- accounts created before verification existed are trusted as they are
+UPDATE "user" SET email_verified_at = CURRENT_TIMESTAMP WHERE email_verified_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS email_verification_token (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE
+);
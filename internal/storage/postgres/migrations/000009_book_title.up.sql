@@ -0,0 +1,8 @@
+-- the code and db-setup called it title while the migrations created name,
+-- databases made by db-setup already have title
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'book' AND column_name = 'name') THEN
+        ALTER TABLE book RENAME COLUMN name TO title;
+    END IF;
+END $$;
@@ -0,0 +1,2 @@
+ALTER TABLE book_issue_history DROP COLUMN IF EXISTS quantity;
+ALTER TABLE book DROP COLUMN IF EXISTS price;
@@ -0,0 +1,3 @@
+-- 000002 creates the tables as db-setup did, on a database 000001 made they exist without these columns
+ALTER TABLE book ADD COLUMN IF NOT EXISTS price NUMERIC(10, 2) NOT NULL DEFAULT 0.00 CHECK (price >= 0.00);
+ALTER TABLE book_issue_history ADD COLUMN IF NOT EXISTS quantity INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+-- a dispatcher claims the emails it sends until claimed_until, the others skip them meanwhile
+ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP;
@@ -0,0 +1 @@
+ALTER TABLE book_issue_history DROP COLUMN IF EXISTS deleted_at;
@@ -1,3 +0,0 @@
-DROP TABLE book_issue_history;
-DROP TABLE book;
-DROP TABLE "user";
\ No newline at end of file
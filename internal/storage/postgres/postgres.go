@@ -2,27 +2,138 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"strconv"
 	"time"
+)
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+const (
+	_timeOut = 5 * time.Second
+	// the pauses between the attempts to reach a server that is not up yet
+	_dialDelay    = 500 * time.Millisecond
+	_maxDialDelay = 5 * time.Second
 )
 
-const _timeOut = 5 * time.Second
+// Options tune the pool and the connections Dial opens, zero values keep the defaults.
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// StatementTimeout makes the server cancel any statement running longer.
+	StatementTimeout time.Duration
+	// ApplicationName tells the connections of the service apart in pg_stat_activity.
+	ApplicationName string
+	// ConnectTimeout is how long Dial keeps trying while the server does not answer yet.
+	ConnectTimeout time.Duration
+}
 
-func Dial(driver string, dsn string) (*sqlx.DB, error) {
-	db, err := sqlx.Open(driver, dsn)
+// Dial opens the pool, pgx connections log their queries with the request logger.
+// A server that is still starting is waited for up to opts.ConnectTimeout.
+func Dial(ctx context.Context, driver string, dsn string, opts Options, logger *zap.Logger) (*sqlx.DB, error) {
+	db, err := open(driver, dsn, opts)
 	if err != nil {
 		return nil, fmt.Errorf("connot open db: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), _timeOut)
-	defer cancel()
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
 
-	if err = db.PingContext(ctx); err != nil {
+	if err = waitForServer(ctx, db, opts.ConnectTimeout, logger); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("cannot connect to db: %w", err)
 	}
 
 	return db, nil
 }
+
+// waitForServer pings the server until it answers. Only a server that cannot be reached or is
+// starting up is waited for, one that turns us down, for a wrong password say, fails at once.
+func waitForServer(ctx context.Context, db *sqlx.DB, timeout time.Duration, logger *zap.Logger) error {
+	deadline := time.Now().Add(timeout)
+	delay := _dialDelay
+
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, _timeOut)
+		err := db.PingContext(pingCtx)
+		cancel()
+
+		if err == nil || !notUp(err) || time.Now().Add(delay).After(deadline) {
+			return err
+		}
+
+		logger.Warn("Postgres is not ready, retrying", zap.Duration("in", delay), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > _maxDialDelay {
+			delay = _maxDialDelay
+		}
+	}
+}
+
+// notUp reports whether err comes from a server that cannot be reached or is starting up.
+func notUp(err error) bool {
+	var pgErr *pgconn.PgError
+	return !errors.As(err, &pgErr) || pgErr.Code == _cannotConnectNow
+}
+
+func open(driver string, dsn string, opts Options) (*sqlx.DB, error) {
+	if driver != "pgx" {
+		return sqlx.Open(driver, dsn)
+	}
+
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	connConfig.Tracer = queryTracer{}
+
+	if opts.ApplicationName != "" {
+		connConfig.RuntimeParams["application_name"] = opts.ApplicationName
+	}
+	if opts.StatementTimeout > 0 {
+		connConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(opts.StatementTimeout.Milliseconds(), 10)
+	}
+
+	return sqlx.NewDb(stdlib.OpenDB(*connConfig), driver), nil
+}
+
+// iterate scans the rows of the query one at a time and passes each to fn,
+// so large result sets are streamed instead of being collected into a slice.
+func iterate[T any](ctx context.Context, q querier, fn func(T) error, qr string, args ...interface{}) error {
+	rows, err := q.QueryxContext(ctx, qr, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item T
+		if err = rows.StructScan(&item); err != nil {
+			return err
+		}
+
+		if err = fn(item); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
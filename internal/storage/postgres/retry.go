@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+	"math/rand"
+	"time"
+)
+
+// SQLSTATE codes of a statement that did nothing and may simply be run again.
+const (
+	_serializationFailure = "40001"
+	_deadlockDetected     = "40P01"
+	_cannotConnectNow     = "57P03"
+)
+
+const (
+	_maxRetries = 3
+	_retryDelay = 20 * time.Millisecond
+)
+
+// retryable reports whether err left the database untouched and another attempt may succeed:
+// a serialization failure or deadlock, a server still starting up, or a connection lost before
+// anything was sent.
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case _serializationFailure, _deadlockDetected, _cannotConnectNow:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var safe interface{ SafeToRetry() bool }
+	return errors.As(err, &safe) && safe.SafeToRetry()
+}
+
+// retry runs fn until it succeeds, fails for good or runs out of attempts. The pause doubles
+// after every attempt and is jittered, so the transactions that collided do not collide again.
+func retry(ctx context.Context, fn func() error) error {
+	delay := _retryDelay
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt == _maxRetries || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay + time.Duration(rand.Int63n(int64(delay)))):
+		}
+
+		delay *= 2
+	}
+}
+
+// retryingDB runs each statement outside a transaction with retry. Within a transaction
+// a failed statement aborts the whole of it, so there only the transaction can be run again.
+type retryingDB struct {
+	*sqlx.DB
+}
+
+func (db retryingDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return retry(ctx, func() error {
+		return db.DB.GetContext(ctx, dest, query, args...)
+	})
+}
+
+func (db retryingDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return retry(ctx, func() error {
+		return db.DB.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+func (db retryingDB) ExecContext(ctx context.Context, query string, args ...interface{}) (res sql.Result, err error) {
+	err = retry(ctx, func() error {
+		res, err = db.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+
+	return res, err
+}
+
+func (db retryingDB) QueryxContext(ctx context.Context, query string, args ...interface{}) (rows *sqlx.Rows, err error) {
+	err = retry(ctx, func() error {
+		rows, err = db.DB.QueryxContext(ctx, query, args...)
+		return err
+	})
+
+	return rows, err
+}
+
+func (db retryingDB) QueryRowxContext(ctx context.Context, query string, args ...interface{}) (row *sqlx.Row) {
+	_ = retry(ctx, func() error {
+		row = db.DB.QueryRowxContext(ctx, query, args...)
+		return row.Err()
+	})
+
+	return row
+}
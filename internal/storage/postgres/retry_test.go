@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"success", nil, 1},
+		{"serialization failure", &pgconn.PgError{Code: _serializationFailure}, _maxRetries + 1},
+		{"deadlock wrapped by the store", fmt.Errorf("couldn't create book: %w", &pgconn.PgError{Code: _deadlockDetected}), _maxRetries + 1},
+		{"unique violation", &pgconn.PgError{Code: _uniqueViolation}, 1},
+		{"other error", errors.New("boom"), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := retry(context.Background(), func() error {
+				attempts++
+				return tt.err
+			})
+
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.attempts, attempts)
+		})
+	}
+}
+
+func TestRetry_StopsOnSuccess(t *testing.T) {
+	attempts := 0
+	err := retry(context.Background(), func() error {
+		if attempts++; attempts < 2 {
+			return &pgconn.PgError{Code: _serializationFailure}
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestDial_WaitsForServer(t *testing.T) {
+	// nothing listens on port 1, like a postgres container that is still starting
+	const dsn = "host=127.0.0.1 port=1 user=onelab dbname=onelab_db sslmode=disable"
+
+	start := time.Now()
+	_, err := Dial(context.Background(), "pgx", dsn, Options{}, zap.NewNop())
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), _dialDelay, "without ConnectTimeout only one attempt is made")
+
+	start = time.Now()
+	_, err = Dial(context.Background(), "pgx", dsn, Options{ConnectTimeout: 2 * _dialDelay}, zap.NewNop())
+	require.Error(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), _dialDelay)
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Router sends the writes to the primary and the reads to the replicas in turn. A replica lags
+// behind the primary, so for window after a write the reads of the same client go to the primary
+// as well and the client sees what it has just written. A client is known by the signed-in user
+// and by its IP, so a client that has just signed up reads its account back from the primary too.
+type Router struct {
+	primary  *sqlx.DB
+	replicas []*sqlx.DB
+	window   time.Duration
+	next     atomic.Uint32
+
+	mu sync.Mutex
+	// writes holds the time of the last write of each client, entries older than window are pruned
+	writes    map[string]time.Time
+	lastPrune time.Time
+}
+
+// NewRouter routes between the primary and the replicas, without replicas everything goes to the primary.
+func NewRouter(primary *sqlx.DB, replicas []*sqlx.DB, window time.Duration) *Router {
+	return &Router{primary: primary, replicas: replicas, window: window, writes: make(map[string]time.Time)}
+}
+
+// Primary returns the pool of the primary.
+func (rt *Router) Primary() *sqlx.DB {
+	return rt.primary
+}
+
+// reader returns the pool a read of ctx goes to.
+func (rt *Router) reader(ctx context.Context) *sqlx.DB {
+	if len(rt.replicas) == 0 || rt.wroteRecently(ctx) {
+		return rt.primary
+	}
+
+	return rt.replicas[rt.next.Add(1)%uint32(len(rt.replicas))]
+}
+
+// wrote notes a write of the client ctx belongs to. Writes outside a request, of the background
+// jobs, are not tracked.
+func (rt *Router) wrote(ctx context.Context) {
+	keys := clients(ctx)
+	if len(keys) == 0 || len(rt.replicas) == 0 {
+		return
+	}
+
+	now := time.Now()
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	for _, key := range keys {
+		rt.writes[key] = now
+	}
+
+	if now.Sub(rt.lastPrune) > rt.window {
+		for c, at := range rt.writes {
+			if now.Sub(at) > rt.window {
+				delete(rt.writes, c)
+			}
+		}
+		rt.lastPrune = now
+	}
+}
+
+func (rt *Router) wroteRecently(ctx context.Context) bool {
+	keys := clients(ctx)
+	if len(keys) == 0 {
+		return false
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	for _, key := range keys {
+		if at, ok := rt.writes[key]; ok && time.Since(at) <= rt.window {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clients returns the keys the writes of ctx are noted under: the user and the client IP it carries.
+func clients(ctx context.Context) []string {
+	var keys []string
+	if userID, ok := ctx.Value(model.ContextUserID).(int); ok {
+		keys = append(keys, "user:"+strconv.Itoa(userID))
+	}
+	if ip, ok := ctx.Value(model.ContextClientIP).(string); ok && ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+
+	return keys
+}
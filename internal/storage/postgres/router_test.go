@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"testing"
+	"time"
+)
+
+func TestRouter(t *testing.T) {
+	master, first, second := &sqlx.DB{}, &sqlx.DB{}, &sqlx.DB{}
+	anonymous := context.Background()
+	reader := context.WithValue(anonymous, model.ContextUserID, 1)
+	other := context.WithValue(anonymous, model.ContextUserID, 2)
+	visitor := context.WithValue(anonymous, model.ContextClientIP, "203.0.113.7")
+	stranger := context.WithValue(anonymous, model.ContextClientIP, "198.51.100.1")
+
+	t.Run("without replicas", func(t *testing.T) {
+		rt := NewRouter(master, nil, time.Minute)
+
+		assert.Same(t, master, rt.reader(anonymous))
+		assert.Same(t, master, rt.reader(reader))
+	})
+
+	t.Run("replicas in turn", func(t *testing.T) {
+		rt := NewRouter(master, []*sqlx.DB{first, second}, time.Minute)
+
+		got := []*sqlx.DB{rt.reader(anonymous), rt.reader(anonymous), rt.reader(reader)}
+		assert.NotSame(t, got[0], got[1])
+		assert.Same(t, got[0], got[2])
+		for _, db := range got {
+			assert.NotSame(t, master, db)
+		}
+	})
+
+	t.Run("read your writes", func(t *testing.T) {
+		rt := NewRouter(master, []*sqlx.DB{first}, 50*time.Millisecond)
+
+		conn(reader, rt)
+		assert.Same(t, master, rt.reader(reader), "the writer reads from the primary")
+		assert.Same(t, first, rt.reader(other), "other users keep to the replica")
+
+		// an anonymous client is known by its IP, also once it has signed in
+		conn(visitor, rt)
+		assert.Same(t, master, rt.reader(visitor))
+		assert.Same(t, master, rt.reader(context.WithValue(visitor, model.ContextUserID, 3)))
+		assert.Same(t, first, rt.reader(stranger))
+
+		// writes outside a request are not tracked
+		conn(anonymous, rt)
+		assert.Same(t, first, rt.reader(anonymous))
+
+		time.Sleep(60 * time.Millisecond)
+		assert.Same(t, first, rt.reader(reader), "back to the replica after the window")
+		assert.Same(t, first, rt.reader(visitor))
+	})
+
+	t.Run("reads from the primary are not writes", func(t *testing.T) {
+		rt := NewRouter(master, []*sqlx.DB{first}, time.Minute)
+
+		primary(reader, rt)
+		assert.Same(t, first, rt.reader(reader))
+	})
+}
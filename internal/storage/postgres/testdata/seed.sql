@@ -0,0 +1,12 @@
+INSERT INTO "user" (fio, email, password, email_verified_at)
+VALUES ('Test Fio Test', 'existsemail@mail.ru', 'hashed_password', CURRENT_TIMESTAMP);
+
+INSERT INTO book (title, author, price)
+VALUES
+    ('Test book', 'Test Author', 13.00),
+    ('Test book2', 'Test Author', 13.00);
+
+INSERT INTO book_issue_history (book_id, quantity, user_id, created_at)
+VALUES
+    (1, 5, 1, '2023-04-18'),
+    (2, 2, 1, '2023-04-18');
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+type txKey struct{}
+
+// querier is what *sqlx.DB and *sqlx.Tx have in common, the stores run their queries on it.
+type querier interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+// conn returns where a write runs: the transaction ctx runs in, or the primary if there is none.
+// The reads of the same client stay on the primary for a while after it.
+func conn(ctx context.Context, db *Router) querier {
+	db.wrote(ctx)
+
+	return primary(ctx, db)
+}
+
+// primary returns where a read that must not lag behind runs: the transaction ctx runs in,
+// or the primary. Unlike conn it is not a write.
+func primary(ctx context.Context, db *Router) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return tx
+	}
+
+	return retryingDB{db.primary}
+}
+
+// replica returns where a read that may lag a little behind the primary runs:
+// the transaction ctx runs in, or the pool the router picks.
+func replica(ctx context.Context, db *Router) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return tx
+	}
+
+	return retryingDB{db.reader(ctx)}
+}
+
+// withinTx runs fn in a transaction which the stores find in the context fn gets.
+// Within a transaction already it joins it, the outermost call commits or rolls back
+// and runs the whole transaction again when it failed on a conflict with another one.
+func withinTx(ctx context.Context, db *Router, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return fn(ctx)
+	}
+
+	return retry(ctx, func() error {
+		return runTx(ctx, db, fn)
+	})
+}
+
+func runTx(ctx context.Context, db *Router, fn func(ctx context.Context) error) error {
+	db.wrote(ctx)
+
+	tx, err := db.primary.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't begin transaction: %w", err)
+	}
+	// a no-op after the commit, it undoes everything when fn fails or panics
+	defer tx.Rollback()
+
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("couldn't commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// TxManager lets the service run several store calls as one unit of work.
+type TxManager struct {
+	db  *Router
+	log *zap.Logger
+}
+
+func NewTxManager(db *Router, logger *zap.Logger) *TxManager {
+	return &TxManager{db: db, log: logger}
+}
+
+// WithinTx runs fn in one transaction, the store calls made with the context fn gets take part in it.
+// An error returned by fn rolls everything back and is returned as it is. Unlike the transactions
+// of the stores it is not run again on a conflict, fn may have done things outside the database.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return fn(ctx)
+	}
+
+	return runTx(ctx, m.db, fn)
+}
@@ -3,87 +3,105 @@ package postgres
 import (
 	"context"
 	"fmt"
-	"github.com/jmoiron/sqlx"
-	"github.com/labstack/gommon/log"
 	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/logger"
 	"go.uber.org/zap"
 )
 
+// _userColumns lists the columns model.User is read from.
+const _userColumns = `id, fio, email, password, role, version, email_verified_at, deleted_at`
+
 type UserStorage struct {
-	db  *sqlx.DB
+	db  *Router
 	log *zap.Logger
 }
 
-func NewUserStorage(db *sqlx.DB, logger *zap.Logger) *UserStorage {
+func NewUserStorage(db *Router, logger *zap.Logger) *UserStorage {
 	return &UserStorage{db: db, log: logger}
 }
 
 func (r *UserStorage) GetUserByID(ctx context.Context, userID int) (model.User, error) {
-	qr := `SELECT * FROM "user" WHERE id = $1 LIMIT 1`
+	qr := `SELECT ` + _userColumns + ` FROM "user" WHERE id = $1 AND deleted_at IS NULL LIMIT 1`
 
 	var user model.User
 
-	if err := r.db.GetContext(ctx, &user, qr, userID); err != nil {
-		return user, fmt.Errorf("couldn't get user bu ID#%v: %w", userID, err)
+	if err := replica(ctx, r.db).GetContext(ctx, &user, qr, userID); err != nil {
+		return user, fmt.Errorf("couldn't get user bu ID#%v: %w", userID, domainError(err, "user"))
 	}
 
 	return user, nil
 }
 
+// GetUserByEmail reads from the primary, sign-in must not miss a just created account or let a deleted one in.
 func (r *UserStorage) GetUserByEmail(ctx context.Context, email string) (model.User, error) {
-	qr := `SELECT * FROM "user" WHERE email = $1`
+	qr := `SELECT ` + _userColumns + ` FROM "user" WHERE email = $1 AND deleted_at IS NULL`
 
 	var user model.User
 
-	if err := r.db.GetContext(ctx, &user, qr, email); err != nil {
-		r.log.Error("Storage: GetUserByEmail error", zap.Error(err))
-		return user, fmt.Errorf("couldn't get user by email#%s: %w", email, err)
+	if err := primary(ctx, r.db).GetContext(ctx, &user, qr, email); err != nil {
+		logger.FromContext(ctx, r.log).Error("Storage: GetUserByEmail error", zap.Error(err))
+		return user, fmt.Errorf("couldn't get user by email#%s: %w", email, domainError(err, "user"))
 	}
 
 	return user, nil
 }
 
 func (r *UserStorage) CreateUser(ctx context.Context, user model.User) (int, error) {
-	qr := `INSERT INTO "user" (fio, email, password) VALUES ($1, $2, $3) RETURNING id`
+	qr := `INSERT INTO "user" (fio, email, password, role) VALUES ($1, $2, $3, $4) RETURNING id`
 
 	var userID int64
 
-	if err := r.db.GetContext(ctx, &userID, qr, user.FIO, user.Email, user.Password); err != nil {
-		log.Error("Storage create user error", zap.Error(err))
-		return 0, fmt.Errorf("couldn't create user: %w", err)
+	if err := conn(ctx, r.db).GetContext(ctx, &userID, qr, user.FIO, user.Email, user.Password, user.Role); err != nil {
+		logger.FromContext(ctx, r.log).Error("Storage create user error", zap.Error(err))
+		return 0, fmt.Errorf("couldn't create user: %w", domainError(err, "user"))
 	}
 
 	return int(userID), nil
 }
 
+// UpdateUserFIO overwrites the FIO only while the version of the user is still user.Version.
 func (r *UserStorage) UpdateUserFIO(ctx context.Context, user model.UserUpdateFIO) (int, error) {
-	qr := `UPDATE "user" SET fio = $2 WHERE id = $1 RETURNING id`
+	qr := `UPDATE "user" SET fio = $2, version = version + 1
+		   WHERE id = $1 AND deleted_at IS NULL AND version = $3 RETURNING id`
 
 	var userID int64
-	if err := r.db.GetContext(ctx, &userID, qr, user.ID, user.FIO); err != nil {
-		return 0, fmt.Errorf("couldn't update user FIO ID#%v: %w", user.ID, err)
+	if err := conn(ctx, r.db).GetContext(ctx, &userID, qr, user.ID, user.FIO, user.Version); err != nil {
+		return 0, fmt.Errorf("couldn't update user FIO ID#%v: %w", user.ID, domainError(err, "user"))
 	}
 
 	return int(userID), nil
 }
 
 func (r *UserStorage) UpdateUserPassword(ctx context.Context, user model.UserUpdatePassword) (int, error) {
-	qr := `UPDATE "user" SET password = $2 WHERE id = $1 RETURNING id`
+	qr := `UPDATE "user" SET password = $2, version = version + 1 WHERE id = $1 AND deleted_at IS NULL RETURNING id`
 
 	var userID int64
-	if err := r.db.GetContext(ctx, &userID, qr, user.ID, user.NewPassword); err != nil {
-		return 0, fmt.Errorf("couldn't update user password ID#%v: %w", user.ID, err)
+	if err := conn(ctx, r.db).GetContext(ctx, &userID, qr, user.ID, user.NewPassword); err != nil {
+		return 0, fmt.Errorf("couldn't update user password ID#%v: %w", user.ID, domainError(err, "user"))
 	}
 
 	return int(userID), nil
 }
 
+// DeleteUser only marks the account as deleted, so the loan history of the reader is kept.
 func (r *UserStorage) DeleteUser(ctx context.Context, userID int) error {
-	qr := `DELETE FROM "user" WHERE id = $1`
+	qr := `UPDATE "user" SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL RETURNING id`
 
-	if _, err := r.db.ExecContext(ctx, qr, userID); err != nil {
-		return fmt.Errorf("couldn't delete user ID#%v: %w", userID, err)
+	var id int64
+	if err := conn(ctx, r.db).GetContext(ctx, &id, qr, userID); err != nil {
+		return fmt.Errorf("couldn't delete user ID#%v: %w", userID, domainError(err, "user"))
 	}
 
 	return nil
 }
+
+func (r *UserStorage) RestoreUser(ctx context.Context, userID int) (int, error) {
+	qr := `UPDATE "user" SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING id`
+
+	var id int64
+	if err := conn(ctx, r.db).GetContext(ctx, &id, qr, userID); err != nil {
+		return 0, fmt.Errorf("couldn't restore user ID#%v: %w", userID, domainError(err, "user"))
+	}
+
+	return int(id), nil
+}
@@ -41,7 +41,7 @@ func TestUserStorage_GetUserByEmail(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 
 			r := &UserStorage{
-				db:  db,
+				db:  NewRouter(db, nil, 0),
 				log: zap.NewExample(),
 			}
 
@@ -95,7 +95,7 @@ func TestUserStorage_CreateUser(t *testing.T) {
 			defer dbContainer.Terminate(context.Background())
 
 			r := &UserStorage{
-				db:  db,
+				db:  NewRouter(db, nil, 0),
 				log: l,
 			}
 			got, err := r.CreateUser(tt.args.ctx, tt.args.user)
@@ -110,7 +110,36 @@ func TestUserStorage_CreateUser(t *testing.T) {
 	}
 }
 
+// SetupTestDatabase starts a database with the schema of the embedded migrations and the rows of testdata/seed.sql.
 func SetupTestDatabase() (testcontainers.Container, *sqlx.DB, error) {
+	dbContainer, db, err := startTestPostgres()
+	if err != nil {
+		return dbContainer, db, err
+	}
+
+	migrator, err := NewMigrator(db, zap.NewNop())
+	if err != nil {
+		return dbContainer, db, err
+	}
+
+	if err = migrator.Up(context.Background()); err != nil {
+		return dbContainer, db, err
+	}
+
+	qr, err := os.ReadFile("./testdata/seed.sql")
+	if err != nil {
+		return dbContainer, db, err
+	}
+
+	if _, err := db.Exec(string(qr)); err != nil {
+		return dbContainer, db, err
+	}
+
+	return dbContainer, db, err
+}
+
+// startTestPostgres starts an empty database.
+func startTestPostgres() (testcontainers.Container, *sqlx.DB, error) {
 	// Create PostgreSQL container request
 	containerReq := testcontainers.ContainerRequest{
 		Image:        "postgres:latest",
@@ -144,22 +173,14 @@ func SetupTestDatabase() (testcontainers.Container, *sqlx.DB, error) {
 		return nil, nil, err
 	}
 
-	// Create db connection string and connect
-	dbURI := fmt.Sprintf("postgres://onelab:qwerty@%v:%v/test_db", host, port.Port())
+	// Create db connection string and connect, the session runs in the zone of the deployment
+	// so comparisons mixing the clocks of Go and the database show up
+	dbURI := fmt.Sprintf("postgres://onelab:qwerty@%v:%v/test_db?TimeZone=Asia/Almaty", host, port.Port())
 
 	db, err := sqlx.Connect("pgx", dbURI)
 	if err != nil {
-		return nil, nil, err
-	}
-
-	qr, err := os.ReadFile("./migrations_test/000001_init.up.sql")
-	if err != nil {
-		return dbContainer, db, err
-	}
-
-	if _, err := db.Exec(string(qr)); err != nil {
-		return dbContainer, db, err
+		return dbContainer, nil, err
 	}
 
-	return dbContainer, db, err
+	return dbContainer, db, nil
 }
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"github.com/zhayt/user-storage-service/config"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// NewRedis returns nil when REDIS_ADDR is not set, the users of Redis fall back to memory then.
+// An unreachable server is only logged, the client keeps reconnecting.
+func NewRedis(ctx context.Context, wg *sync.WaitGroup, logger *zap.Logger, cfg *config.Config) *redis.Client {
+	if cfg.RedisAddr == "" {
+		logger.Info("Redis is not configured")
+		return nil
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr, Password: cfg.RedisPassword, DB: cfg.RedisDB})
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		logger.Warn("Redis is not available", zap.Error(err))
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		logger.Info("Close redis connection")
+		if err := client.Close(); err != nil {
+			logger.Error("Close redis connection error", zap.Error(err))
+		}
+	}()
+
+	return client
+}
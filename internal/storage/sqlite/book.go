@@ -0,0 +1,152 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"go.uber.org/zap"
+)
+
+// _bookColumns lists the columns model.Book is read from.
+const _bookColumns = `id, title, author, price, isbn, version, deleted_at`
+
+type BookStorage struct {
+	db  *sqlx.DB
+	log *zap.Logger
+}
+
+func NewBookStorage(db *sqlx.DB, logger *zap.Logger) *BookStorage {
+	return &BookStorage{db: db, log: logger}
+}
+
+func (r *BookStorage) GetBookByID(ctx context.Context, bookID int) (model.Book, error) {
+	qr := `SELECT ` + _bookColumns + ` FROM book WHERE id = ? AND deleted_at IS NULL`
+
+	var book model.Book
+	if err := conn(ctx, r.db).GetContext(ctx, &book, qr, bookID); err != nil {
+		return book, fmt.Errorf("couldn't take book id#%v: %w", bookID, domainError(err, "book"))
+	}
+
+	return book, nil
+}
+
+func (r *BookStorage) GetAllBooks(ctx context.Context) ([]model.Book, error) {
+	qr := `SELECT ` + _bookColumns + ` FROM book WHERE deleted_at IS NULL`
+
+	var books []model.Book
+
+	if err := conn(ctx, r.db).SelectContext(ctx, &books, qr); err != nil {
+		return books, fmt.Errorf("couldn't take all books: %w", domainError(err, "book"))
+	}
+
+	return books, nil
+}
+
+func (r *BookStorage) IterateBooks(ctx context.Context, fn func(model.Book) error) error {
+	if err := iterate(ctx, conn(ctx, r.db), fn, `SELECT `+_bookColumns+` FROM book WHERE deleted_at IS NULL ORDER BY id`); err != nil {
+		return fmt.Errorf("couldn't iterate books: %w", domainError(err, "book"))
+	}
+
+	return nil
+}
+
+func (r *BookStorage) CreateBook(ctx context.Context, book model.Book) (int, error) {
+	qr := `INSERT INTO book (title, author, price, isbn) VALUES(?, ?, ?, ?) RETURNING id`
+
+	var bookID int64
+	if err := conn(ctx, r.db).GetContext(ctx, &bookID, qr, book.Title, book.Author, book.Price, book.ISBN); err != nil {
+		return 0, fmt.Errorf("couldn't create book: %w", domainError(err, "book"))
+	}
+
+	return int(bookID), nil
+}
+
+// UpdateBook overwrites the book only while its version is still book.Version.
+func (r *BookStorage) UpdateBook(ctx context.Context, book model.Book) (int, error) {
+	qr := `UPDATE book SET title = ?2, author = ?3, price = ?4, isbn = ?5, version = version + 1
+		   WHERE id = ?1 AND deleted_at IS NULL AND version = ?6 RETURNING id`
+
+	var bookID int64
+
+	if err := conn(ctx, r.db).GetContext(ctx, &bookID, qr, book.ID, book.Title, book.Author, book.Price, book.ISBN,
+		book.Version); err != nil {
+		return 0, fmt.Errorf("couldn't update book id#%v: %w", book.ID, domainError(err, "book"))
+	}
+
+	return int(bookID), nil
+}
+
+// UpsertBookByISBN creates the book or overwrites the one with the same ISBN, restoring it if it was deleted.
+// created reports whether a new row was inserted. SQLite has no xmax to tell, so the row is looked up first,
+// the transaction holds the write lock meanwhile.
+func (r *BookStorage) UpsertBookByISBN(ctx context.Context, book model.Book) (int, bool, error) {
+	var (
+		bookID  int64
+		created bool
+	)
+
+	err := withinTx(ctx, r.db, func(ctx context.Context) error {
+		err := conn(ctx, r.db).GetContext(ctx, &bookID, `SELECT id FROM book WHERE isbn = ?1 AND ?1 <> ''`, book.ISBN)
+		created = errors.Is(err, sql.ErrNoRows)
+
+		switch {
+		case created:
+			err = conn(ctx, r.db).GetContext(ctx, &bookID, `INSERT INTO book (title, author, price, isbn) VALUES(?, ?, ?, ?) RETURNING id`,
+				book.Title, book.Author, book.Price, book.ISBN)
+		case err == nil:
+			_, err = conn(ctx, r.db).ExecContext(ctx, `UPDATE book SET title = ?2, author = ?3, price = ?4, deleted_at = NULL,
+				version = version + 1 WHERE id = ?1`, bookID, book.Title, book.Author, book.Price)
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't upsert book isbn#%s: %w", book.ISBN, domainError(err, "book"))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	return int(bookID), created, nil
+}
+
+func (r *BookStorage) HasOpenLoans(ctx context.Context, bookID int) (bool, error) {
+	qr := `SELECT EXISTS (SELECT 1 FROM book_issue_history WHERE book_id = ? AND return_date IS NULL)`
+
+	var exists bool
+	if err := conn(ctx, r.db).GetContext(ctx, &exists, qr, bookID); err != nil {
+		return false, fmt.Errorf("couldn't check open loans of book id#%v: %w", bookID, domainError(err, "book"))
+	}
+
+	return exists, nil
+}
+
+// DeleteBook only marks the book as deleted, its rental history stays for reporting.
+// A book that is still on loan is left untouched and sql.ErrNoRows is returned.
+func (r *BookStorage) DeleteBook(ctx context.Context, bookID int) error {
+	qr := `UPDATE book SET deleted_at = CURRENT_TIMESTAMP
+		   WHERE id = ?1 AND deleted_at IS NULL
+		   AND NOT EXISTS (SELECT 1 FROM book_issue_history WHERE book_id = ?1 AND return_date IS NULL)
+		   RETURNING id`
+
+	var id int64
+	if err := conn(ctx, r.db).GetContext(ctx, &id, qr, bookID); err != nil {
+		return fmt.Errorf("cannot delete book id#%v: %w", bookID, domainError(err, "book"))
+	}
+
+	return nil
+}
+
+func (r *BookStorage) RestoreBook(ctx context.Context, bookID int) (int, error) {
+	qr := `UPDATE book SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL RETURNING id`
+
+	var id int64
+	if err := conn(ctx, r.db).GetContext(ctx, &id, qr, bookID); err != nil {
+		return 0, fmt.Errorf("couldn't restore book id#%v: %w", bookID, domainError(err, "book"))
+	}
+
+	return int(id), nil
+}
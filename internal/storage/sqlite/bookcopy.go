@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"go.uber.org/zap"
+)
+
+type BookCopyStorage struct {
+	db  *sqlx.DB
+	log *zap.Logger
+}
+
+func NewBookCopyStorage(db *sqlx.DB, logger *zap.Logger) *BookCopyStorage {
+	return &BookCopyStorage{db: db, log: logger}
+}
+
+func (r *BookCopyStorage) CreateBookCopy(ctx context.Context, bookCopy model.BookCopy) (int, error) {
+	qr := `INSERT INTO book_copy (book_id, barcode, condition, acquired_at)
+		   VALUES (?1, ?2, ?3, ?4) RETURNING id`
+
+	// acquired_at is a DATE, stored as text it has to be the date alone
+	var copyID int64
+	if err := conn(ctx, r.db).GetContext(ctx, &copyID, qr, bookCopy.BookID, bookCopy.Barcode, bookCopy.Condition,
+		bookCopy.AcquiredAt.Format("2006-01-02")); err != nil {
+		return 0, fmt.Errorf("couldn't create book copy: %w", domainError(err, "book copy"))
+	}
+
+	return int(copyID), nil
+}
+
+func (r *BookCopyStorage) GetBookCopyByBarcode(ctx context.Context, barcode string) (model.BookCopy, error) {
+	qr := `SELECT id, book_id, barcode, condition, acquired_at, status FROM book_copy WHERE barcode = ?1`
+
+	var bookCopy model.BookCopy
+	if err := conn(ctx, r.db).GetContext(ctx, &bookCopy, qr, barcode); err != nil {
+		return bookCopy, fmt.Errorf("couldn't take book copy barcode#%s: %w", barcode, domainError(err, "book copy"))
+	}
+
+	return bookCopy, nil
+}
+
+func (r *BookCopyStorage) GetBookCopies(ctx context.Context, bookID int) ([]model.BookCopy, error) {
+	qr := `SELECT id, book_id, barcode, condition, acquired_at, status FROM book_copy WHERE book_id = ?1 ORDER BY id`
+
+	var copies []model.BookCopy
+	if err := conn(ctx, r.db).SelectContext(ctx, &copies, qr, bookID); err != nil {
+		return copies, fmt.Errorf("couldn't take copies of book id#%v: %w", bookID, domainError(err, "book copy"))
+	}
+
+	return copies, nil
+}
+
+// UpdateBookCopyStatus leaves a copy on loan alone, its rental is still open.
+func (r *BookCopyStorage) UpdateBookCopyStatus(ctx context.Context, bookCopy model.BookCopyUpdateStatus) (int, error) {
+	qr := `UPDATE book_copy SET status = ?2 WHERE barcode = ?1 AND status <> ?3 RETURNING id`
+
+	var copyID int64
+	if err := conn(ctx, r.db).GetContext(ctx, &copyID, qr, bookCopy.Barcode, bookCopy.Status, model.CopyStatusOnLoan); err != nil {
+		return 0, fmt.Errorf("couldn't update book copy barcode#%s: %w", bookCopy.Barcode, domainError(err, "book copy"))
+	}
+
+	return int(copyID), nil
+}
+
+// CheckoutBookCopy marks an available copy as on loan and opens a rental for it.
+// It returns the id of the created book issue history row.
+func (r *BookCopyStorage) CheckoutBookCopy(ctx context.Context, checkout model.Checkout) (int, error) {
+	var bihID int64
+
+	err := withinTx(ctx, r.db, func(ctx context.Context) error {
+		// RETURNING loses the declared column types, the DATE would come back as text, so only the keys are read
+		var bookCopy model.BookCopy
+		if err := conn(ctx, r.db).QueryRowxContext(ctx, `UPDATE book_copy SET status = ?2
+			WHERE barcode = ?1 AND status = ?3
+			AND book_id IN (SELECT id FROM book WHERE deleted_at IS NULL)
+			RETURNING id, book_id`,
+			checkout.Barcode, model.CopyStatusOnLoan, model.CopyStatusAvailable).Scan(&bookCopy.ID, &bookCopy.BookID); err != nil {
+			return fmt.Errorf("couldn't take available book copy barcode#%s: %w", checkout.Barcode, domainError(err, "book copy"))
+		}
+
+		if err := conn(ctx, r.db).GetContext(ctx, &bihID, `INSERT INTO book_issue_history (book_id, copy_id, quantity, user_id)
+			VALUES (?1, ?2, 1, ?3) RETURNING id`, bookCopy.BookID, bookCopy.ID, checkout.UserID); err != nil {
+			return fmt.Errorf("couldn't create book issue history: %w", domainError(err, "book issue history"))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(bihID), nil
+}
+
+// CheckinBookCopy closes the open rental of the copy and puts the copy back on the shelf. With a
+// user set only a rental of that user is closed. It returns the id of the closed book issue history row.
+func (r *BookCopyStorage) CheckinBookCopy(ctx context.Context, checkin model.Checkin) (int, error) {
+	var bihID int64
+
+	err := withinTx(ctx, r.db, func(ctx context.Context) error {
+		var copyID int64
+		if err := conn(ctx, r.db).GetContext(ctx, &copyID, `UPDATE book_copy
+			SET status = ?2, condition = COALESCE(NULLIF(?3, ''), condition)
+			WHERE barcode = ?1 AND status = ?4
+			RETURNING id`,
+			checkin.Barcode, model.CopyStatusAvailable, checkin.Condition, model.CopyStatusOnLoan); err != nil {
+			return fmt.Errorf("couldn't take loaned book copy barcode#%s: %w", checkin.Barcode, domainError(err, "book copy"))
+		}
+
+		if err := conn(ctx, r.db).GetContext(ctx, &bihID, `UPDATE book_issue_history
+			SET return_date = CURRENT_TIMESTAMP
+			WHERE copy_id = ?1 AND return_date IS NULL AND (?2 = 0 OR user_id = ?2)
+			RETURNING id`, copyID, checkin.UserID); err != nil {
+			return fmt.Errorf("couldn't close book issue history of copy id#%v: %w", copyID, domainError(err, "book issue history"))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(bihID), nil
+}
@@ -0,0 +1,30 @@
+package sqlite_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/zhayt/user-storage-service/internal/storage/sqlite"
+	"github.com/zhayt/user-storage-service/internal/storage/storagetest"
+	"go.uber.org/zap"
+	"path/filepath"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Stores {
+		db, err := sqlite.Dial(filepath.Join(t.TempDir(), "library.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+
+		log := zap.NewNop()
+		require.NoError(t, sqlite.Migrate(context.Background(), db, log))
+
+		return storagetest.Stores{
+			Users:   sqlite.NewUserStorage(db, log),
+			Books:   sqlite.NewBookStorage(db, log),
+			History: sqlite.NewBIHistory(db, log),
+			Copies:  sqlite.NewBookCopyStorage(db, log),
+			Tx:      sqlite.NewTxManager(db, log),
+		}
+	})
+}
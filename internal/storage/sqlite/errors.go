@@ -0,0 +1,33 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/mattn/go-sqlite3"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+)
+
+// domainError turns driver errors into domain errors, entity names the record in the client message.
+// The kinds are the ones postgres gives for the same constraints. Other errors are returned as they are
+// and end up as internal ones.
+func domainError(err error, entity string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperror.Wrap(apperror.NotFound, entity+" not found", err)
+	}
+
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return apperror.Wrap(apperror.AlreadyExists, entity+" already exists", err)
+	case sqlite3.ErrConstraintForeignKey:
+		return apperror.Wrap(apperror.Conflict, entity+" refers to a missing record or is still referenced", err)
+	case sqlite3.ErrConstraintCheck, sqlite3.ErrConstraintNotNull:
+		return apperror.Wrap(apperror.Validation, entity+" has invalid data", err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,101 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-storage-service/internal/storage/migration"
+	"go.uber.org/zap"
+)
+
+// The migrations are embedded, the binary brings the schema it was built for.
+// Their bookkeeping is the one of the migrate CLI, like for Postgres.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const _migrationsTable = "schema_migrations"
+
+var ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+// Migrations returns the embedded migrations ordered by version.
+func Migrations() ([]migration.Migration, error) {
+	return migration.Read(migrationFiles, "migrations")
+}
+
+// Migrate applies the pending migrations, each within its own transaction. A branch has nobody
+// to run them by hand, so they always run on start. A dirty database or one newer than the build is refused.
+func Migrate(ctx context.Context, db *sqlx.DB, logger *zap.Logger) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return fmt.Errorf("couldn't read migrations: %w", err)
+	}
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+_migrationsTable+
+		` (version INTEGER NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`); err != nil {
+		return fmt.Errorf("couldn't create %s: %w", _migrationsTable, err)
+	}
+
+	var latest uint
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+
+	for _, m := range migrations {
+		applied, err := apply(ctx, db, m, latest)
+		if err != nil {
+			return fmt.Errorf("couldn't apply migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		if applied {
+			logger.Info("Migration applied", zap.Uint("version", m.Version), zap.String("name", m.Name))
+		}
+	}
+
+	return nil
+}
+
+// apply runs the migration unless the database already has it. The version is read within the
+// transaction, which holds the write lock from its start, so two processes never apply one migration twice.
+func apply(ctx context.Context, db *sqlx.DB, m migration.Migration, latest uint) (bool, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var (
+		version uint
+		dirty   bool
+	)
+	err = tx.QueryRowxContext(ctx, `SELECT version, dirty FROM `+_migrationsTable+` LIMIT 1`).Scan(&version, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("couldn't read schema version: %w", err)
+	}
+
+	switch {
+	case dirty:
+		return false, fmt.Errorf("database schema version %d is dirty, fix it by hand and force the version", version)
+	case version > latest:
+		return false, fmt.Errorf("%w: database is at version %d, this build knows up to %d", ErrSchemaTooNew, version, latest)
+	case m.Version <= version:
+		return false, nil
+	}
+
+	if _, err = tx.ExecContext(ctx, m.Up); err != nil {
+		return false, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM `+_migrationsTable); err != nil {
+		return false, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `INSERT INTO `+_migrationsTable+` (version, dirty) VALUES (?, false)`, m.Version); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"path/filepath"
+	"testing"
+)
+
+// openTestDB opens a migrated database in a file of its own, it is removed after the test.
+func openTestDB(t *testing.T) *sqlx.DB {
+	db, err := Dial(filepath.Join(t.TempDir(), "library.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	require.NoError(t, Migrate(context.Background(), db, zap.NewNop()))
+
+	return db
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+
+	for i, m := range migrations {
+		assert.Equal(t, uint(i+1), m.Version, "versions go one by one")
+		assert.NotEmpty(t, m.Name)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	var mode string
+	require.NoError(t, db.GetContext(ctx, &mode, `PRAGMA journal_mode`))
+	assert.Equal(t, "wal", mode)
+
+	var foreignKeys bool
+	require.NoError(t, db.GetContext(ctx, &foreignKeys, `PRAGMA foreign_keys`))
+	assert.True(t, foreignKeys)
+
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	latest := migrations[len(migrations)-1].Version
+
+	// a second start finds nothing to do
+	require.NoError(t, Migrate(ctx, db, zap.NewNop()))
+
+	var version uint
+	require.NoError(t, db.GetContext(ctx, &version, `SELECT version FROM schema_migrations`))
+	assert.Equal(t, latest, version)
+
+	_, err = db.ExecContext(ctx, `UPDATE schema_migrations SET version = ?`, latest+1)
+	require.NoError(t, err)
+	assert.ErrorIs(t, Migrate(ctx, db, zap.NewNop()), ErrSchemaTooNew)
+
+	_, err = db.ExecContext(ctx, `UPDATE schema_migrations SET version = ?, dirty = true`, latest)
+	require.NoError(t, err)
+	assert.Error(t, Migrate(ctx, db, zap.NewNop()))
+}
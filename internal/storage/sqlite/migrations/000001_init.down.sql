@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS email_outbox;
+DROP TABLE IF EXISTS email_verification_token;
+DROP TABLE IF EXISTS password_reset_token;
+DROP TABLE IF EXISTS book_issue_history;
+DROP TABLE IF EXISTS book_copy;
+DROP TABLE IF EXISTS book;
+DROP TABLE IF EXISTS "user";
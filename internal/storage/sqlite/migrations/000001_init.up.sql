@@ -0,0 +1,78 @@
+-- the schema of the Postgres migrations up to 000009, SQLite does not check VARCHAR lengths
+-- so the limits are CHECK constraints here
+
+CREATE TABLE IF NOT EXISTS "user" (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    fio TEXT NOT NULL CHECK (length(fio) <= 70),
+    email TEXT NOT NULL CHECK (length(email) <= 50),
+    password TEXT NOT NULL CHECK (length(password) <= 60),
+    role TEXT NOT NULL DEFAULT 'reader' CHECK (role IN ('reader', 'admin')),
+    version INTEGER NOT NULL DEFAULT 1,
+    email_verified_at TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_email_key ON "user" (email) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS book (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL CHECK (length(title) <= 50),
+    author TEXT NOT NULL CHECK (length(author) <= 70),
+    price REAL NOT NULL DEFAULT 0 CHECK (price >= 0),
+    isbn TEXT NOT NULL DEFAULT '' CHECK (length(isbn) <= 13),
+    version INTEGER NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS book_isbn_key ON book (isbn) WHERE isbn <> '';
+
+CREATE TABLE IF NOT EXISTS book_copy (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    book_id INTEGER NOT NULL REFERENCES book (id) ON DELETE CASCADE,
+    barcode TEXT UNIQUE NOT NULL CHECK (length(barcode) <= 32),
+    condition TEXT NOT NULL DEFAULT 'good' CHECK (length(condition) <= 50),
+    acquired_at DATE NOT NULL DEFAULT CURRENT_DATE,
+    status TEXT NOT NULL DEFAULT 'available'
+        CHECK (status IN ('available', 'on_loan', 'lost', 'withdrawn'))
+);
+
+CREATE TABLE IF NOT EXISTS book_issue_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    book_id INTEGER NOT NULL REFERENCES book (id) ON DELETE RESTRICT,
+    user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE RESTRICT,
+    copy_id INTEGER REFERENCES book_copy (id),
+    quantity INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    return_date TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS password_reset_token (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+    token_hash TEXT UNIQUE NOT NULL CHECK (length(token_hash) <= 64),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS email_verification_token (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+    token_hash TEXT UNIQUE NOT NULL CHECK (length(token_hash) <= 64),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    recipient TEXT NOT NULL CHECK (length(recipient) <= 50),
+    subject TEXT NOT NULL CHECK (length(subject) <= 255),
+    body TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS email_outbox_pending_idx ON email_outbox (id) WHERE sent_at IS NULL;
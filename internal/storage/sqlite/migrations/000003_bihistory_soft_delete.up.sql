@@ -0,0 +1,2 @@
+-- deleting a rental marks it, the row stays in the history
+ALTER TABLE book_issue_history ADD COLUMN deleted_at TIMESTAMP;
@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+type OutboxStorage struct {
+	db  *sqlx.DB
+	log *zap.Logger
+}
+
+func NewOutboxStorage(db *sqlx.DB, logger *zap.Logger) *OutboxStorage {
+	return &OutboxStorage{db: db, log: logger}
+}
+
+// ClaimPendingEmails returns the oldest emails which are not sent yet, have attempts left and
+// are not claimed by another dispatcher, and claims them for lease. Marking an email sent or failed
+// ends the claim, one whose dispatcher died is picked up again once the lease runs out.
+func (r *OutboxStorage) ClaimPendingEmails(ctx context.Context, maxAttempts, limit int, lease time.Duration) ([]model.OutboxEmail, error) {
+	qr := `UPDATE email_outbox SET claimed_until = ?3
+		   WHERE id IN (SELECT id FROM email_outbox
+		                WHERE sent_at IS NULL AND attempts < ?1
+		                  AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP)
+		                ORDER BY id LIMIT ?2)
+		   RETURNING id, recipient, subject, body, attempts, created_at`
+
+	var emails []model.OutboxEmail
+	if err := conn(ctx, r.db).SelectContext(ctx, &emails, qr, maxAttempts, limit, timestamp(time.Now().Add(lease))); err != nil {
+		return nil, fmt.Errorf("couldn't claim pending emails: %w", domainError(err, "email"))
+	}
+
+	sort.Slice(emails, func(i, j int) bool { return emails[i].ID < emails[j].ID })
+
+	return emails, nil
+}
+
+// MarkEmailSent blanks the body as well, it may hold a one-time link which must not outlive the sending.
+func (r *OutboxStorage) MarkEmailSent(ctx context.Context, emailID int) error {
+	qr := `UPDATE email_outbox SET sent_at = CURRENT_TIMESTAMP, attempts = attempts + 1, body = '', claimed_until = NULL
+		   WHERE id = ?1`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, qr, emailID); err != nil {
+		return fmt.Errorf("couldn't mark email ID#%v sent: %w", emailID, domainError(err, "email"))
+	}
+
+	return nil
+}
+
+func (r *OutboxStorage) MarkEmailFailed(ctx context.Context, emailID int, reason string) error {
+	qr := `UPDATE email_outbox SET attempts = attempts + 1, last_error = ?2, claimed_until = NULL WHERE id = ?1`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, qr, emailID, reason); err != nil {
+		return fmt.Errorf("couldn't mark email ID#%v failed: %w", emailID, domainError(err, "email"))
+	}
+
+	return nil
+}
+
+// PurgeEmails deletes the emails sent longer than retention ago and the ones which ran out of attempts.
+func (r *OutboxStorage) PurgeEmails(ctx context.Context, maxAttempts int, retention time.Duration) (int64, error) {
+	qr := `DELETE FROM email_outbox WHERE sent_at < ?2 OR (sent_at IS NULL AND attempts >= ?1)`
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, qr, maxAttempts, timestamp(time.Now().Add(-retention)))
+	if err != nil {
+		return 0, fmt.Errorf("couldn't purge emails: %w", domainError(err, "email"))
+	}
+
+	return res.RowsAffected()
+}
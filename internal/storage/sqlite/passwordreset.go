@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"go.uber.org/zap"
+	"time"
+)
+
+type PasswordResetStorage struct {
+	db  *sqlx.DB
+	log *zap.Logger
+}
+
+func NewPasswordResetStorage(db *sqlx.DB, logger *zap.Logger) *PasswordResetStorage {
+	return &PasswordResetStorage{db: db, log: logger}
+}
+
+// CreatePasswordResetToken replaces the unused tokens of the user with the new one and queues the email
+// carrying it, both are written or neither is.
+func (r *PasswordResetStorage) CreatePasswordResetToken(ctx context.Context, token model.PasswordResetToken, email model.OutboxEmail) error {
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE password_reset_token SET expires_at = CURRENT_TIMESTAMP
+			WHERE user_id = ?1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP`, token.UserID); err != nil {
+			return fmt.Errorf("couldn't expire password reset tokens of user ID#%v: %w", token.UserID, domainError(err, "password reset token"))
+		}
+
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `INSERT INTO password_reset_token (user_id, token_hash, expires_at) VALUES (?1, ?2, ?3)`,
+			token.UserID, token.TokenHash, timestamp(time.Now().Add(token.TTL))); err != nil {
+			return fmt.Errorf("couldn't create password reset token: %w", domainError(err, "password reset token"))
+		}
+
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `INSERT INTO email_outbox (recipient, subject, body) VALUES (?1, ?2, ?3)`,
+			email.Recipient, email.Subject, email.Body); err != nil {
+			return fmt.Errorf("couldn't queue email: %w", domainError(err, "email"))
+		}
+
+		return nil
+	})
+}
+
+// ResetPassword spends a live token and sets the new password of its user. It returns the user id.
+func (r *PasswordResetStorage) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	var userID int64
+
+	err := withinTx(ctx, r.db, func(ctx context.Context) error {
+		if err := conn(ctx, r.db).GetContext(ctx, &userID, `UPDATE password_reset_token SET used_at = CURRENT_TIMESTAMP
+			WHERE token_hash = ?1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+			RETURNING user_id`, tokenHash); err != nil {
+			return fmt.Errorf("couldn't use password reset token: %w", domainError(err, "password reset token"))
+		}
+
+		if err := conn(ctx, r.db).GetContext(ctx, &userID, `UPDATE "user" SET password = ?2, version = version + 1
+			WHERE id = ?1 AND deleted_at IS NULL RETURNING id`, userID, passwordHash); err != nil {
+			return fmt.Errorf("couldn't update user password ID#%v: %w", userID, domainError(err, "user"))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(userID), nil
+}
@@ -0,0 +1,147 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStorageMatchesSchema runs every storage query once against the schema of the embedded migrations,
+// a column renamed on one side only, a struct field without a column or a Postgres only construct fails it.
+func TestStorageMatchesSchema(t *testing.T) {
+	db := openTestDB(t)
+
+	ctx := context.Background()
+	log := zap.NewNop()
+
+	users := NewUserStorage(db, log)
+	books := NewBookStorage(db, log)
+	copies := NewBookCopyStorage(db, log)
+	history := NewBIHistory(db, log)
+	resets := NewPasswordResetStorage(db, log)
+	verifications := NewEmailVerificationStorage(db, log)
+	outbox := NewOutboxStorage(db, log)
+
+	noop := func(interface{}) error { return nil }
+
+	var (
+		userID, bookID, loanID int
+		emails                 []model.OutboxEmail
+	)
+	resetHash, verifyHash := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	email := model.OutboxEmail{Recipient: "schema@mail.ru", Subject: "subject", Body: "body"}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"CreateUser", func() (err error) {
+			userID, err = users.CreateUser(ctx, model.User{FIO: "Schema Test", Email: "schema@mail.ru", Password: "hash", Role: model.RoleReader})
+			return err
+		}},
+		{"GetUserByID", func() error { _, err := users.GetUserByID(ctx, userID); return err }},
+		{"GetUserByEmail", func() error { _, err := users.GetUserByEmail(ctx, "schema@mail.ru"); return err }},
+		{"UpdateUserFIO", func() error {
+			_, err := users.UpdateUserFIO(ctx, model.UserUpdateFIO{ID: userID, FIO: "Schema Test Two", Version: 1})
+			return err
+		}},
+		{"UpdateUserPassword", func() error {
+			_, err := users.UpdateUserPassword(ctx, model.UserUpdatePassword{ID: userID, NewPassword: "hash2"})
+			return err
+		}},
+
+		{"CreateBook", func() (err error) {
+			bookID, err = books.CreateBook(ctx, model.Book{Title: "Schema", Author: "Author", Price: 1, ISBN: "9780306406157"})
+			return err
+		}},
+		{"GetBookByID", func() error { _, err := books.GetBookByID(ctx, bookID); return err }},
+		{"GetAllBooks", func() error { _, err := books.GetAllBooks(ctx); return err }},
+		{"IterateBooks", func() error { return books.IterateBooks(ctx, func(b model.Book) error { return noop(b) }) }},
+		{"UpdateBook", func() error {
+			_, err := books.UpdateBook(ctx, model.Book{ID: bookID, Title: "Schema Two", Author: "Author", Price: 2, ISBN: "9780306406157", Version: 1})
+			return err
+		}},
+		{"UpsertBookByISBN", func() error {
+			_, _, err := books.UpsertBookByISBN(ctx, model.Book{Title: "Schema Three", Author: "Author", Price: 3, ISBN: "9780306406157"})
+			return err
+		}},
+		{"HasOpenLoans", func() error { _, err := books.HasOpenLoans(ctx, bookID); return err }},
+
+		{"CreateBookCopy", func() error {
+			_, err := copies.CreateBookCopy(ctx, model.BookCopy{BookID: bookID, Barcode: "SCHEMA-1", Condition: "good", AcquiredAt: time.Now()})
+			return err
+		}},
+		{"GetBookCopyByBarcode", func() error { _, err := copies.GetBookCopyByBarcode(ctx, "SCHEMA-1"); return err }},
+		{"GetBookCopies", func() error { _, err := copies.GetBookCopies(ctx, bookID); return err }},
+		{"CheckoutBookCopy", func() error {
+			_, err := copies.CheckoutBookCopy(ctx, model.Checkout{Barcode: "SCHEMA-1", UserID: userID})
+			return err
+		}},
+		{"CheckinBookCopy", func() error {
+			_, err := copies.CheckinBookCopy(ctx, model.Checkin{Barcode: "SCHEMA-1", Condition: "worn"})
+			return err
+		}},
+		{"UpdateBookCopyStatus", func() error {
+			_, err := copies.UpdateBookCopyStatus(ctx, model.BookCopyUpdateStatus{Barcode: "SCHEMA-1", Status: model.CopyStatusLost})
+			return err
+		}},
+
+		{"CreateBIHistory", func() error {
+			return history.CreateBIHistory(ctx, model.BIHistory{UserID: userID, Books: []*model.RentalBooks{{ID: bookID, Quantity: 1}}})
+		}},
+		{"GetCurrentBorrowedBooks", func() error {
+			loans, err := history.GetCurrentBorrowedBooks(ctx)
+			for _, loan := range loans {
+				if loan.BookName == "Schema Three" {
+					loanID = loan.ID
+				}
+			}
+			return err
+		}},
+		{"GetBIHistoryLastMonth", func() error { _, err := history.GetBIHistoryLastMonth(ctx); return err }},
+		{"IterateCurrentBorrowedBooks", func() error {
+			return history.IterateCurrentBorrowedBooks(ctx, func(b model.BorrowedBooks) error { return noop(b) })
+		}},
+		{"IterateBIHistoryLastMonth", func() error {
+			return history.IterateBIHistoryLastMonth(ctx, func(b model.BorrowedBooks) error { return noop(b) })
+		}},
+		{"CountOverdueLoans", func() error { _, err := history.CountOverdueLoans(ctx, 0); return err }},
+		{"UpdateBIHistory", func() error { _, err := history.UpdateBIHistory(ctx, loanID); return err }},
+		{"DeleteBIHistory", func() error { return history.DeleteBIHistory(ctx, loanID) }},
+
+		{"CreatePasswordResetToken", func() error {
+			return resets.CreatePasswordResetToken(ctx, model.PasswordResetToken{UserID: userID, TokenHash: resetHash, TTL: time.Hour}, email)
+		}},
+		{"ResetPassword", func() error { _, err := resets.ResetPassword(ctx, resetHash, "hash3"); return err }},
+		{"CreateEmailVerificationToken", func() error {
+			return verifications.CreateEmailVerificationToken(ctx, model.EmailVerificationToken{UserID: userID, TokenHash: verifyHash, TTL: time.Hour}, email)
+		}},
+		{"CountEmailVerificationTokens", func() error {
+			count, err := verifications.CountEmailVerificationTokens(ctx, userID, time.Minute)
+			if err == nil && count != 1 {
+				return fmt.Errorf("got %d tokens issued within a minute, want 1", count)
+			}
+			return err
+		}},
+		{"VerifyEmail", func() error { _, err := verifications.VerifyEmail(ctx, verifyHash); return err }},
+		{"ClaimPendingEmails", func() (err error) { emails, err = outbox.ClaimPendingEmails(ctx, 5, 10, time.Minute); return err }},
+		{"MarkEmailSent", func() error { return outbox.MarkEmailSent(ctx, emails[0].ID) }},
+		{"MarkEmailFailed", func() error { return outbox.MarkEmailFailed(ctx, emails[1].ID, "mailbox is full") }},
+		{"PurgeEmails", func() error { _, err := outbox.PurgeEmails(ctx, 5, 0); return err }},
+
+		{"DeleteUser", func() error { return users.DeleteUser(ctx, userID) }},
+		{"RestoreUser", func() error { _, err := users.RestoreUser(ctx, userID); return err }},
+		{"DeleteBook", func() error { return books.DeleteBook(ctx, bookID) }},
+		{"RestoreBook", func() error { _, err := books.RestoreBook(ctx, bookID); return err }},
+	}
+
+	// the steps build on each other, the first failure stops the run
+	for _, step := range steps {
+		require.NoError(t, step.run(), step.name)
+	}
+}
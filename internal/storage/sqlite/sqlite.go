@@ -0,0 +1,73 @@
+// Package sqlite stores the data in one SQLite file, for branches without a Postgres server.
+// The queries follow the Postgres ones, the differences of the dialect are noted where they matter.
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	_timeOut = 5 * time.Second
+	// _timestampLayout is how CURRENT_TIMESTAMP writes UTC time, the timestamps are compared as text.
+	_timestampLayout = "2006-01-02 15:04:05"
+)
+
+// Dial opens the database file, creating it if needed. WAL lets the readers go on while a writer works,
+// transactions take the write lock when they begin, so two of them never deadlock upgrading their locks.
+func Dial(path string) (*sqlx.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create db directory: %w", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_synchronous=NORMAL&_foreign_keys=on&_busy_timeout=%d&_txlock=immediate",
+		path, _timeOut.Milliseconds())
+
+	db, err := sqlx.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connot open db: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), _timeOut)
+	defer cancel()
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot open db file %s: %w", path, err)
+	}
+
+	return db, nil
+}
+
+// timestamp formats t for comparisons with the TIMESTAMP columns.
+func timestamp(t time.Time) string {
+	return t.UTC().Format(_timestampLayout)
+}
+
+// iterate scans the rows of the query one at a time and passes each to fn,
+// so large result sets are streamed instead of being collected into a slice.
+func iterate[T any](ctx context.Context, q querier, fn func(T) error, qr string, args ...interface{}) error {
+	rows, err := q.QueryxContext(ctx, qr, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item T
+		if err = rows.StructScan(&item); err != nil {
+			return err
+		}
+
+		if err = fn(item); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+type txKey struct{}
+
+// querier is what *sqlx.DB and *sqlx.Tx have in common, the stores run their queries on it.
+type querier interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+// conn returns the transaction ctx runs in, or the pool if there is none.
+func conn(ctx context.Context, db *sqlx.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return tx
+	}
+
+	return db
+}
+
+// withinTx runs fn in a transaction which the stores find in the context fn gets.
+// Within a transaction already it joins it, the outermost call commits or rolls back.
+func withinTx(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't begin transaction: %w", err)
+	}
+	// a no-op after the commit, it undoes everything when fn fails or panics
+	defer tx.Rollback()
+
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("couldn't commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// TxManager lets the service run several store calls as one unit of work.
+type TxManager struct {
+	db  *sqlx.DB
+	log *zap.Logger
+}
+
+func NewTxManager(db *sqlx.DB, logger *zap.Logger) *TxManager {
+	return &TxManager{db: db, log: logger}
+}
+
+// WithinTx runs fn in one transaction, the store calls made with the context fn gets take part in it.
+// An error returned by fn rolls everything back and is returned as it is.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withinTx(ctx, m.db, fn)
+}
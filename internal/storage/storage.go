@@ -2,11 +2,17 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
 	"github.com/zhayt/user-storage-service/config"
+	"github.com/zhayt/user-storage-service/internal/metrics"
 	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/storage/inmemory"
 	"github.com/zhayt/user-storage-service/internal/storage/postgres"
+	"github.com/zhayt/user-storage-service/internal/storage/sqlite"
 	"go.uber.org/zap"
 	"sync"
+	"time"
 )
 
 type IUserStorage interface {
@@ -16,52 +22,263 @@ type IUserStorage interface {
 	UpdateUserFIO(ctx context.Context, user model.UserUpdateFIO) (int, error)
 	UpdateUserPassword(ctx context.Context, user model.UserUpdatePassword) (int, error)
 	DeleteUser(ctx context.Context, userID int) error
+	RestoreUser(ctx context.Context, userID int) (int, error)
 }
 
 type IBookStorage interface {
 	GetBookByID(ctx context.Context, bookID int) (model.Book, error)
 	GetAllBooks(ctx context.Context) ([]model.Book, error)
+	IterateBooks(ctx context.Context, fn func(model.Book) error) error
 	CreateBook(ctx context.Context, book model.Book) (int, error)
 	UpdateBook(ctx context.Context, book model.Book) (int, error)
+	UpsertBookByISBN(ctx context.Context, book model.Book) (int, bool, error)
+	HasOpenLoans(ctx context.Context, bookID int) (bool, error)
 	DeleteBook(ctx context.Context, bookID int) error
+	RestoreBook(ctx context.Context, bookID int) (int, error)
 }
 
 type IBIHistoryStorage interface {
 	GetCurrentBorrowedBooks(ctx context.Context) ([]model.BorrowedBooks, error)
 	GetBIHistoryLastMonth(ctx context.Context) ([]model.BorrowedBooks, error)
+	IterateCurrentBorrowedBooks(ctx context.Context, fn func(model.BorrowedBooks) error) error
+	IterateBIHistoryLastMonth(ctx context.Context, fn func(model.BorrowedBooks) error) error
 	CreateBIHistory(ctx context.Context, bIHistory model.BIHistory) error
 	UpdateBIHistory(ctx context.Context, bIHistoryID int) (int, error)
+	CountOverdueLoans(ctx context.Context, loanPeriod time.Duration) (int, error)
 	DeleteBIHistory(ctx context.Context, bIHistoryID int) error
 }
 
+type IBookCopyStorage interface {
+	CreateBookCopy(ctx context.Context, bookCopy model.BookCopy) (int, error)
+	GetBookCopyByBarcode(ctx context.Context, barcode string) (model.BookCopy, error)
+	GetBookCopies(ctx context.Context, bookID int) ([]model.BookCopy, error)
+	UpdateBookCopyStatus(ctx context.Context, bookCopy model.BookCopyUpdateStatus) (int, error)
+	CheckoutBookCopy(ctx context.Context, checkout model.Checkout) (int, error)
+	CheckinBookCopy(ctx context.Context, checkin model.Checkin) (int, error)
+}
+
+type IPasswordResetStorage interface {
+	CreatePasswordResetToken(ctx context.Context, token model.PasswordResetToken, email model.OutboxEmail) error
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error)
+}
+
+type IEmailVerificationStorage interface {
+	CountEmailVerificationTokens(ctx context.Context, userID int, within time.Duration) (int, error)
+	CreateEmailVerificationToken(ctx context.Context, token model.EmailVerificationToken, email model.OutboxEmail) error
+	VerifyEmail(ctx context.Context, tokenHash string) (int, error)
+}
+
+type IOutboxStorage interface {
+	ClaimPendingEmails(ctx context.Context, maxAttempts, limit int, lease time.Duration) ([]model.OutboxEmail, error)
+	MarkEmailSent(ctx context.Context, emailID int) error
+	MarkEmailFailed(ctx context.Context, emailID int, reason string) error
+	PurgeEmails(ctx context.Context, maxAttempts int, retention time.Duration) (int64, error)
+}
+
+// ITxManager runs several store calls as one unit of work, the stores take part in it through the context.
+type ITxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
 type Storage struct {
 	IUserStorage
 	IBookStorage
 	IBIHistoryStorage
+	IBookCopyStorage
+	IPasswordResetStorage
+	IEmailVerificationStorage
+	IOutboxStorage
+	ITxManager
+	// db is nil for the in-memory backend
+	db *sqlx.DB
+}
+
+// PostgresOptions picks the pool and connection settings out of the config.
+func PostgresOptions(cfg *config.Config) postgres.Options {
+	return postgres.Options{
+		MaxOpenConns:     cfg.DBMaxOpenConns,
+		MaxIdleConns:     cfg.DBMaxIdleConns,
+		ConnMaxLifetime:  cfg.DBConnMaxLifetime,
+		ConnMaxIdleTime:  cfg.DBConnMaxIdleTime,
+		StatementTimeout: cfg.DBStatementTimeout,
+		ApplicationName:  cfg.DBApplicationName,
+		ConnectTimeout:   cfg.DBConnectTimeout,
+	}
+}
+
+// migrate brings the schema up to date if PG_MIGRATE is on and refuses one newer than this build.
+func migrate(ctx context.Context, logger *zap.Logger, cfg *config.Config, db *sqlx.DB) error {
+	migrator, err := postgres.NewMigrator(db, logger)
+	if err != nil {
+		return err
+	}
+
+	if cfg.DBMigrate {
+		if err = migrator.Up(ctx); err != nil {
+			return err
+		}
+	}
+
+	return migrator.Check(ctx)
+}
+
+// Ping checks that the database answers, for the readiness probe.
+func (s *Storage) Ping(ctx context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.PingContext(ctx)
 }
 
+// NewStorage builds the stores of the backend STORAGE_DRIVER names.
 func NewStorage(ctx context.Context, wg *sync.WaitGroup, logger *zap.Logger, cfg *config.Config) (*Storage, error) {
-	db, err := postgres.Dial("pgx", cfg.DBConnectionURL)
+	switch cfg.StorageDriver {
+	case DriverPostgres:
+		return newPostgresStorage(ctx, wg, logger, cfg)
+	case DriverSQLite:
+		return newSQLiteStorage(ctx, wg, logger, cfg)
+	case DriverMemory:
+		logger.Warn("In-memory storage, the data is lost on restart")
+		return newMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}
+
+func newMemoryStorage() *Storage {
+	db := inmemory.New()
+
+	return &Storage{
+		IUserStorage:              inmemory.NewUserStorage(db),
+		IBookStorage:              inmemory.NewBookStorage(db),
+		IBIHistoryStorage:         inmemory.NewBIHistory(db),
+		IBookCopyStorage:          inmemory.NewBookCopyStorage(db),
+		IPasswordResetStorage:     inmemory.NewPasswordResetStorage(db),
+		IEmailVerificationStorage: inmemory.NewEmailVerificationStorage(db),
+		IOutboxStorage:            inmemory.NewOutboxStorage(db),
+		ITxManager:                inmemory.NewTxManager(db),
+	}
+}
+
+func newSQLiteStorage(ctx context.Context, wg *sync.WaitGroup, logger *zap.Logger, cfg *config.Config) (*Storage, error) {
+	db, err := sqlite.Dial(cfg.SQLitePath)
 	if err != nil {
 		logger.Error("Dial error", zap.Error(err))
 		return nil, err
 	}
 
+	if err = sqlite.Migrate(ctx, db, logger); err != nil {
+		logger.Error("Migrate error", zap.Error(err))
+		db.Close()
+		return nil, err
+	}
+
+	if err = metrics.RegisterDB(db.DB, "sqlite"); err != nil {
+		logger.Error("Register db metrics error", zap.Error(err))
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		logger.Info("Close db file")
+		if err := db.Close(); err != nil {
+			logger.Error("Close db file error", zap.Error(err))
+		}
+	}()
+
+	return &Storage{
+		IUserStorage:              sqlite.NewUserStorage(db, logger),
+		IBookStorage:              sqlite.NewBookStorage(db, logger),
+		IBIHistoryStorage:         sqlite.NewBIHistory(db, logger),
+		IBookCopyStorage:          sqlite.NewBookCopyStorage(db, logger),
+		IPasswordResetStorage:     sqlite.NewPasswordResetStorage(db, logger),
+		IEmailVerificationStorage: sqlite.NewEmailVerificationStorage(db, logger),
+		IOutboxStorage:            sqlite.NewOutboxStorage(db, logger),
+		ITxManager:                sqlite.NewTxManager(db, logger),
+		db:                        db,
+	}, nil
+}
+
+func newPostgresStorage(ctx context.Context, wg *sync.WaitGroup, logger *zap.Logger, cfg *config.Config) (*Storage, error) {
+	db, err := postgres.Dial(ctx, "pgx", cfg.DBConnectionURL, PostgresOptions(cfg), logger)
+	if err != nil {
+		logger.Error("Dial error", zap.Error(err))
+		return nil, err
+	}
+
+	if err = migrate(ctx, logger, cfg, db); err != nil {
+		logger.Error("Migrate error", zap.Error(err))
+		db.Close()
+		return nil, err
+	}
+
+	replicas, err := dialReplicas(ctx, logger, cfg)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err = metrics.RegisterDB(db.DB, "postgres"); err != nil {
+		logger.Error("Register db metrics error", zap.Error(err))
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		select {
 		case <-ctx.Done():
 			logger.Info("Close db pool connection")
-			if err := db.Close(); err != nil {
-				logger.Error("Close pool connection error", zap.Error(err))
+			for _, pool := range append([]*sqlx.DB{db}, replicas...) {
+				if err := pool.Close(); err != nil {
+					logger.Error("Close pool connection error", zap.Error(err))
+				}
 			}
 		}
 	}()
 
+	router := postgres.NewRouter(db, replicas, cfg.DBReadYourWrites)
+
 	return &Storage{
-		IUserStorage:      postgres.NewUserStorage(db, logger),
-		IBookStorage:      postgres.NewBookStorage(db, logger),
-		IBIHistoryStorage: postgres.NewBIHistory(db, logger),
+		IUserStorage:              postgres.NewUserStorage(router, logger),
+		IBookStorage:              postgres.NewBookStorage(router, logger),
+		IBIHistoryStorage:         postgres.NewBIHistory(router, logger),
+		IBookCopyStorage:          postgres.NewBookCopyStorage(router, logger),
+		IPasswordResetStorage:     postgres.NewPasswordResetStorage(router, logger),
+		IEmailVerificationStorage: postgres.NewEmailVerificationStorage(router, logger),
+		IOutboxStorage:            postgres.NewOutboxStorage(router, logger),
+		ITxManager:                postgres.NewTxManager(router, logger),
+		db:                        db,
 	}, nil
 }
+
+// dialReplicas opens the pools of the read replicas, the migrations reach them from the primary.
+func dialReplicas(ctx context.Context, logger *zap.Logger, cfg *config.Config) ([]*sqlx.DB, error) {
+	replicas := make([]*sqlx.DB, 0, len(cfg.DBReplicaURLs))
+
+	for i, dsn := range cfg.DBReplicaURLs {
+		replica, err := postgres.Dial(ctx, "pgx", dsn, PostgresOptions(cfg), logger)
+		if err != nil {
+			logger.Error("Dial replica error", zap.Int("replica", i+1), zap.Error(err))
+			for _, r := range replicas {
+				r.Close()
+			}
+			return nil, fmt.Errorf("replica #%d: %w", i+1, err)
+		}
+
+		if err = metrics.RegisterDB(replica.DB, fmt.Sprintf("postgres-replica-%d", i+1)); err != nil {
+			logger.Error("Register db metrics error", zap.Error(err))
+		}
+
+		replicas = append(replicas, replica)
+	}
+
+	return replicas, nil
+}
@@ -0,0 +1,656 @@
+// Package storagetest holds the conformance suite every storage backend has to pass,
+// so the service sees the same behaviour whichever one is configured.
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/storage"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// _missingID is a key no test row gets.
+const _missingID = 1 << 30
+
+type Stores struct {
+	Users   storage.IUserStorage
+	Books   storage.IBookStorage
+	History storage.IBIHistoryStorage
+	Copies  storage.IBookCopyStorage
+	Tx      storage.ITxManager
+}
+
+// Run runs the suite, newStores is called for every test. The stores may share their data between
+// the tests, every test creates its own rows and only looks at them.
+func Run(t *testing.T, newStores func(t *testing.T) Stores) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s Stores)
+	}{
+		{"UserCreateAndGet", testUserCreateAndGet},
+		{"UserUniqueEmail", testUserUniqueEmail},
+		{"UserInvalid", testUserInvalid},
+		{"UserUpdateVersion", testUserUpdateVersion},
+		{"UserDeleteRestore", testUserDeleteRestore},
+		{"BookCreateAndGet", testBookCreateAndGet},
+		{"BookUniqueISBN", testBookUniqueISBN},
+		{"BookInvalid", testBookInvalid},
+		{"BookUpdateVersion", testBookUpdateVersion},
+		{"BookUpsertByISBN", testBookUpsertByISBN},
+		{"BookDeleteWithOpenLoan", testBookDeleteWithOpenLoan},
+		{"HistoryForeignKeys", testHistoryForeignKeys},
+		{"HistoryReturnDate", testHistoryReturnDate},
+		{"HistoryReturnCopy", testHistoryReturnCopy},
+		{"CopyStatusOnLoan", testCopyStatusOnLoan},
+		{"CopyCheckinBorrower", testCopyCheckinBorrower},
+		{"HistoryCountOverdue", testHistoryCountOverdue},
+		{"HistoryDelete", testHistoryDelete},
+		{"HistoryDeleteCopy", testHistoryDeleteCopy},
+		{"TxCommit", testTxCommit},
+		{"TxRollback", testTxRollback},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStores(t))
+		})
+	}
+}
+
+var _seq int64
+
+// unique returns a number no other call in this process returns, for emails, titles and ISBNs.
+func unique() int64 {
+	return atomic.AddInt64(&_seq, 1) + time.Now().Unix()%1_000_000*1000
+}
+
+func newUser(t *testing.T, s Stores) model.User {
+	user := model.User{FIO: "Conformance Reader", Email: fmt.Sprintf("reader%d@mail.ru", unique()),
+		Password: strings.Repeat("x", 60), Role: model.RoleReader}
+
+	id, err := s.Users.CreateUser(context.Background(), user)
+	require.NoError(t, err)
+	user.ID = id
+
+	return user
+}
+
+func newBook(t *testing.T, s Stores) model.Book {
+	n := unique()
+	book := model.Book{Title: fmt.Sprintf("Book %d", n), Author: "Author", Price: 10, ISBN: fmt.Sprintf("978%010d", n)}
+
+	id, err := s.Books.CreateBook(context.Background(), book)
+	require.NoError(t, err)
+	book.ID = id
+
+	return book
+}
+
+func rent(t *testing.T, s Stores, user model.User, books ...model.Book) {
+	rental := model.BIHistory{UserID: user.ID}
+	for _, book := range books {
+		rental.Books = append(rental.Books, &model.RentalBooks{ID: book.ID, Quantity: 2})
+	}
+
+	require.NoError(t, s.History.CreateBIHistory(context.Background(), rental))
+}
+
+// openLoan returns the open loan of the book, the titles the tests use are unique.
+func openLoan(t *testing.T, s Stores, book model.Book) (model.BorrowedBooks, bool) {
+	loans, err := s.History.GetCurrentBorrowedBooks(context.Background())
+	require.NoError(t, err)
+
+	for _, loan := range loans {
+		if loan.BookName == book.Title {
+			return loan, true
+		}
+	}
+
+	return model.BorrowedBooks{}, false
+}
+
+func requireKind(t *testing.T, kind apperror.Kind, err error) {
+	t.Helper()
+	require.Error(t, err)
+	require.Equal(t, kind, apperror.KindOf(err), err.Error())
+	if kind == apperror.NotFound {
+		// the service tells a stale version apart by sql.ErrNoRows
+		require.True(t, errors.Is(err, sql.ErrNoRows), err.Error())
+	}
+}
+
+func testUserCreateAndGet(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+
+	got, err := s.Users.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.FIO, got.FIO)
+	assert.Equal(t, user.Email, got.Email)
+	assert.Equal(t, user.Password, got.Password)
+	assert.Equal(t, model.RoleReader, got.Role)
+	assert.Equal(t, 1, got.Version)
+	assert.Nil(t, got.DeletedAt)
+	assert.Nil(t, got.EmailVerifiedAt)
+
+	got, err = s.Users.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+
+	_, err = s.Users.GetUserByID(ctx, _missingID)
+	requireKind(t, apperror.NotFound, err)
+
+	_, err = s.Users.GetUserByEmail(ctx, "missing@mail.ru")
+	requireKind(t, apperror.NotFound, err)
+}
+
+func testUserUniqueEmail(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+
+	_, err := s.Users.CreateUser(ctx, user)
+	requireKind(t, apperror.AlreadyExists, err)
+
+	// a deleted account gives its email back, and cannot be restored while it is taken
+	require.NoError(t, s.Users.DeleteUser(ctx, user.ID))
+	_, err = s.Users.CreateUser(ctx, user)
+	require.NoError(t, err)
+
+	_, err = s.Users.RestoreUser(ctx, user.ID)
+	requireKind(t, apperror.AlreadyExists, err)
+}
+
+func testUserInvalid(t *testing.T, s Stores) {
+	ctx := context.Background()
+
+	_, err := s.Users.CreateUser(ctx, model.User{FIO: strings.Repeat("x", 71), Email: fmt.Sprintf("long%d@mail.ru", unique()),
+		Password: "hash", Role: model.RoleReader})
+	requireKind(t, apperror.Validation, err)
+
+	_, err = s.Users.CreateUser(ctx, model.User{FIO: "Conformance Reader", Email: fmt.Sprintf("role%d@mail.ru", unique()),
+		Password: "hash", Role: "librarian"})
+	requireKind(t, apperror.Validation, err)
+}
+
+func testUserUpdateVersion(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+
+	_, err := s.Users.UpdateUserFIO(ctx, model.UserUpdateFIO{ID: user.ID, FIO: "Second Name", Version: 1})
+	require.NoError(t, err)
+
+	_, err = s.Users.UpdateUserFIO(ctx, model.UserUpdateFIO{ID: user.ID, FIO: "Stale Name", Version: 1})
+	requireKind(t, apperror.NotFound, err)
+
+	_, err = s.Users.UpdateUserPassword(ctx, model.UserUpdatePassword{ID: user.ID, NewPassword: strings.Repeat("y", 60)})
+	require.NoError(t, err)
+
+	// a zero version is no way around the check
+	_, err = s.Users.UpdateUserFIO(ctx, model.UserUpdateFIO{ID: user.ID, FIO: "Any Name"})
+	requireKind(t, apperror.NotFound, err)
+
+	_, err = s.Users.UpdateUserFIO(ctx, model.UserUpdateFIO{ID: user.ID, FIO: "Third Name", Version: 3})
+	require.NoError(t, err)
+
+	got, err := s.Users.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Third Name", got.FIO)
+	assert.Equal(t, strings.Repeat("y", 60), got.Password)
+	assert.Equal(t, 4, got.Version)
+
+	_, err = s.Users.UpdateUserPassword(ctx, model.UserUpdatePassword{ID: _missingID, NewPassword: "hash"})
+	requireKind(t, apperror.NotFound, err)
+}
+
+func testUserDeleteRestore(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+
+	require.NoError(t, s.Users.DeleteUser(ctx, user.ID))
+	requireKind(t, apperror.NotFound, s.Users.DeleteUser(ctx, user.ID))
+
+	_, err := s.Users.GetUserByID(ctx, user.ID)
+	requireKind(t, apperror.NotFound, err)
+	_, err = s.Users.GetUserByEmail(ctx, user.Email)
+	requireKind(t, apperror.NotFound, err)
+	_, err = s.Users.UpdateUserFIO(ctx, model.UserUpdateFIO{ID: user.ID, FIO: "Deleted Reader", Version: 1})
+	requireKind(t, apperror.NotFound, err)
+
+	id, err := s.Users.RestoreUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, id)
+
+	_, err = s.Users.RestoreUser(ctx, user.ID)
+	requireKind(t, apperror.NotFound, err)
+
+	_, err = s.Users.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+}
+
+func testBookCreateAndGet(t *testing.T, s Stores) {
+	ctx := context.Background()
+	book := newBook(t, s)
+
+	got, err := s.Books.GetBookByID(ctx, book.ID)
+	require.NoError(t, err)
+	assert.Equal(t, book.Title, got.Title)
+	assert.Equal(t, book.Author, got.Author)
+	assert.Equal(t, book.Price, got.Price)
+	assert.Equal(t, book.ISBN, got.ISBN)
+	assert.Equal(t, 1, got.Version)
+
+	all, err := s.Books.GetAllBooks(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, all, got)
+
+	var iterated []model.Book
+	require.NoError(t, s.Books.IterateBooks(ctx, func(b model.Book) error {
+		iterated = append(iterated, b)
+		return nil
+	}))
+	assert.Equal(t, len(all), len(iterated))
+	assert.Contains(t, iterated, got)
+
+	errStop := errors.New("stop")
+	err = s.Books.IterateBooks(ctx, func(model.Book) error { return errStop })
+	assert.ErrorIs(t, err, errStop)
+
+	_, err = s.Books.GetBookByID(ctx, _missingID)
+	requireKind(t, apperror.NotFound, err)
+}
+
+func testBookUniqueISBN(t *testing.T, s Stores) {
+	ctx := context.Background()
+	book := newBook(t, s)
+
+	_, err := s.Books.CreateBook(ctx, model.Book{Title: "Other Title", Author: "Author", ISBN: book.ISBN})
+	requireKind(t, apperror.AlreadyExists, err)
+
+	// the ISBN stays taken by a deleted book
+	require.NoError(t, s.Books.DeleteBook(ctx, book.ID))
+	_, err = s.Books.CreateBook(ctx, model.Book{Title: "Other Title", Author: "Author", ISBN: book.ISBN})
+	requireKind(t, apperror.AlreadyExists, err)
+
+	other := newBook(t, s)
+	other.ISBN, other.Version = book.ISBN, 1
+	_, err = s.Books.UpdateBook(ctx, other)
+	requireKind(t, apperror.AlreadyExists, err)
+
+	// books without an ISBN do not collide
+	for i := 0; i < 2; i++ {
+		_, err = s.Books.CreateBook(ctx, model.Book{Title: "No ISBN", Author: "Author"})
+		require.NoError(t, err)
+	}
+}
+
+func testBookInvalid(t *testing.T, s Stores) {
+	ctx := context.Background()
+
+	_, err := s.Books.CreateBook(ctx, model.Book{Title: "Negative", Author: "Author", Price: -1})
+	requireKind(t, apperror.Validation, err)
+
+	_, err = s.Books.CreateBook(ctx, model.Book{Title: strings.Repeat("т", 51), Author: "Author"})
+	requireKind(t, apperror.Validation, err)
+
+	// the limit counts characters, not bytes
+	_, err = s.Books.CreateBook(ctx, model.Book{Title: strings.Repeat("т", 50), Author: "Author"})
+	require.NoError(t, err)
+}
+
+func testBookUpdateVersion(t *testing.T, s Stores) {
+	ctx := context.Background()
+	book := newBook(t, s)
+
+	book.Title, book.Price, book.Version = book.Title+" 2", 20, 1
+	_, err := s.Books.UpdateBook(ctx, book)
+	require.NoError(t, err)
+
+	_, err = s.Books.UpdateBook(ctx, book)
+	requireKind(t, apperror.NotFound, err)
+
+	got, err := s.Books.GetBookByID(ctx, book.ID)
+	require.NoError(t, err)
+	assert.Equal(t, book.Title, got.Title)
+	assert.Equal(t, float64(20), got.Price)
+	assert.Equal(t, 2, got.Version)
+
+	book.Version = 0
+	_, err = s.Books.UpdateBook(ctx, book)
+	requireKind(t, apperror.NotFound, err)
+}
+
+func testBookUpsertByISBN(t *testing.T, s Stores) {
+	ctx := context.Background()
+	n := unique()
+	book := model.Book{Title: fmt.Sprintf("Upsert %d", n), Author: "Author", Price: 1, ISBN: fmt.Sprintf("979%010d", n)}
+
+	id, created, err := s.Books.UpsertBookByISBN(ctx, book)
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	// a deleted book is brought back by the import
+	require.NoError(t, s.Books.DeleteBook(ctx, id))
+
+	book.Title, book.Price = book.Title+" 2", 2
+	again, created, err := s.Books.UpsertBookByISBN(ctx, book)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, id, again)
+
+	got, err := s.Books.GetBookByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, book.Title, got.Title)
+	assert.Equal(t, float64(2), got.Price)
+	assert.Equal(t, 2, got.Version)
+	assert.Nil(t, got.DeletedAt)
+}
+
+func testBookDeleteWithOpenLoan(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user, book := newUser(t, s), newBook(t, s)
+	rent(t, s, user, book)
+
+	open, err := s.Books.HasOpenLoans(ctx, book.ID)
+	require.NoError(t, err)
+	assert.True(t, open)
+	requireKind(t, apperror.NotFound, s.Books.DeleteBook(ctx, book.ID))
+
+	loan, ok := openLoan(t, s, book)
+	require.True(t, ok)
+	_, err = s.History.UpdateBIHistory(ctx, loan.ID)
+	require.NoError(t, err)
+
+	open, err = s.Books.HasOpenLoans(ctx, book.ID)
+	require.NoError(t, err)
+	assert.False(t, open)
+
+	require.NoError(t, s.Books.DeleteBook(ctx, book.ID))
+	requireKind(t, apperror.NotFound, s.Books.DeleteBook(ctx, book.ID))
+	_, err = s.Books.GetBookByID(ctx, book.ID)
+	requireKind(t, apperror.NotFound, err)
+
+	all, err := s.Books.GetAllBooks(ctx)
+	require.NoError(t, err)
+	for _, b := range all {
+		assert.NotEqual(t, book.ID, b.ID)
+	}
+
+	_, err = s.Books.RestoreBook(ctx, book.ID)
+	require.NoError(t, err)
+	_, err = s.Books.RestoreBook(ctx, book.ID)
+	requireKind(t, apperror.NotFound, err)
+}
+
+func testHistoryForeignKeys(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user, book := newUser(t, s), newBook(t, s)
+
+	err := s.History.CreateBIHistory(ctx, model.BIHistory{UserID: _missingID,
+		Books: []*model.RentalBooks{{ID: book.ID, Quantity: 1}}})
+	requireKind(t, apperror.Conflict, err)
+
+	// the rental is written as a whole, the valid book is not left on loan
+	err = s.History.CreateBIHistory(ctx, model.BIHistory{UserID: user.ID,
+		Books: []*model.RentalBooks{{ID: book.ID, Quantity: 1}, {ID: _missingID, Quantity: 1}}})
+	requireKind(t, apperror.Conflict, err)
+
+	open, err := s.Books.HasOpenLoans(ctx, book.ID)
+	require.NoError(t, err)
+	assert.False(t, open)
+
+	// deleted readers and books are still there for the keys
+	deleted := newBook(t, s)
+	require.NoError(t, s.Books.DeleteBook(ctx, deleted.ID))
+	require.NoError(t, s.Users.DeleteUser(ctx, user.ID))
+	rent(t, s, user, deleted)
+}
+
+func testHistoryReturnDate(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user, first, second := newUser(t, s), newBook(t, s), newBook(t, s)
+	rent(t, s, user, first, second)
+
+	loan, ok := openLoan(t, s, first)
+	require.True(t, ok)
+	assert.Equal(t, user.FIO, loan.UserName)
+	assert.Equal(t, first.Author, loan.BookAuthor)
+	assert.Equal(t, 2, loan.Quantity)
+	assert.Empty(t, loan.Barcode)
+	assert.WithinDuration(t, time.Now(), loan.CreatedAt, 24*time.Hour)
+
+	var lastMonth, iterated bool
+	month, err := s.History.GetBIHistoryLastMonth(ctx)
+	require.NoError(t, err)
+	for _, b := range month {
+		lastMonth = lastMonth || b.ID == loan.ID
+	}
+	assert.True(t, lastMonth)
+
+	require.NoError(t, s.History.IterateCurrentBorrowedBooks(ctx, func(b model.BorrowedBooks) error {
+		iterated = iterated || b.ID == loan.ID
+		return nil
+	}))
+	assert.True(t, iterated)
+
+	id, err := s.History.UpdateBIHistory(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, loan.ID, id)
+
+	_, ok = openLoan(t, s, first)
+	assert.False(t, ok)
+	_, ok = openLoan(t, s, second)
+	assert.True(t, ok)
+
+	_, err = s.History.UpdateBIHistory(ctx, _missingID)
+	requireKind(t, apperror.NotFound, err)
+}
+
+func testHistoryReturnCopy(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user, book := newUser(t, s), newBook(t, s)
+	barcode := fmt.Sprintf("COPY-%d", unique())
+
+	_, err := s.Copies.CreateBookCopy(ctx, model.BookCopy{BookID: book.ID, Barcode: barcode, Condition: "good", AcquiredAt: time.Now()})
+	require.NoError(t, err)
+	loanID, err := s.Copies.CheckoutBookCopy(ctx, model.Checkout{Barcode: barcode, UserID: user.ID})
+	require.NoError(t, err)
+
+	id, err := s.History.UpdateBIHistory(ctx, loanID)
+	require.NoError(t, err)
+	assert.Equal(t, loanID, id)
+
+	bookCopy, err := s.Copies.GetBookCopyByBarcode(ctx, barcode)
+	require.NoError(t, err)
+	assert.Equal(t, model.CopyStatusAvailable, bookCopy.Status, "the returned copy is back on the shelf")
+
+	_, err = s.History.UpdateBIHistory(ctx, loanID)
+	requireKind(t, apperror.NotFound, err)
+}
+
+func testCopyStatusOnLoan(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user, book := newUser(t, s), newBook(t, s)
+	barcode := fmt.Sprintf("COPY-%d", unique())
+
+	_, err := s.Copies.CreateBookCopy(ctx, model.BookCopy{BookID: book.ID, Barcode: barcode, Condition: "good", AcquiredAt: time.Now()})
+	require.NoError(t, err)
+	_, err = s.Copies.CheckoutBookCopy(ctx, model.Checkout{Barcode: barcode, UserID: user.ID})
+	require.NoError(t, err)
+
+	_, err = s.Copies.UpdateBookCopyStatus(ctx, model.BookCopyUpdateStatus{Barcode: barcode, Status: model.CopyStatusLost})
+	requireKind(t, apperror.NotFound, err)
+
+	_, err = s.Copies.CheckinBookCopy(ctx, model.Checkin{Barcode: barcode})
+	require.NoError(t, err)
+	_, err = s.Copies.UpdateBookCopyStatus(ctx, model.BookCopyUpdateStatus{Barcode: barcode, Status: model.CopyStatusLost})
+	require.NoError(t, err)
+
+	bookCopy, err := s.Copies.GetBookCopyByBarcode(ctx, barcode)
+	require.NoError(t, err)
+	assert.Equal(t, model.CopyStatusLost, bookCopy.Status)
+}
+
+func testCopyCheckinBorrower(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user, other, book := newUser(t, s), newUser(t, s), newBook(t, s)
+	barcode := fmt.Sprintf("COPY-%d", unique())
+
+	_, err := s.Copies.CreateBookCopy(ctx, model.BookCopy{BookID: book.ID, Barcode: barcode, Condition: "good", AcquiredAt: time.Now()})
+	require.NoError(t, err)
+	loanID, err := s.Copies.CheckoutBookCopy(ctx, model.Checkout{Barcode: barcode, UserID: user.ID})
+	require.NoError(t, err)
+
+	_, err = s.Copies.CheckinBookCopy(ctx, model.Checkin{Barcode: barcode, Condition: "worn", UserID: other.ID})
+	requireKind(t, apperror.NotFound, err)
+
+	bookCopy, err := s.Copies.GetBookCopyByBarcode(ctx, barcode)
+	require.NoError(t, err)
+	assert.Equal(t, model.CopyStatusOnLoan, bookCopy.Status, "another reader can't return the copy")
+	assert.Equal(t, "good", bookCopy.Condition)
+
+	id, err := s.Copies.CheckinBookCopy(ctx, model.Checkin{Barcode: barcode, UserID: user.ID})
+	require.NoError(t, err)
+	assert.Equal(t, loanID, id)
+}
+
+func testHistoryCountOverdue(t *testing.T, s Stores) {
+	ctx := context.Background()
+
+	// a loan period of minus an hour counts the loans issued up to an hour from now, one of an hour
+	// counts none of the fresh ones
+	before, err := s.History.CountOverdueLoans(ctx, -time.Hour)
+	require.NoError(t, err)
+	earlier, err := s.History.CountOverdueLoans(ctx, time.Hour)
+	require.NoError(t, err)
+
+	user, book := newUser(t, s), newBook(t, s)
+	rent(t, s, user, book)
+
+	after, err := s.History.CountOverdueLoans(ctx, -time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, before+1, after)
+
+	later, err := s.History.CountOverdueLoans(ctx, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, earlier, later)
+
+	loan, ok := openLoan(t, s, book)
+	require.True(t, ok)
+	_, err = s.History.UpdateBIHistory(ctx, loan.ID)
+	require.NoError(t, err)
+
+	after, err = s.History.CountOverdueLoans(ctx, -time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+}
+
+func testHistoryDelete(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user, book := newUser(t, s), newBook(t, s)
+	rent(t, s, user, book)
+
+	loan, ok := openLoan(t, s, book)
+	require.True(t, ok)
+
+	require.NoError(t, s.History.DeleteBIHistory(ctx, loan.ID))
+	_, ok = openLoan(t, s, book)
+	assert.False(t, ok)
+
+	// the row is kept but closed, it can't be returned again
+	_, err := s.History.UpdateBIHistory(ctx, loan.ID)
+	requireKind(t, apperror.NotFound, err)
+
+	// deleting a missing row is not an error
+	require.NoError(t, s.History.DeleteBIHistory(ctx, loan.ID))
+}
+
+func testHistoryDeleteCopy(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user, book := newUser(t, s), newBook(t, s)
+	barcode := fmt.Sprintf("COPY-%d", unique())
+
+	_, err := s.Copies.CreateBookCopy(ctx, model.BookCopy{BookID: book.ID, Barcode: barcode, Condition: "good", AcquiredAt: time.Now()})
+	require.NoError(t, err)
+	loanID, err := s.Copies.CheckoutBookCopy(ctx, model.Checkout{Barcode: barcode, UserID: user.ID})
+	require.NoError(t, err)
+
+	require.NoError(t, s.History.DeleteBIHistory(ctx, loanID))
+
+	bookCopy, err := s.Copies.GetBookCopyByBarcode(ctx, barcode)
+	require.NoError(t, err)
+	assert.Equal(t, model.CopyStatusAvailable, bookCopy.Status, "the copy of a deleted rental is back on the shelf")
+
+	// a new loan of the copy is not touched by deleting the old one again
+	_, err = s.Copies.CheckoutBookCopy(ctx, model.Checkout{Barcode: barcode, UserID: user.ID})
+	require.NoError(t, err)
+	require.NoError(t, s.History.DeleteBIHistory(ctx, loanID))
+
+	bookCopy, err = s.Copies.GetBookCopyByBarcode(ctx, barcode)
+	require.NoError(t, err)
+	assert.Equal(t, model.CopyStatusOnLoan, bookCopy.Status)
+}
+
+func testTxCommit(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+
+	var book model.Book
+	err := s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		book = model.Book{Title: fmt.Sprintf("Tx %d", unique()), Author: "Author"}
+
+		var err error
+		if book.ID, err = s.Books.CreateBook(ctx, book); err != nil {
+			return err
+		}
+
+		return s.History.CreateBIHistory(ctx, model.BIHistory{UserID: user.ID,
+			Books: []*model.RentalBooks{{ID: book.ID, Quantity: 1}}})
+	})
+	require.NoError(t, err)
+
+	_, ok := openLoan(t, s, book)
+	assert.True(t, ok)
+}
+
+func testTxRollback(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user, book := newUser(t, s), newBook(t, s)
+	errAbort := errors.New("abort")
+
+	err := s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		_, err := s.Users.UpdateUserFIO(ctx, model.UserUpdateFIO{ID: user.ID, FIO: "Rolled Back", Version: 1})
+		require.NoError(t, err)
+
+		// the unit sees its own writes
+		got, err := s.Users.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Rolled Back", got.FIO)
+
+		// a nested unit joins the outer one and is undone with it
+		require.NoError(t, s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			return s.History.CreateBIHistory(ctx, model.BIHistory{UserID: user.ID,
+				Books: []*model.RentalBooks{{ID: book.ID, Quantity: 1}}})
+		}))
+
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+
+	got, err := s.Users.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.FIO, got.FIO)
+	assert.Equal(t, 1, got.Version)
+
+	open, err := s.Books.HasOpenLoans(ctx, book.ID)
+	require.NoError(t, err)
+	assert.False(t, open)
+}
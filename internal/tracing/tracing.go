@@ -0,0 +1,108 @@
+// Package tracing sets up OpenTelemetry. Spans are started through the global tracer provider,
+// which stays a no-op until New installs an exporting one.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/zhayt/user-storage-service/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	_instrumentation = "github.com/zhayt/user-storage-service"
+	_shutdownTimeout = 5 * time.Second
+
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// New installs the W3C trace context propagator and, unless TRACE_EXPORTER is empty, a tracer provider
+// exporting to it. The OTLP exporter is set up by the standard OTEL_EXPORTER_OTLP_* variables.
+// Spans still buffered are flushed when ctx is done.
+func New(ctx context.Context, wg *sync.WaitGroup, logger *zap.Logger, cfg *config.Config) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+
+	switch cfg.TraceExporter {
+	case "":
+		logger.Info("Tracing is not configured")
+		return nil
+	case ExporterOTLP:
+		exporter, err = otlptracegrpc.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return fmt.Errorf("unknown trace exporter %q", cfg.TraceExporter)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return fmt.Errorf("couldn't create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TraceSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("Tracing error", zap.Error(err))
+	}))
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), _shutdownTimeout)
+		defer cancel()
+
+		logger.Info("Flush traces")
+		if err := provider.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Flush traces error", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Start starts a span named name, the caller must end it. A nil ctx starts a new trace.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return otel.Tracer(_instrumentation).Start(ctx, name, opts...)
+}
+
+// End marks the span failed if err is not nil and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -12,6 +12,8 @@ import (
 type IBIHistoryService interface {
 	GetCurrentBorrowedBooks(ctx context.Context) ([]model.BorrowedBooks, error)
 	GetBIHistoryLastMonth(ctx context.Context) ([]model.BorrowedBooks, error)
+	IterateCurrentBorrowedBooks(ctx context.Context, fn func(model.BorrowedBooks) error) error
+	IterateBIHistoryLastMonth(ctx context.Context, fn func(model.BorrowedBooks) error) error
 	UpdateBIHistory(ctx context.Context, bIHistoryID int) (int, error)
 	DeleteBIHistory(ctx context.Context, bIHistoryID int) error
 }
@@ -27,8 +29,10 @@ type IBIHistoryService interface {
 // @Param		input	body		model.BIHistory	true	"book issue info"
 // @Success		200		""
 // @Success		401		{object}	model.Response
-// @Failure		400		{object}	model.Response
-// @Failure		500		{object}	model.Response
+// @Failure		400		{object}	model.Problem
+// @Failure		403		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
 // @Router		/rents [post]
 func (h *Handler) CreateBIHistory(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -36,24 +40,24 @@ func (h *Handler) CreateBIHistory(e echo.Context) error {
 
 	userID, err := getUserID(e)
 	if err != nil {
-		h.log.Error("Authorization error", zap.Error(err))
-		return e.JSON(http.StatusUnauthorized, makeResponse(err.Error()))
+		h.logger(e).Error("Authorization error", zap.Error(err))
+		return err
 	}
 
 	var bIHistory model.BIHistory
 	if err = e.Bind(&bIHistory); err != nil {
-		h.log.Error("Bind error", zap.Error(err))
-		return e.JSON(http.StatusBadRequest, makeResponse(err.Error()))
+		h.logger(e).Error("Bind error", zap.Error(err))
+		return err
 	}
 
 	bIHistory.UserID = userID
 
 	if err = h.rent.RentBook(ctx, bIHistory); err != nil {
-		h.log.Error("Create book issue history error", zap.Error(err))
-		return e.JSON(http.StatusInternalServerError, makeResponse(err.Error()))
+		h.logger(e).Error("Create book issue history error", zap.Error(err))
+		return err
 	}
 
-	h.log.Info("Book issue history has been created")
+	h.logger(e).Info("Book issue history has been created")
 
 	return e.NoContent(http.StatusOK)
 }
@@ -63,21 +67,30 @@ func (h *Handler) CreateBIHistory(e echo.Context) error {
 // @Tags		book-issue-history
 // @Description	show current borrowed books
 // @ID			show-rent-book
-// @Produce		json
+// @Produce		json,text/csv,application/x-ndjson,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param		format	query		string	false	"json, csv, jsonl or xlsx, Accept header is used by default"
 // @Success		200		{object}	[]model.BorrowedBooks
-// @Failure		500		{object}	model.Response
+// @Failure		400		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
 // @Router		/rents [get]
 func (h *Handler) ShowCurrentBorrowedBooks(e echo.Context) error {
+	if format := exportFormat(e); format != "" {
+		return h.streamExport(e, format, "rents", func(ctx context.Context, encode func(interface{}) error) error {
+			return h.history.IterateCurrentBorrowedBooks(ctx, func(b model.BorrowedBooks) error { return encode(b) })
+		})
+	}
+
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
 	defer cancel()
 
 	borrowedBooks, err := h.history.GetCurrentBorrowedBooks(ctx)
 	if err != nil {
-		h.log.Error("Get current borrowed books error", zap.Error(err))
-		return e.JSON(http.StatusInternalServerError, makeResponse(err.Error()))
+		h.logger(e).Error("Get current borrowed books error", zap.Error(err))
+		return err
 	}
 
-	h.log.Info("Showed current borrowed books", zap.Int("amount", len(borrowedBooks)))
+	h.logger(e).Info("Showed current borrowed books", zap.Int("amount", len(borrowedBooks)))
 	return e.JSON(http.StatusOK, borrowedBooks)
 }
 
@@ -86,34 +99,46 @@ func (h *Handler) ShowCurrentBorrowedBooks(e echo.Context) error {
 // @Tags		book-issue-history
 // @Description	show borrowed books in last month
 // @ID			show-rent-book-lm
-// @Produce		json
+// @Produce		json,text/csv,application/x-ndjson,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param		format	query		string	false	"json, csv, jsonl or xlsx, Accept header is used by default"
 // @Success		200		{object}	[]model.BorrowedBooks
-// @Failure		500		{object}	model.Response
+// @Failure		400		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
 // @Router		/rents/months [get]
 func (h *Handler) ShowBIHistoryLastMonth(e echo.Context) error {
+	if format := exportFormat(e); format != "" {
+		return h.streamExport(e, format, "rents-last-month", func(ctx context.Context, encode func(interface{}) error) error {
+			return h.history.IterateBIHistoryLastMonth(ctx, func(b model.BorrowedBooks) error { return encode(b) })
+		})
+	}
+
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
 	defer cancel()
 
 	borrowedBooks, err := h.history.GetBIHistoryLastMonth(ctx)
 	if err != nil {
-		h.log.Error("Get book issue history last month error", zap.Error(err))
-		return e.JSON(http.StatusInternalServerError, makeResponse(err.Error()))
+		h.logger(e).Error("Get book issue history last month error", zap.Error(err))
+		return err
 	}
 
-	h.log.Info("Showed borrowed books in last month", zap.Int("amount", len(borrowedBooks)))
+	h.logger(e).Info("Showed borrowed books in last month", zap.Int("amount", len(borrowedBooks)))
 	return e.JSON(http.StatusOK, borrowedBooks)
 }
 
 // UpdateBIHistory godoc
 // @Summary		update book issue history
+// @Security	ApiKeyAuth
 // @Tags		book-issue-history
 // @Description	update book issue history book returned
 // @ID			update-biHistory
 // @Produce		json
 // @Param 		id	path		integer	true	"BIHistoryID"
 // @Success		200		{object}	[]model.BorrowedBooks
-// @Failure		404		{object}	model.Response
-// @Failure		500		{object}	model.Response
+// @Failure		401		{object}	model.Problem
+// @Failure		403		{object}	model.Problem
+// @Failure		404		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
 // @Router		/rents/{id} [patch]
 func (h *Handler) UpdateBIHistory(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -121,29 +146,32 @@ func (h *Handler) UpdateBIHistory(e echo.Context) error {
 
 	bIHistoryID, err := strconv.Atoi(e.Param("id"))
 	if err != nil {
-		h.log.Error("Param error", zap.Error(err))
-		return e.JSON(http.StatusNotFound, makeResponse(err.Error()))
+		h.logger(e).Error("Param error", zap.Error(err))
+		return echo.ErrNotFound
 	}
 
 	if _, err = h.history.UpdateBIHistory(ctx, bIHistoryID); err != nil {
-		h.log.Error("Update book issue history error", zap.Int("id", bIHistoryID))
-		return e.JSON(http.StatusInternalServerError, makeResponse(err.Error()))
+		h.logger(e).Error("Update book issue history error", zap.Int("id", bIHistoryID))
+		return err
 	}
 
-	h.log.Info("Book issue history has been updated", zap.Int("id", bIHistoryID))
+	h.logger(e).Info("Book issue history has been updated", zap.Int("id", bIHistoryID))
 	return e.JSON(http.StatusOK, makeResponse(bIHistoryID))
 }
 
 // DeleteBIHistory godoc
 // @Summary		delete book issue history
+// @Security	ApiKeyAuth
 // @Tags		book-issue-history
-// @Description	delete book issue history
+// @Description	soft delete book issue history, an open rental is closed
 // @ID			delete-biHistory
 // @Produce		json
 // @Param		id	path		integer	true	"BIHistoryID"
 // @Success		200		{object}	model.Response
-// @Failure		404		{object}	model.Response
-// @Failure		500		{object}	model.Response
+// @Failure		401		{object}	model.Problem
+// @Failure		403		{object}	model.Problem
+// @Failure		404		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
 // @Router		/rents/{id} [delete]
 func (h *Handler) DeleteBIHistory(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -151,15 +179,15 @@ func (h *Handler) DeleteBIHistory(e echo.Context) error {
 
 	bIHistoryID, err := strconv.Atoi(e.Param("id"))
 	if err != nil {
-		h.log.Error("Param error", zap.Error(err))
-		return e.JSON(http.StatusNotFound, makeResponse(err.Error()))
+		h.logger(e).Error("Param error", zap.Error(err))
+		return echo.ErrNotFound
 	}
 
 	if err = h.history.DeleteBIHistory(ctx, bIHistoryID); err != nil {
-		h.log.Error("Delete book issue history error", zap.Error(err))
-		return e.JSON(http.StatusInternalServerError, makeResponse(err.Error()))
+		h.logger(e).Error("Delete book issue history error", zap.Error(err))
+		return err
 	}
 
-	h.log.Info("Book issue history has been deleted", zap.Int("id", bIHistoryID))
+	h.logger(e).Info("Book issue history has been deleted", zap.Int("id", bIHistoryID))
 	return e.JSON(http.StatusOK, makeResponse(bIHistoryID))
 }
@@ -13,8 +13,10 @@ type IBookService interface {
 	CreateBook(ctx context.Context, book model.Book) (int, error)
 	GetBookByID(ctx context.Context, bookID int) (model.Book, error)
 	GetAllBooks(ctx context.Context) ([]model.Book, error)
-	UpdateBook(ctx context.Context, book model.Book) (int, error)
+	IterateBooks(ctx context.Context, fn func(model.Book) error) error
+	PatchBook(ctx context.Context, bookID, version int, patch model.Patch) (model.Book, error)
 	DeleteBook(ctx context.Context, bookID int) error
+	RestoreBook(ctx context.Context, bookID int) (int, error)
 }
 
 // CreateBook godoc
@@ -26,8 +28,9 @@ type IBookService interface {
 // @Produce		json
 // @Param		input	body		model.Book	true	"book info"
 // @Success		200		{object}	model.Book
-// @Failure		400		{object}	model.Response
-// @Failure		500		{object}	model.Response
+// @Failure		400		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
 // @Router		/books [post]
 func (h *Handler) CreateBook(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -36,20 +39,20 @@ func (h *Handler) CreateBook(e echo.Context) error {
 	var book model.Book
 
 	if err := e.Bind(&book); err != nil {
-		h.log.Error("Bind error", zap.Error(err))
-		return e.JSON(http.StatusBadRequest, makeResponse(err.Error()))
+		h.logger(e).Error("Bind error", zap.Error(err))
+		return err
 	}
 
 	bookID, err := h.book.CreateBook(ctx, book)
 	if err != nil {
 		// server or client error
-		h.log.Error("Create book error", zap.Error(err))
-		return e.JSON(http.StatusInternalServerError, makeResponse(err.Error()))
+		h.logger(e).Error("Create book error", zap.Error(err))
+		return err
 	}
 
 	book.ID = bookID
 
-	h.log.Info("Book created", zap.Int("id", bookID))
+	h.logger(e).Info("Book created", zap.Int("id", bookID))
 	return e.JSON(http.StatusOK, book)
 }
 
@@ -61,8 +64,11 @@ func (h *Handler) CreateBook(e echo.Context) error {
 // @Produce		json
 // @Param		id	path		integer	true	"BookID"
 // @Success		200		{object}	model.Book
-// @Failure		400		{object}	model.Response
-// @Failure		500		{object}	model.Response
+// @Success		304		""
+// @Failure		400		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
+// @Header		200		{string}	ETag	"book version"
 // @Router		/books/{id} [get]
 func (h *Handler) ShowBook(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -70,18 +76,23 @@ func (h *Handler) ShowBook(e echo.Context) error {
 
 	bookID, err := strconv.Atoi(e.Param("id"))
 	if err != nil {
-		h.log.Error("Param error", zap.Error(err))
-		return e.JSON(http.StatusNotFound, makeResponse(err.Error()))
+		h.logger(e).Error("Param error", zap.Error(err))
+		return echo.ErrNotFound
 	}
 
 	book, err := h.book.GetBookByID(ctx, bookID)
 	if err != nil {
-		h.log.Error("Get book Id error", zap.Error(err))
+		h.logger(e).Error("Get book Id error", zap.Error(err))
 		// 500 or 404
-		return e.JSON(http.StatusNotFound, makeResponse(err.Error()))
+		return err
 	}
 
-	h.log.Info("Book found", zap.Int("id", book.ID))
+	setETag(e, book.Version)
+	if notModified(e, book.Version) {
+		return e.NoContent(http.StatusNotModified)
+	}
+
+	h.logger(e).Info("Book found", zap.Int("id", book.ID))
 	return e.JSON(http.StatusOK, book)
 }
 
@@ -90,36 +101,52 @@ func (h *Handler) ShowBook(e echo.Context) error {
 // @Tags		book
 // @Description	show books
 // @ID			show-books
-// @Produce		json
+// @Produce		json,text/csv,application/x-ndjson,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param		format	query		string	false	"json, csv, jsonl or xlsx, Accept header is used by default"
 // @Success		200		{object}	[]model.Book
-// @Failure		500		{object}	model.Response
+// @Failure		400		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
 // @Router		/books [get]
 func (h *Handler) ShowAllBooks(e echo.Context) error {
+	if format := exportFormat(e); format != "" {
+		return h.streamExport(e, format, "books", func(ctx context.Context, encode func(interface{}) error) error {
+			return h.book.IterateBooks(ctx, func(book model.Book) error { return encode(book) })
+		})
+	}
+
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
 	defer cancel()
 
 	books, err := h.book.GetAllBooks(ctx)
 	if err != nil {
-		h.log.Error("Get all books error", zap.Error(err))
-		return e.JSON(http.StatusInternalServerError, makeResponse(err.Error()))
+		h.logger(e).Error("Get all books error", zap.Error(err))
+		return err
 	}
 
-	h.log.Info("Books founded", zap.Int("amount", len(books)))
+	h.logger(e).Info("Books founded", zap.Int("amount", len(books)))
 	return e.JSON(http.StatusOK, books)
 }
 
 // UpdateBook godoc
 // @Summary		Update book
 // @Tags		book
-// @Description	update books
+// @Description	patch book with JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902), fields left out keep their values
 // @ID			update-book
 // @Accept		json
+// @Accept		application/merge-patch+json
+// @Accept		application/json-patch+json
 // @Produce		json
-// @Param		input	body		model.Book	true "book info"
+// @Param		If-Match	header		string		true	"ETag from GET /books/{id}"
+// @Param		input		body		model.Book	true	"fields to change"
 // @Success		200		{object}	model.Book
-// @Success		400		{object}	model.Book
-// @Failure		404		{object}	model.Response
-// @Failure		500		{object}	model.Response
+// @Failure		400		{object}	model.Problem
+// @Failure		404		{object}	model.Problem
+// @Failure		412		{object}	model.Problem
+// @Failure		415		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		428		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
 // @Router		/books/{id} [patch]
 func (h *Handler) UpdateBook(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -127,28 +154,32 @@ func (h *Handler) UpdateBook(e echo.Context) error {
 
 	bookID, err := strconv.Atoi(e.Param("id"))
 	if err != nil {
-		h.log.Error("Param error", zap.Error(err))
-		return e.JSON(http.StatusNotFound, makeResponse(err.Error()))
+		h.logger(e).Error("Param error", zap.Error(err))
+		return echo.ErrNotFound
 	}
 
-	var book model.Book
-
-	if err = e.Bind(&book); err != nil {
-		h.log.Error("Bind error", zap.Error(err))
-		return e.JSON(http.StatusBadRequest, makeResponse(err.Error()))
+	version, err := ifMatchVersion(e)
+	if err != nil {
+		h.logger(e).Error("Precondition error", zap.Error(err))
+		return err
 	}
 
-	book.ID = bookID
+	patch, err := readPatch(e)
+	if err != nil {
+		h.logger(e).Error("Patch error", zap.Error(err))
+		return err
+	}
 
-	bookID, err = h.book.UpdateBook(ctx, book)
+	book, err := h.book.PatchBook(ctx, bookID, version, patch)
 	if err != nil {
-		h.log.Error("Update book error", zap.Error(err))
-		// 500 or 400
-		return e.JSON(http.StatusInternalServerError, makeResponse(err.Error()))
+		h.logger(e).Error("Update book error", zap.Error(err))
+		return err
 	}
 
-	h.log.Info("Book updated", zap.Int("id", bookID))
-	return e.JSON(http.StatusOK, makeResponse(bookID))
+	setETag(e, book.Version)
+
+	h.logger(e).Info("Book updated", zap.Int("id", book.ID))
+	return e.JSON(http.StatusOK, book)
 }
 
 // DeleteBook godoc
@@ -160,7 +191,8 @@ func (h *Handler) UpdateBook(e echo.Context) error {
 // @Param		id	path		integer	true	"BookID"
 // @Success		200		{object}	model.Book
 // @Success		404		{object}	model.Book
-// @Failure		500		{object}	model.Response
+// @Failure		409		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
 // @Router		/books/{id} [delete]
 func (h *Handler) DeleteBook(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -168,15 +200,48 @@ func (h *Handler) DeleteBook(e echo.Context) error {
 
 	bookID, err := strconv.Atoi(e.Param("id"))
 	if err != nil {
-		h.log.Error("Param error", zap.Error(err))
-		return e.JSON(http.StatusNotFound, makeResponse(err.Error()))
+		h.logger(e).Error("Param error", zap.Error(err))
+		return echo.ErrNotFound
 	}
 
 	if err = h.book.DeleteBook(ctx, bookID); err != nil {
-		h.log.Error("Delete book error", zap.Error(err))
-		return e.JSON(http.StatusInternalServerError, makeResponse(err.Error()))
+		h.logger(e).Error("Delete book error", zap.Error(err))
+		return err
+	}
+
+	h.logger(e).Info("Book deleted", zap.Int("id", bookID))
+	return e.JSON(http.StatusOK, makeResponse(bookID))
+}
+
+// RestoreBook godoc
+// @Summary		Restore book
+// @Security	ApiKeyAuth
+// @Tags		admin
+// @Description	restore deleted book
+// @ID			restore-book
+// @Produce		json
+// @Param		id	path		integer	true	"BookID"
+// @Success		200		{object}	model.Response
+// @Failure		401		{object}	model.Problem
+// @Failure		403		{object}	model.Problem
+// @Failure		404		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
+// @Router		/admin/books/{id}/restore [post]
+func (h *Handler) RestoreBook(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
+	defer cancel()
+
+	bookID, err := strconv.Atoi(e.Param("id"))
+	if err != nil {
+		h.logger(e).Error("Param error", zap.Error(err))
+		return echo.ErrNotFound
+	}
+
+	if _, err = h.book.RestoreBook(ctx, bookID); err != nil {
+		h.logger(e).Error("Restore book error", zap.Error(err))
+		return err
 	}
 
-	h.log.Info("Book deleted", zap.Int("id", bookID))
+	h.logger(e).Info("Book restored", zap.Int("id", bookID))
 	return e.JSON(http.StatusOK, makeResponse(bookID))
 }
@@ -0,0 +1,268 @@
+package handler
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+type IBookCopyService interface {
+	CreateBookCopy(ctx context.Context, bookCopy model.BookCopy) (int, error)
+	GetBookCopyByBarcode(ctx context.Context, barcode string) (model.BookCopy, error)
+	GetBookCopies(ctx context.Context, bookID int) ([]model.BookCopy, error)
+	UpdateBookCopyStatus(ctx context.Context, bookCopy model.BookCopyUpdateStatus) (int, error)
+	CheckoutBookCopy(ctx context.Context, checkout model.Checkout) (int, error)
+	CheckinBookCopy(ctx context.Context, checkin model.Checkin) (int, error)
+}
+
+// CreateBookCopy godoc
+// @Summary		Create book copy
+// @Security	ApiKeyAuth
+// @Tags		book-copy
+// @Description	register physical copy of the book
+// @ID			create-book-copy
+// @Accept		json
+// @Produce		json
+// @Param		id		path		integer			true	"BookID"
+// @Param		input	body		model.BookCopy	true	"copy info"
+// @Success		200		{object}	model.BookCopy
+// @Failure		400		{object}	model.Problem
+// @Failure		401		{object}	model.Problem
+// @Failure		403		{object}	model.Problem
+// @Failure		404		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
+// @Router		/books/{id}/copies [post]
+func (h *Handler) CreateBookCopy(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
+	defer cancel()
+
+	bookID, err := strconv.Atoi(e.Param("id"))
+	if err != nil {
+		h.logger(e).Error("Param error", zap.Error(err))
+		return echo.ErrNotFound
+	}
+
+	var bookCopy model.BookCopy
+	if err = e.Bind(&bookCopy); err != nil {
+		h.logger(e).Error("Bind error", zap.Error(err))
+		return err
+	}
+
+	bookCopy.BookID = bookID
+	bookCopy.Status = model.CopyStatusAvailable
+
+	copyID, err := h.bookCopy.CreateBookCopy(ctx, bookCopy)
+	if err != nil {
+		h.logger(e).Error("Create book copy error", zap.Error(err))
+		return err
+	}
+
+	bookCopy.ID = copyID
+
+	h.logger(e).Info("Book copy created", zap.Int("id", copyID), zap.String("barcode", bookCopy.Barcode))
+	return e.JSON(http.StatusOK, bookCopy)
+}
+
+// ShowBookCopies godoc
+// @Summary		Show book copies
+// @Security	ApiKeyAuth
+// @Tags		book-copy
+// @Description	show physical copies of the book
+// @ID			show-book-copies
+// @Produce		json
+// @Param		id	path		integer	true	"BookID"
+// @Success		200	{object}	[]model.BookCopy
+// @Failure		401	{object}	model.Problem
+// @Failure		404	{object}	model.Problem
+// @Failure		500	{object}	model.Problem
+// @Router		/books/{id}/copies [get]
+func (h *Handler) ShowBookCopies(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
+	defer cancel()
+
+	bookID, err := strconv.Atoi(e.Param("id"))
+	if err != nil {
+		h.logger(e).Error("Param error", zap.Error(err))
+		return echo.ErrNotFound
+	}
+
+	copies, err := h.bookCopy.GetBookCopies(ctx, bookID)
+	if err != nil {
+		h.logger(e).Error("Get book copies error", zap.Error(err))
+		return err
+	}
+
+	h.logger(e).Info("Book copies founded", zap.Int("id", bookID), zap.Int("amount", len(copies)))
+	return e.JSON(http.StatusOK, copies)
+}
+
+// ShowBookCopy godoc
+// @Summary		Show book copy
+// @Security	ApiKeyAuth
+// @Tags		book-copy
+// @Description	show physical copy by barcode
+// @ID			show-book-copy
+// @Produce		json
+// @Param		barcode	path		string	true	"Barcode"
+// @Success		200		{object}	model.BookCopy
+// @Failure		401		{object}	model.Problem
+// @Failure		404		{object}	model.Problem
+// @Router		/copies/{barcode} [get]
+func (h *Handler) ShowBookCopy(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
+	defer cancel()
+
+	bookCopy, err := h.bookCopy.GetBookCopyByBarcode(ctx, e.Param("barcode"))
+	if err != nil {
+		h.logger(e).Error("Get book copy error", zap.Error(err))
+		return err
+	}
+
+	h.logger(e).Info("Book copy found", zap.String("barcode", bookCopy.Barcode))
+	return e.JSON(http.StatusOK, bookCopy)
+}
+
+// UpdateBookCopyStatus godoc
+// @Summary		Update book copy status
+// @Security	ApiKeyAuth
+// @Tags		book-copy
+// @Description	mark copy as available, lost or withdrawn
+// @ID			update-book-copy-status
+// @Accept		json
+// @Produce		json
+// @Param		barcode	path		string						true	"Barcode"
+// @Param		input	body		model.BookCopyUpdateStatus	true	"status"
+// @Success		200		{object}	model.Response
+// @Failure		400		{object}	model.Problem
+// @Failure		401		{object}	model.Problem
+// @Failure		403		{object}	model.Problem
+// @Failure		404		{object}	model.Problem
+// @Failure		409		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
+// @Router		/copies/{barcode} [patch]
+func (h *Handler) UpdateBookCopyStatus(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
+	defer cancel()
+
+	var bookCopy model.BookCopyUpdateStatus
+	if err := e.Bind(&bookCopy); err != nil {
+		h.logger(e).Error("Bind error", zap.Error(err))
+		return err
+	}
+
+	bookCopy.Barcode = e.Param("barcode")
+
+	copyID, err := h.bookCopy.UpdateBookCopyStatus(ctx, bookCopy)
+	if err != nil {
+		h.logger(e).Error("Update book copy status error", zap.Error(err))
+		return err
+	}
+
+	h.logger(e).Info("Book copy status updated", zap.Int("id", copyID), zap.String("status", bookCopy.Status))
+	return e.JSON(http.StatusOK, makeResponse(copyID))
+}
+
+// Checkout godoc
+// @Summary		checkout book copy
+// @Security	ApiKeyAuth
+// @Tags		book-issue-history
+// @Description	issue physical copy by scanned barcode to the authorized user, only admin may set another userID
+// @ID			checkout-copy
+// @Accept		json
+// @Produce		json
+// @Param		input	body		model.Checkout	true	"barcode and reader"
+// @Success		200		{object}	model.Response
+// @Failure		400		{object}	model.Problem
+// @Failure		401		{object}	model.Problem
+// @Failure		403		{object}	model.Problem
+// @Failure		404		{object}	model.Problem
+// @Failure		409		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
+// @Router		/rents/checkout [post]
+func (h *Handler) Checkout(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
+	defer cancel()
+
+	var checkout model.Checkout
+	if err := e.Bind(&checkout); err != nil {
+		h.logger(e).Error("Bind error", zap.Error(err))
+		return err
+	}
+
+	userID, err := getUserID(e)
+	if err != nil {
+		h.logger(e).Error("Authorization error", zap.Error(err))
+		return err
+	}
+
+	// only staff issues copies to other readers
+	if checkout.UserID != 0 && checkout.UserID != userID && !isAdmin(e) {
+		return apperror.New(apperror.Forbidden, "admin role required to check out for another user")
+	}
+	if checkout.UserID == 0 {
+		checkout.UserID = userID
+	}
+
+	bIHistoryID, err := h.bookCopy.CheckoutBookCopy(ctx, checkout)
+	if err != nil {
+		h.logger(e).Error("Checkout book copy error", zap.Error(err))
+		return err
+	}
+
+	h.logger(e).Info("Book copy checked out", zap.String("barcode", checkout.Barcode), zap.Int("id", bIHistoryID))
+	return e.JSON(http.StatusOK, makeResponse(bIHistoryID))
+}
+
+// Checkin godoc
+// @Summary		checkin book copy
+// @Security	ApiKeyAuth
+// @Tags		book-issue-history
+// @Description	return physical copy by scanned barcode and close its rental, readers return only their own loans
+// @ID			checkin-copy
+// @Accept		json
+// @Produce		json
+// @Param		input	body		model.Checkin	true	"barcode and condition"
+// @Success		200		{object}	model.Response
+// @Failure		400		{object}	model.Problem
+// @Failure		401		{object}	model.Problem
+// @Failure		404		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
+// @Router		/rents/checkin [post]
+func (h *Handler) Checkin(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
+	defer cancel()
+
+	var checkin model.Checkin
+	if err := e.Bind(&checkin); err != nil {
+		h.logger(e).Error("Bind error", zap.Error(err))
+		return err
+	}
+
+	// a reader returns only what they hold, staff takes any copy back
+	if !isAdmin(e) {
+		userID, err := getUserID(e)
+		if err != nil {
+			h.logger(e).Error("Authorization error", zap.Error(err))
+			return err
+		}
+
+		checkin.UserID = userID
+	}
+
+	bIHistoryID, err := h.bookCopy.CheckinBookCopy(ctx, checkin)
+	if err != nil {
+		h.logger(e).Error("Checkin book copy error", zap.Error(err))
+		return err
+	}
+
+	h.logger(e).Info("Book copy checked in", zap.String("barcode", checkin.Barcode), zap.Int("id", bIHistoryID))
+	return e.JSON(http.StatusOK, makeResponse(bIHistoryID))
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type IBookImportService interface {
+	ImportBooks(format string, src io.ReadCloser) (model.ImportJob, error)
+	GetImportJob(jobID string) (model.ImportJob, error)
+}
+
+// ImportBooks godoc
+// @Summary		Import books
+// @Security	ApiKeyAuth
+// @Tags		book
+// @Description	upload catalog in csv (isbn,title,author,price), marc or marcxml, books are upserted by isbn in background
+// @ID			import-books
+// @Accept		mpfd
+// @Produce		json
+// @Param		file	formData	file	true	"catalog file"
+// @Param		format	query		string	false	"csv, marc or marcxml, taken from file extension by default"
+// @Success		202		{object}	model.ImportJob
+// @Failure		400		{object}	model.Problem
+// @Failure		401		{object}	model.Problem
+// @Failure		403		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
+// @Router		/books/import [post]
+func (h *Handler) ImportBooks(e echo.Context) error {
+	fileHeader, err := e.FormFile("file")
+	if err != nil {
+		h.logger(e).Error("Form file error", zap.Error(err))
+		return err
+	}
+
+	format := e.QueryParam("format")
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(fileHeader.Filename), ".")
+	}
+
+	// the multipart form is removed when the request ends, the job reads its own copy
+	src, err := fileHeader.Open()
+	if err != nil {
+		h.logger(e).Error("Open form file error", zap.Error(err))
+		return err
+	}
+	defer src.Close()
+
+	upload, err := newTempUpload(src)
+	if err != nil {
+		h.logger(e).Error("Save upload error", zap.Error(err))
+		return err
+	}
+
+	job, err := h.bookImport.ImportBooks(format, upload)
+	if err != nil {
+		h.logger(e).Error("Import books error", zap.Error(err))
+		return err
+	}
+
+	h.logger(e).Info("Import books started", zap.String("job", job.ID), zap.String("format", job.Format))
+	e.Response().Header().Set(echo.HeaderLocation, e.Echo().Reverse("show-import-job", job.ID))
+	return e.JSON(http.StatusAccepted, job)
+}
+
+// ShowImportJob godoc
+// @Summary		Show import job
+// @Security	ApiKeyAuth
+// @Tags		book
+// @Description	show status and per-row report of catalog import
+// @ID			show-import-job
+// @Produce		json
+// @Param		id	path		string	true	"JobID"
+// @Success		200	{object}	model.ImportJob
+// @Failure		401	{object}	model.Problem
+// @Failure		403	{object}	model.Problem
+// @Failure		404	{object}	model.Problem
+// @Router		/books/import/{id} [get]
+func (h *Handler) ShowImportJob(e echo.Context) error {
+	job, err := h.bookImport.GetImportJob(e.Param("id"))
+	if err != nil {
+		h.logger(e).Error("Get import job error", zap.Error(err))
+		return err
+	}
+
+	return e.JSON(http.StatusOK, job)
+}
+
+// tempUpload is a copy of an uploaded file which is deleted once closed.
+type tempUpload struct {
+	*os.File
+}
+
+func newTempUpload(src io.Reader) (*tempUpload, error) {
+	f, err := os.CreateTemp("", "book-import-*")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = io.Copy(f, src); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	return &tempUpload{File: f}, nil
+}
+
+func (u *tempUpload) Close() error {
+	err := u.File.Close()
+	os.Remove(u.File.Name())
+	return err
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type IEmailVerificationService interface {
+	ResendVerification(ctx context.Context, resend model.EmailVerificationResend) error
+	VerifyEmail(ctx context.Context, token string) (int, error)
+}
+
+// VerifyEmail godoc
+// @Summary		Verify email
+// @Tags		user
+// @Description	confirm the account email with the token from the verification link, the token works once
+// @ID			verify-email
+// @Produce		json
+// @Param		token	query		string	true	"verification token"
+// @Success		200		{object}	model.Response
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
+// @Router		/users/verify [get]
+func (h *Handler) VerifyEmail(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
+	defer cancel()
+
+	userID, err := h.verify.VerifyEmail(ctx, e.QueryParam("token"))
+	if err != nil {
+		h.logger(e).Error("VerifyEmail error", zap.Error(err))
+		return err
+	}
+
+	h.logger(e).Info("User email verified", zap.Int("id", userID))
+	return e.JSON(http.StatusOK, makeResponse(userID))
+}
+
+// ResendVerification godoc
+// @Summary		Resend verification email
+// @Tags		user
+// @Description	send one more verification link, at most once a minute, the answer is the same whether the account exists or not
+// @ID			resend-verification
+// @Accept		json
+// @Produce		json
+// @Param		input	body	model.EmailVerificationResend	true	"account email"
+// @Success		202		""
+// @Failure		400		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
+// @Router		/users/verify/resend [post]
+func (h *Handler) ResendVerification(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
+	defer cancel()
+
+	var resend model.EmailVerificationResend
+	if err := e.Bind(&resend); err != nil {
+		h.logger(e).Error("Bind error", zap.Error(err))
+		return err
+	}
+
+	if err := h.verify.ResendVerification(ctx, resend); err != nil {
+		h.logger(e).Error("ResendVerification error", zap.Error(err))
+		return err
+	}
+
+	return e.NoContent(http.StatusAccepted)
+}
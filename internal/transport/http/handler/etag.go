@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+var (
+	errPreconditionRequired = echo.NewHTTPError(http.StatusPreconditionRequired, "If-Match header is required")
+	errInvalidETag          = echo.NewHTTPError(http.StatusBadRequest, "If-Match header must hold the ETag of the record")
+)
+
+// setETag exposes the record version, clients send it back in If-Match when they update the record.
+func setETag(e echo.Context, version int) {
+	e.Response().Header().Set(headerETag, fmt.Sprintf(`"%d"`, version))
+}
+
+// notModified reports whether If-None-Match already names the current version.
+func notModified(e echo.Context, version int) bool {
+	for _, tag := range strings.Split(e.Request().Header.Get(headerIfNoneMatch), ",") {
+		if v, err := parseETag(tag); err == nil && v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatchVersion returns the version named in If-Match. "*" is refused, an update has to name
+// the version it was made against.
+func ifMatchVersion(e echo.Context) (int, error) {
+	header := strings.TrimSpace(e.Request().Header.Get(headerIfMatch))
+	if header == "" {
+		return 0, errPreconditionRequired
+	}
+
+	version, err := parseETag(header)
+	if err != nil {
+		return 0, errInvalidETag
+	}
+
+	return version, nil
+}
+
+func parseETag(tag string) (int, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, errInvalidETag
+	}
+
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil || version <= 0 {
+		return 0, errInvalidETag
+	}
+
+	return version, nil
+}
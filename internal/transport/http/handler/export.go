@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/internal/export"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const _timeoutExport = 5 * time.Minute
+
+// exportFormat returns the format asked with ?format= or the Accept header, "" means the usual JSON response.
+func exportFormat(e echo.Context) string {
+	if format := strings.ToLower(e.QueryParam("format")); format != "" && format != "json" {
+		return format
+	}
+
+	return export.FormatFromAccept(e.Request().Header.Get(echo.HeaderAccept))
+}
+
+// streamExport writes records straight to the response while iterate reads them from storage.
+func (h *Handler) streamExport(e echo.Context, format, name string,
+	iterate func(ctx context.Context, encode func(record interface{}) error) error) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutExport)
+	defer cancel()
+
+	header := e.Response().Header()
+	header.Set(echo.HeaderContentType, export.ContentType(format))
+	header.Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="%s-%s.%s"`, name, time.Now().Format("2006-01-02"), format))
+
+	enc, err := export.NewEncoder(format, e.Response())
+	if err != nil {
+		header.Del(echo.HeaderContentType)
+		header.Del(echo.HeaderContentDisposition)
+		h.logger(e).Error("Export format error", zap.Error(err))
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var count int
+	err = iterate(ctx, func(record interface{}) error {
+		count++
+		return enc.Encode(record)
+	})
+	if err == nil {
+		err = enc.Close()
+	}
+
+	if err != nil {
+		h.logger(e).Error("Export error", zap.String("export", name), zap.Error(err))
+		if !e.Response().Committed {
+			header.Del(echo.HeaderContentType)
+			header.Del(echo.HeaderContentDisposition)
+			return err
+		}
+
+		// the status line is already sent, the client sees a truncated file
+		return nil
+	}
+
+	if !e.Response().Committed {
+		e.Response().WriteHeader(http.StatusOK)
+	}
+
+	h.logger(e).Info("Exported", zap.String("export", name), zap.String("format", format), zap.Int("amount", count))
+	return nil
+}
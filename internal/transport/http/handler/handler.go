@@ -1,10 +1,16 @@
 package handler
 
 import (
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/internal/apperror"
 	"github.com/zhayt/user-storage-service/internal/model"
 	"github.com/zhayt/user-storage-service/internal/service"
 	"github.com/zhayt/user-storage-service/internal/transport/http/middleware"
+	"github.com/zhayt/user-storage-service/logger"
 	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -14,7 +20,11 @@ type Handler struct {
 	log         *zap.Logger
 	user        IUserService
 	book        IBookService
+	bookImport  IBookImportService
 	history     IBIHistoryService
+	bookCopy    IBookCopyService
+	reset       IPasswordResetService
+	verify      IEmailVerificationService
 	rent        service.IRentTransactionService
 	transaction service.ITransactionService
 	mid         *middleware.JWTAuth
@@ -22,15 +32,73 @@ type Handler struct {
 
 func NewHandler(logger *zap.Logger, service *service.Service, auth *middleware.JWTAuth) *Handler {
 	return &Handler{
-		log:     logger,
-		user:    service,
-		book:    service,
-		rent:    service,
-		history: service,
-		mid:     auth,
+		log:        logger,
+		user:       service,
+		book:       service,
+		bookImport: service,
+		rent:       service,
+		history:    service,
+		bookCopy:   service,
+		reset:      service,
+		verify:     service,
+		mid:        auth,
 	}
 }
 
+// logger returns the request scoped logger, its lines carry the request ID.
+func (h *Handler) logger(e echo.Context) *zap.Logger {
+	return logger.FromContext(e.Request().Context(), h.log)
+}
+
 func makeResponse(msg interface{}) *model.Response {
 	return &model.Response{Message: msg}
 }
+
+// HTTPErrorHandler answers every error with an RFC 7807 problem. Clients only see the safe message,
+// the full error of server faults goes to the log.
+func (h *Handler) HTTPErrorHandler(err error, e echo.Context) {
+	if e.Response().Committed {
+		return
+	}
+
+	problem := newProblem(e, err)
+	if problem.Status >= http.StatusInternalServerError {
+		h.logger(e).Error("Request failed", zap.String("method", e.Request().Method),
+			zap.String("path", e.Path()), zap.Error(err))
+	}
+
+	if retryAfter := apperror.RetryAfter(err); retryAfter > 0 {
+		e.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+
+	if e.Request().Method == http.MethodHead {
+		err = e.NoContent(problem.Status)
+	} else {
+		e.Response().Header().Set(echo.HeaderContentType, _mimeProblemJSON)
+		err = e.JSON(problem.Status, problem)
+	}
+	if err != nil {
+		h.logger(e).Error("Write error response error", zap.Error(err))
+	}
+}
+
+func kindStatus(kind apperror.Kind) int {
+	switch kind {
+	case apperror.NotFound:
+		return http.StatusNotFound
+	case apperror.AlreadyExists, apperror.Conflict:
+		return http.StatusConflict
+	case apperror.Validation:
+		return http.StatusUnprocessableEntity
+	case apperror.Unauthorized:
+		return http.StatusUnauthorized
+	case apperror.Forbidden:
+		return http.StatusForbidden
+	case apperror.PreconditionFailed:
+		return http.StatusPreconditionFailed
+	case apperror.TooManyRequests:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
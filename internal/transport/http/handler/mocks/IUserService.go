@@ -101,23 +101,47 @@ func (_m *IUserService) GetUserByID(ctx context.Context, userID int) (model.User
 	return r0, r1
 }
 
-// UpdateUserFIO provides a mock function with given fields: ctx, user
-func (_m *IUserService) UpdateUserFIO(ctx context.Context, user model.UserUpdateFIO) (int, error) {
-	ret := _m.Called(ctx, user)
+// PatchUserFIO provides a mock function with given fields: ctx, userID, version, patch
+func (_m *IUserService) PatchUserFIO(ctx context.Context, userID int, version int, patch model.Patch) (model.User, error) {
+	ret := _m.Called(ctx, userID, version, patch)
+
+	var r0 model.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, int, model.Patch) (model.User, error)); ok {
+		return rf(ctx, userID, version, patch)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int, int, model.Patch) model.User); ok {
+		r0 = rf(ctx, userID, version, patch)
+	} else {
+		r0 = ret.Get(0).(model.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int, int, model.Patch) error); ok {
+		r1 = rf(ctx, userID, version, patch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreUser provides a mock function with given fields: ctx, userID
+func (_m *IUserService) RestoreUser(ctx context.Context, userID int) (int, error) {
+	ret := _m.Called(ctx, userID)
 
 	var r0 int
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, model.UserUpdateFIO) (int, error)); ok {
-		return rf(ctx, user)
+	if rf, ok := ret.Get(0).(func(context.Context, int) (int, error)); ok {
+		return rf(ctx, userID)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, model.UserUpdateFIO) int); ok {
-		r0 = rf(ctx, user)
+	if rf, ok := ret.Get(0).(func(context.Context, int) int); ok {
+		r0 = rf(ctx, userID)
 	} else {
 		r0 = ret.Get(0).(int)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, model.UserUpdateFIO) error); ok {
-		r1 = rf(ctx, user)
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, userID)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type IPasswordResetService interface {
+	ForgotPassword(ctx context.Context, forgot model.PasswordForgot) error
+	ResetPassword(ctx context.Context, reset model.PasswordReset) (int, error)
+}
+
+// ForgotPassword godoc
+// @Summary		Forgot password
+// @Tags		user
+// @Description	email a one-time password reset link, the answer is the same whether the account exists or not
+// @ID			forgot-password
+// @Accept		json
+// @Produce		json
+// @Param		input	body	model.PasswordForgot	true	"account email"
+// @Success		202		""
+// @Failure		400		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
+// @Router		/users/password/forgot [post]
+func (h *Handler) ForgotPassword(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
+	defer cancel()
+
+	var forgot model.PasswordForgot
+	if err := e.Bind(&forgot); err != nil {
+		h.logger(e).Error("Bind error", zap.Error(err))
+		return err
+	}
+
+	if err := h.reset.ForgotPassword(ctx, forgot); err != nil {
+		h.logger(e).Error("ForgotPassword error", zap.Error(err))
+		return err
+	}
+
+	return e.NoContent(http.StatusAccepted)
+}
+
+// ResetPassword godoc
+// @Summary		Reset password
+// @Tags		user
+// @Description	set a new password with the token from the reset link, the token works once
+// @ID			reset-password
+// @Accept		json
+// @Produce		json
+// @Param		input	body		model.PasswordReset	true	"token and new password"
+// @Success		200		{object}	model.Response
+// @Failure		400		{object}	model.Problem
+// @Failure		422		{object}	model.Problem
+// @Failure		500		{object}	model.Problem
+// @Router		/users/password/reset [post]
+func (h *Handler) ResetPassword(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
+	defer cancel()
+
+	var reset model.PasswordReset
+	if err := e.Bind(&reset); err != nil {
+		h.logger(e).Error("Bind error", zap.Error(err))
+		return err
+	}
+
+	userID, err := h.reset.ResetPassword(ctx, reset)
+	if err != nil {
+		h.logger(e).Error("ResetPassword error", zap.Error(err))
+		return err
+	}
+
+	h.logger(e).Info("User password has been reset", zap.Int("id", userID))
+	return e.JSON(http.StatusOK, makeResponse(userID))
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"io"
+	"mime"
+	"net/http"
+)
+
+const _maxPatchSize = 1 << 16
+
+var errUnsupportedPatch = echo.NewHTTPError(http.StatusUnsupportedMediaType,
+	"PATCH body must be application/merge-patch+json or application/json-patch+json")
+
+// readPatch reads the PATCH body, plain JSON is taken as a merge patch so partial updates keep the other fields.
+func readPatch(e echo.Context) (model.Patch, error) {
+	var patch model.Patch
+
+	mediaType, _, err := mime.ParseMediaType(e.Request().Header.Get(echo.HeaderContentType))
+	if err != nil {
+		return patch, errUnsupportedPatch
+	}
+
+	switch mediaType {
+	case model.PatchMerge, echo.MIMEApplicationJSON:
+		patch.Type = model.PatchMerge
+	case model.PatchJSON:
+		patch.Type = model.PatchJSON
+	default:
+		return patch, errUnsupportedPatch
+	}
+
+	patch.Body, err = io.ReadAll(io.LimitReader(e.Request().Body, _maxPatchSize+1))
+	if err != nil {
+		return patch, echo.NewHTTPError(http.StatusBadRequest, "couldn't read body").SetInternal(err)
+	}
+
+	if len(patch.Body) > _maxPatchSize {
+		return patch, echo.NewHTTPError(http.StatusRequestEntityTooLarge, "PATCH body is too large")
+	}
+
+	return patch, nil
+}
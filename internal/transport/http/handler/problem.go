@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"net/http"
+	"strings"
+)
+
+const (
+	_mimeProblemJSON   = "application/problem+json"
+	_problemTypePrefix = "/problems/"
+)
+
+// newProblem describes err for the client. Domain errors get a type named after their kind,
+// errors raised by echo itself are plain HTTP errors and use about:blank.
+func newProblem(e echo.Context, err error) model.Problem {
+	problem := model.Problem{
+		Type:      "about:blank",
+		Instance:  e.Request().URL.Path,
+		RequestID: requestID(e),
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		problem.Status = httpErr.Code
+		problem.Detail = fmt.Sprint(httpErr.Message)
+	} else {
+		kind := apperror.KindOf(err)
+		problem.Status = kindStatus(kind)
+		problem.Type = _problemTypePrefix + strings.ReplaceAll(kind.String(), " ", "-")
+		problem.Detail = apperror.Message(err)
+
+		for _, v := range apperror.Violations(err) {
+			problem.Errors = append(problem.Errors, model.ProblemViolation{Field: v.Field, Message: v.Message})
+		}
+	}
+
+	problem.Title = http.StatusText(problem.Status)
+	if strings.EqualFold(problem.Detail, problem.Title) {
+		problem.Detail = ""
+	}
+
+	return problem
+}
+
+func requestID(e echo.Context) string {
+	if id := e.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+
+	return e.Request().Header.Get(echo.HeaderXRequestID)
+}
@@ -2,9 +2,8 @@ package handler
 
 import (
 	"context"
-	"errors"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/gommon/log"
+	"github.com/zhayt/user-storage-service/internal/apperror"
 	"github.com/zhayt/user-storage-service/internal/model"
 	"go.uber.org/zap"
 	"net/http"
@@ -16,9 +15,10 @@ type IUserService interface {
 	GetUserByID(ctx context.Context, userID int) (model.User, error)
 	GetUserByEmail(ctx context.Context, login model.UserLogin) (model.User, error)
 	CreateUser(ctx context.Context, user model.User) (int, error)
-	UpdateUserFIO(ctx context.Context, user model.UserUpdateFIO) (int, error)
+	PatchUserFIO(ctx context.Context, userID, version int, patch model.Patch) (model.User, error)
 	UpdateUserPassword(ctx context.Context, user model.UserUpdatePassword) (int, error)
 	DeleteUser(ctx context.Context, userID int) error
+	RestoreUser(ctx context.Context, userID int) (int, error)
 }
 
 //		SignUp godoc
@@ -29,9 +29,11 @@ type IUserService interface {
 //		@Accept			json
 //		@Produce		json
 //		@Param			input	body		model.User	true	"user info"
-//		@Success		200		{object}	model.Response
-//		@Failure		400		{object}	model.Response
-//		@Failure		500		{object}	model.Response
+//		@Success		200		{object}	model.SelfUser
+//		@Failure		400		{object}	model.Problem
+//		@Failure		409		{object}	model.Problem
+//		@Failure		422		{object}	model.Problem
+//		@Failure		500		{object}	model.Problem
 //		@Router			/users/sign-up [post]
 func (h *Handler) SignUp(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -39,21 +41,25 @@ func (h *Handler) SignUp(e echo.Context) error {
 
 	var user model.User
 	if err := e.Bind(&user); err != nil {
-		h.log.Error("Bind error", zap.Error(err))
-		return e.JSON(http.StatusBadRequest, makeResponse(err.Error()))
+		h.logger(e).Error("Bind error", zap.Error(err))
+		return err
 	}
 
 	userID, err := h.user.CreateUser(ctx, user)
 	if err != nil {
-		h.log.Error("Create user error", zap.Error(err))
-		return e.JSON(http.StatusInternalServerError, makeResponse(err.Error()))
+		h.logger(e).Error("Create user error", zap.Error(err))
+		return err
 	}
 
-	user.ID = userID
+	// read back the stored account, the password must not be echoed
+	if user, err = h.user.GetUserByID(ctx, userID); err != nil {
+		h.logger(e).Error("GetUserByID error", zap.Error(err))
+		return err
+	}
 
-	h.log.Info("User created", zap.Int("id", userID))
+	h.logger(e).Info("User created", zap.Int("id", userID))
 
-	return e.JSON(http.StatusOK, user)
+	return e.JSON(http.StatusOK, model.NewSelfUser(user))
 }
 
 //	 SignIn godoc
@@ -65,8 +71,11 @@ func (h *Handler) SignUp(e echo.Context) error {
 //		@Produce		json
 //		@Param			input	body		model.UserLogin	true	"credentials"
 //		@Success		200		{string}	string			"token"
-//		@Failure		400		{object}	model.Response
-//		@Failure		500		{object}	model.Response
+//		@Failure		400		{object}	model.Problem
+//		@Failure		401		{object}	model.Problem
+//		@Failure		429		{object}	model.Problem
+//		@Failure		500		{object}	model.Problem
+//		@Header			429		{integer}	Retry-After	"seconds to wait"
 //		@Router			/users/sign-in [post]
 func (h *Handler) SignIn(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -74,23 +83,25 @@ func (h *Handler) SignIn(e echo.Context) error {
 
 	var userLogin model.UserLogin
 	if err := e.Bind(&userLogin); err != nil {
-		h.log.Error("Bind error", zap.Error(err))
-		return e.JSON(http.StatusBadRequest, makeResponse(err.Error()))
+		h.logger(e).Error("Bind error", zap.Error(err))
+		return err
 	}
 
+	userLogin.IP = e.RealIP()
+
 	user, err := h.user.GetUserByEmail(ctx, userLogin)
 	if err != nil {
-		log.Error("Get user error", zap.Error(err))
-		return e.JSON(http.StatusBadRequest, makeResponse(err.Error()))
+		h.logger(e).Error("Get user error", zap.Error(err))
+		return err
 	}
 
-	token, err := h.mid.GenerateJWT(user.FIO, user.ID)
+	token, err := h.mid.GenerateJWT(user.FIO, user.ID, user.Role)
 	if err != nil {
-		h.log.Error("Generate token error", zap.Error(err))
-		return e.JSON(http.StatusInternalServerError, makeResponse(err.Error()))
+		h.logger(e).Error("Generate token error", zap.Error(err))
+		return err
 	}
 
-	h.log.Info("User sign-in JWT created", zap.Int("id", user.ID))
+	h.logger(e).Info("User sign-in JWT created", zap.Int("id", user.ID))
 	return e.JSON(http.StatusOK, map[string]interface{}{
 		"token": token,
 	})
@@ -100,12 +111,15 @@ func (h *Handler) SignIn(e echo.Context) error {
 //
 //	@Summary		ShowUser
 //	@Tags			user
-//	@Description	show user information
+//	@Security		ApiKeyAuth
+//	@Description	show user information, the user itself gets model.SelfUser and admins get model.AdminUser
 //	@ID				get-user
 //	@Produce		json
 //	@Param			id	path		integer	true	"UserID"
-//	@Success		200	{object}	model.User
-//	@Failure		404	{object}	model.Response
+//	@Success		200	{object}	model.PublicUser
+//	@Success		304	""
+//	@Failure		404	{object}	model.Problem
+//	@Header			200	{string}	ETag	"user version"
 //	@Router			/users/{id} [get]
 func (h *Handler) ShowUser(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -113,18 +127,23 @@ func (h *Handler) ShowUser(e echo.Context) error {
 
 	userID, err := strconv.Atoi(e.Param("id"))
 	if err != nil {
-		h.log.Error("Param error", zap.Error(err))
-		return e.JSON(http.StatusNotFound, makeResponse(err.Error()))
+		h.logger(e).Error("Param error", zap.Error(err))
+		return echo.ErrNotFound
 	}
 
 	user, err := h.user.GetUserByID(ctx, userID)
 	if err != nil {
-		h.log.Error("GetUserByID error", zap.Error(err))
-		return e.JSON(http.StatusNotFound, makeResponse(err.Error()))
+		h.logger(e).Error("GetUserByID error", zap.Error(err))
+		return err
+	}
+
+	setETag(e, user.Version)
+	if notModified(e, user.Version) {
+		return e.NoContent(http.StatusNotModified)
 	}
 
-	h.log.Info("Show user", zap.Int("id", userID))
-	return e.JSON(http.StatusOK, user)
+	h.logger(e).Info("Show user", zap.Int("id", userID))
+	return e.JSON(http.StatusOK, userView(e, user))
 }
 
 // UpdateUserFIO godoc
@@ -132,14 +151,22 @@ func (h *Handler) ShowUser(e echo.Context) error {
 //	@Summary		UpdateUser
 //	@Security		ApiKeyAuth
 //	@Tags			user
-//	@Description	update user FIO
+//	@Description	patch user FIO with JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902)
 //	@ID				update-user-fio
-//	@Reduce			json
+//	@Accept			json
+//	@Accept			application/merge-patch+json
+//	@Accept			application/json-patch+json
 //	@Produce		json
-//	@Param			input	body		model.UserUpdateFIO	true	"user info"
-//	@Success		200		{object}	model.Response
-//	@Failure		401		{object}	model.Response
-//	@Failure		500		{object}	model.Response
+//	@Param			If-Match	header		string				true	"ETag from GET /users/{id}"
+//	@Param			input		body		model.UserUpdateFIO	true	"user info"
+//	@Success		200		{object}	model.SelfUser
+//	@Failure		400		{object}	model.Problem
+//	@Failure		401		{object}	model.Problem
+//	@Failure		412		{object}	model.Problem
+//	@Failure		415		{object}	model.Problem
+//	@Failure		422		{object}	model.Problem
+//	@Failure		428		{object}	model.Problem
+//	@Failure		500		{object}	model.Problem
 //	@Router			/users/settings/profile [patch]
 func (h *Handler) UpdateUserFIO(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -147,27 +174,32 @@ func (h *Handler) UpdateUserFIO(e echo.Context) error {
 
 	userID, err := getUserID(e)
 	if err != nil {
-		h.log.Error("Authorization error", zap.Error(err))
-		return e.JSON(http.StatusUnauthorized, makeResponse(err.Error()))
+		h.logger(e).Error("Authorization error", zap.Error(err))
+		return err
 	}
 
-	var userdata model.UserUpdateFIO
-
-	if err = e.Bind(&userdata); err != nil {
-		h.log.Error("Bind error", zap.Error(err))
-		return e.JSON(http.StatusBadRequest, makeResponse(err.Error()))
+	version, err := ifMatchVersion(e)
+	if err != nil {
+		h.logger(e).Error("Precondition error", zap.Error(err))
+		return err
 	}
 
-	userdata.ID = userID
+	patch, err := readPatch(e)
+	if err != nil {
+		h.logger(e).Error("Patch error", zap.Error(err))
+		return err
+	}
 
-	userID, err = h.user.UpdateUserFIO(ctx, userdata)
+	user, err := h.user.PatchUserFIO(ctx, userID, version, patch)
 	if err != nil {
-		h.log.Error("UpdateUserFIO error", zap.Error(err))
-		return e.JSON(http.StatusInternalServerError, makeResponse(err.Error()))
+		h.logger(e).Error("UpdateUserFIO error", zap.Error(err))
+		return err
 	}
 
-	h.log.Info("User FIO has been changed", zap.Int("id", userID))
-	return e.JSON(http.StatusOK, makeResponse(userID))
+	setETag(e, user.Version)
+
+	h.logger(e).Info("User FIO has been changed", zap.Int("id", userID))
+	return e.JSON(http.StatusOK, model.NewSelfUser(user))
 }
 
 // UpdateUserPassword godoc
@@ -181,9 +213,10 @@ func (h *Handler) UpdateUserFIO(e echo.Context) error {
 //	@Produce		json
 //	@Param			input	body		model.UserUpdatePassword	true	"user info"
 //	@Success		200		{object}	model.Response
-//	@Failure		400		{object}	model.Response
-//	@Failure		401		{object}	model.Response
-//	@Failure		500		{object}	model.Response
+//	@Failure		400		{object}	model.Problem
+//	@Failure		401		{object}	model.Problem
+//	@Failure		422		{object}	model.Problem
+//	@Failure		500		{object}	model.Problem
 //	@Router			/users/settings/password [patch]
 func (h *Handler) UpdateUserPassword(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -191,15 +224,15 @@ func (h *Handler) UpdateUserPassword(e echo.Context) error {
 
 	userID, err := getUserID(e)
 	if err != nil {
-		h.log.Error("Authorization error", zap.Error(err))
-		return e.JSON(http.StatusUnauthorized, makeResponse(err.Error()))
+		h.logger(e).Error("Authorization error", zap.Error(err))
+		return err
 	}
 
 	var userPasswd model.UserUpdatePassword
 
 	if err = e.Bind(&userPasswd); err != nil {
-		h.log.Error("Bind error", zap.Error(err))
-		return e.JSON(http.StatusBadRequest, makeResponse(err.Error()))
+		h.logger(e).Error("Bind error", zap.Error(err))
+		return err
 	}
 
 	userPasswd.ID = userID
@@ -207,11 +240,11 @@ func (h *Handler) UpdateUserPassword(e echo.Context) error {
 	userID, err = h.user.UpdateUserPassword(ctx, userPasswd)
 	if err != nil {
 		// will be Server or Client error
-		h.log.Error("UpdateUserPassword error", zap.Error(err))
-		return e.JSON(http.StatusBadRequest, makeResponse(err.Error()))
+		h.logger(e).Error("UpdateUserPassword error", zap.Error(err))
+		return err
 	}
 
-	h.log.Info("User password has been changed", zap.Int("id", userID))
+	h.logger(e).Info("User password has been changed", zap.Int("id", userID))
 	return e.JSON(http.StatusOK, makeResponse(userID))
 }
 
@@ -223,8 +256,9 @@ func (h *Handler) UpdateUserPassword(e echo.Context) error {
 // @ID			delete-user
 // @Produce		json
 // @Success		200	{object}	model.Response
-// @Failure		400	{object}	model.Response
-// @Failure		401	{object}	model.Response
+// @Failure		400	{object}	model.Problem
+// @Failure		401	{object}	model.Problem
+// @Failure		422	{object}	model.Problem
 // @Router		/users/settings/profile [delete]
 func (h *Handler) DeleteUser(e echo.Context) error {
 	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
@@ -232,23 +266,74 @@ func (h *Handler) DeleteUser(e echo.Context) error {
 
 	userID, err := getUserID(e)
 	if err != nil {
-		h.log.Error("Authorization error", zap.Error(err))
-		return e.JSON(http.StatusUnauthorized, makeResponse(err.Error()))
+		h.logger(e).Error("Authorization error", zap.Error(err))
+		return err
 	}
 
 	if err = h.user.DeleteUser(ctx, userID); err != nil {
-		h.log.Error("DeleteUser error")
-		return e.JSON(http.StatusBadRequest, makeResponse(err.Error()))
+		h.logger(e).Error("DeleteUser error")
+		return err
+	}
+
+	h.logger(e).Info("User deleted", zap.Int("id", userID))
+	return e.JSON(http.StatusOK, makeResponse(userID))
+}
+
+// RestoreUser godoc
+// @Summary		Restore User
+// @Security	ApiKeyAuth
+// @Tags		admin
+// @Description	restore deleted user
+// @ID			restore-user
+// @Produce		json
+// @Param		id	path		integer	true	"UserID"
+// @Success		200	{object}	model.Response
+// @Failure		401	{object}	model.Problem
+// @Failure		403	{object}	model.Problem
+// @Failure		404	{object}	model.Problem
+// @Failure		500	{object}	model.Problem
+// @Router		/admin/users/{id}/restore [post]
+func (h *Handler) RestoreUser(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), _timeoutContext)
+	defer cancel()
+
+	userID, err := strconv.Atoi(e.Param("id"))
+	if err != nil {
+		h.logger(e).Error("Param error", zap.Error(err))
+		return echo.ErrNotFound
+	}
+
+	if _, err = h.user.RestoreUser(ctx, userID); err != nil {
+		h.logger(e).Error("RestoreUser error", zap.Error(err))
+		return err
 	}
 
-	h.log.Info("User deleted", zap.Int("id", userID))
+	h.logger(e).Info("User restored", zap.Int("id", userID))
 	return e.JSON(http.StatusOK, makeResponse(userID))
 }
 
+// userView picks what the caller may see of the user, anonymous callers get the public profile.
+func userView(e echo.Context, user model.User) interface{} {
+	if isAdmin(e) {
+		return model.NewAdminUser(user)
+	}
+
+	if userID, err := getUserID(e); err == nil && userID == user.ID {
+		return model.NewSelfUser(user)
+	}
+
+	return model.NewPublicUser(user)
+}
+
+func isAdmin(e echo.Context) bool {
+	role, _ := e.Request().Context().Value(model.ContextUserRole).(string)
+	return role == model.RoleAdmin
+}
+
 func getUserID(e echo.Context) (int, error) {
 	id, ok := e.Request().Context().Value(model.ContextUserID).(int)
 	if !ok {
-		return 0, errors.New("user id is of invalid type")
+		return 0, apperror.New(apperror.Unauthorized, "authorization required")
 	}
 
 	return id, nil
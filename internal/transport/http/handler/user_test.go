@@ -3,13 +3,19 @@ package handler
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/mock"
+	"github.com/zhayt/user-storage-service/internal/apperror"
 	"github.com/zhayt/user-storage-service/internal/model"
 	"github.com/zhayt/user-storage-service/internal/transport/http/handler/mocks"
 	"go.uber.org/zap"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -29,7 +35,7 @@ func TestHandler_ShowUser(t *testing.T) {
 		{
 			name:           "User Not Found",
 			id:             "2",
-			getUserByIDErr: sql.ErrNoRows,
+			getUserByIDErr: apperror.Wrap(apperror.NotFound, "user not found", sql.ErrNoRows),
 			expectedStatus: http.StatusNotFound,
 		},
 	}
@@ -54,7 +60,7 @@ func TestHandler_ShowUser(t *testing.T) {
 			} else {
 				userService.On("GetUserByID", mock.Anything, mock.AnythingOfType("int")).
 					Return(func(ctx context.Context, userID int) (model.User, error) {
-						return model.User{}, sql.ErrNoRows
+						return model.User{}, tc.getUserByIDErr
 					})
 			}
 
@@ -63,9 +69,8 @@ func TestHandler_ShowUser(t *testing.T) {
 				user: userService,
 			}
 
-			err := h.ShowUser(c)
-			if err != nil {
-				t.Fatalf("unexpected error: want %v, got %v", tc.getUserByIDErr, err)
+			if err := h.ShowUser(c); err != nil {
+				h.HTTPErrorHandler(err, c)
 			}
 
 			if rec.Code != tc.expectedStatus {
@@ -74,3 +79,136 @@ func TestHandler_ShowUser(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_HTTPErrorHandler(t *testing.T) {
+	testCases := []struct {
+		name            string
+		err             error
+		expectedProblem model.Problem
+	}{
+		{
+			name: "Not found",
+			err:  fmt.Errorf("couldn't take book: %w", apperror.Wrap(apperror.NotFound, "book not found", sql.ErrNoRows)),
+			expectedProblem: model.Problem{Type: "/problems/not-found", Title: "Not Found", Status: http.StatusNotFound,
+				Detail: "book not found"},
+		},
+		{
+			name: "Already exists",
+			err:  apperror.Wrap(apperror.AlreadyExists, "user already exists", errors.New("duplicate key")),
+			expectedProblem: model.Problem{Type: "/problems/already-exists", Title: "Conflict", Status: http.StatusConflict,
+				Detail: "user already exists"},
+		},
+		{
+			name: "Validation",
+			err:  apperror.Invalid(apperror.Violation{Field: "fio", Message: "must be 3 to 50 characters"}),
+			expectedProblem: model.Problem{Type: "/problems/validation-failed", Title: "Unprocessable Entity",
+				Status: http.StatusUnprocessableEntity, Detail: "validation failed",
+				Errors: []model.ProblemViolation{{Field: "fio", Message: "must be 3 to 50 characters"}}},
+		},
+		{
+			name: "Forbidden",
+			err:  apperror.New(apperror.Forbidden, "admin role required"),
+			expectedProblem: model.Problem{Type: "/problems/forbidden", Title: "Forbidden", Status: http.StatusForbidden,
+				Detail: "admin role required"},
+		},
+		{
+			name:            "Echo error",
+			err:             echo.ErrNotFound,
+			expectedProblem: model.Problem{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound},
+		},
+		{
+			name: "Raw SQL error is hidden",
+			err:  errors.New(`pq: relation "book" does not exist`),
+			expectedProblem: model.Problem{Type: "/problems/internal-error", Title: "Internal Server Error",
+				Status: http.StatusInternalServerError, Detail: "internal error"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/books/1", nil)
+			req.Header.Set(echo.HeaderXRequestID, "req-1")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			h := &Handler{log: zap.NewNop()}
+			h.HTTPErrorHandler(tc.err, c)
+
+			if rec.Code != tc.expectedProblem.Status {
+				t.Errorf("unexpected status code: want %d, got %d", tc.expectedProblem.Status, rec.Code)
+			}
+
+			if ct := rec.Header().Get(echo.HeaderContentType); ct != "application/problem+json" {
+				t.Errorf("unexpected content type: %s", ct)
+			}
+
+			var problem model.Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("couldn't decode problem: %v", err)
+			}
+
+			tc.expectedProblem.Instance = "/api/v1/books/1"
+			tc.expectedProblem.RequestID = "req-1"
+			if !reflect.DeepEqual(problem, tc.expectedProblem) {
+				t.Errorf("unexpected problem: want %+v, got %+v", tc.expectedProblem, problem)
+			}
+		})
+	}
+}
+
+func TestHandler_ShowUserView(t *testing.T) {
+	stored := model.User{ID: 1, FIO: "Aybek", Email: "example@mail.ru", Password: "$2a$10$hash", Role: model.RoleReader, Version: 3}
+
+	testCases := []struct {
+		name         string
+		viewerID     int
+		viewerRole   string
+		expectedKeys []string
+	}{
+		{name: "Anonymous", expectedKeys: []string{"fio", "id"}},
+		{name: "Other user", viewerID: 2, viewerRole: model.RoleReader, expectedKeys: []string{"fio", "id"}},
+		{name: "Self", viewerID: 1, viewerRole: model.RoleReader, expectedKeys: []string{"email", "emailVerified", "fio", "id", "role", "version"}},
+		{name: "Admin", viewerID: 2, viewerRole: model.RoleAdmin, expectedKeys: []string{"email", "fio", "id", "role", "version"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1", nil)
+			if tc.viewerID != 0 {
+				ctx := context.WithValue(req.Context(), model.ContextUserID, tc.viewerID)
+				ctx = context.WithValue(ctx, model.ContextUserRole, tc.viewerRole)
+				req = req.WithContext(ctx)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath("/users/:id")
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			userService := mocks.NewIUserService(t)
+			userService.On("GetUserByID", mock.Anything, 1).Return(stored, nil)
+
+			h := &Handler{log: zap.NewNop(), user: userService}
+			if err := h.ShowUser(c); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("couldn't decode body: %v", err)
+			}
+
+			keys := make([]string, 0, len(body))
+			for key := range body {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			if !reflect.DeepEqual(keys, tc.expectedKeys) {
+				t.Errorf("unexpected fields: want %v, got %v", tc.expectedKeys, keys)
+			}
+		})
+	}
+}
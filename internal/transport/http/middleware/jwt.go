@@ -6,6 +6,7 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo/v4"
 	"github.com/zhayt/user-storage-service/config"
+	"github.com/zhayt/user-storage-service/internal/apperror"
 	"github.com/zhayt/user-storage-service/internal/model"
 	"net/http"
 	"strings"
@@ -20,12 +21,13 @@ func NewJWTAuth(cfg *config.Config) *JWTAuth {
 	return &JWTAuth{jwtKey: []byte(cfg.JWTKey)}
 }
 
-func (m *JWTAuth) GenerateJWT(username string, userID int) (tokenString string, err error) {
+func (m *JWTAuth) GenerateJWT(username string, userID int, role string) (tokenString string, err error) {
 	expirationTime := time.Now().Add(12 * time.Hour)
 
 	claims := &model.JWTClaim{
 		Username: username,
 		UserID:   userID,
+		Role:     role,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 		},
@@ -66,11 +68,12 @@ func (m *JWTAuth) ValidateAuth(next echo.HandlerFunc) echo.HandlerFunc {
 		if token != "" {
 			claims, err := m.ValidateToken(token)
 			if err != nil {
-				return echo.NewHTTPError(403, err.Error())
+				return apperror.Wrap(apperror.Unauthorized, "invalid token", err)
 			}
 
 			ctx := context.WithValue(e.Request().Context(), model.ContextUserID, claims.UserID)
 			ctx = context.WithValue(ctx, model.ContextUserName, claims.Username)
+			ctx = context.WithValue(ctx, model.ContextUserRole, claims.Role)
 			e.SetRequest(e.Request().WithContext(ctx))
 		}
 
@@ -78,6 +81,34 @@ func (m *JWTAuth) ValidateAuth(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// RequireAuth refuses anonymous requests, ValidateAuth only checks a token when there is one.
+// It must run after ValidateAuth.
+func (m *JWTAuth) RequireAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(e echo.Context) error {
+		if _, ok := e.Request().Context().Value(model.ContextUserID).(int); !ok {
+			return apperror.New(apperror.Unauthorized, "authorization required")
+		}
+
+		return next(e)
+	}
+}
+
+// RequireAdmin must run after ValidateAuth.
+func (m *JWTAuth) RequireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(e echo.Context) error {
+		role, ok := e.Request().Context().Value(model.ContextUserRole).(string)
+		if !ok {
+			return apperror.New(apperror.Unauthorized, "authorization required")
+		}
+
+		if role != model.RoleAdmin {
+			return apperror.New(apperror.Forbidden, "admin role required")
+		}
+
+		return next(e)
+	}
+}
+
 func extractToken(r *http.Request) string {
 	bearToken := r.Header.Get("Authorization")
 	strArr := strings.Split(bearToken, " ")
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/logger"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"time"
+)
+
+// RequestLogger puts a logger tagged with the request ID, and the trace ID if the request is traced,
+// into the request context and writes one access line per request. It must run after the request ID
+// and the tracing middleware.
+func RequestLogger(l *zap.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(e echo.Context) error {
+			start := time.Now()
+
+			reqLog := l.With(zap.String("requestID", e.Response().Header().Get(echo.HeaderXRequestID)))
+			if sc := trace.SpanContextFromContext(e.Request().Context()); sc.HasTraceID() {
+				reqLog = reqLog.With(zap.String("traceID", sc.TraceID().String()))
+			}
+			e.SetRequest(e.Request().WithContext(logger.WithContext(e.Request().Context(), reqLog)))
+
+			err := next(e)
+			if err != nil {
+				trace.SpanFromContext(e.Request().Context()).RecordError(err)
+				// let the error handler write the response, so the status below is the one sent
+				e.Error(err)
+			}
+
+			req, res := e.Request(), e.Response()
+			fields := []zap.Field{
+				zap.String("method", req.Method),
+				zap.String("path", req.URL.Path),
+				zap.String("route", e.Path()),
+				zap.Int("status", res.Status),
+				zap.Duration("latency", time.Since(start)),
+				zap.Int64("bytes", res.Size),
+				zap.String("ip", e.RealIP()),
+			}
+
+			if userID, ok := req.Context().Value(model.ContextUserID).(int); ok {
+				fields = append(fields, zap.Int("userID", userID))
+			}
+
+			reqLog.Info("Request", fields...)
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	echomw "github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhayt/user-storage-service/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestLogger(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+
+	e := echo.New()
+	e.Use(echomw.RequestID(), RequestLogger(zap.New(core)))
+	e.GET("/books/:id", func(e echo.Context) error {
+		logger.FromContext(e.Request().Context(), zap.NewNop()).Info("Show book")
+		return echo.ErrNotFound
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/books/7", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, "req-1", rec.Header().Get(echo.HeaderXRequestID))
+
+	entries := logs.AllUntimed()
+	if !assert.Len(t, entries, 2) {
+		return
+	}
+
+	for _, entry := range entries {
+		assert.Equal(t, "req-1", entry.ContextMap()["requestID"], entry.Message)
+	}
+
+	access := entries[1].ContextMap()
+	assert.Equal(t, "Request", entries[1].Message)
+	assert.Equal(t, "/books/:id", access["route"])
+	assert.EqualValues(t, http.StatusNotFound, access["status"], "the status written by the error handler")
+}
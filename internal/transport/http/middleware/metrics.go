@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/internal/metrics"
+	"strconv"
+	"time"
+)
+
+// Metrics counts requests and their latency per route. It must run before RequestLogger,
+// which writes the error responses, so the status seen here is the one sent.
+func Metrics(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(e echo.Context) error {
+		start := time.Now()
+
+		err := next(e)
+
+		route := e.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := e.Response().Status
+		if err != nil && !e.Response().Committed {
+			// nothing wrote the error yet, it is going to be answered by the error handler
+			if httpErr, ok := err.(*echo.HTTPError); ok {
+				status = httpErr.Code
+			} else {
+				status = 500
+			}
+		}
+
+		labels := []string{e.Request().Method, route, strconv.Itoa(status)}
+		metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+		metrics.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
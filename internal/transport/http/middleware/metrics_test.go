@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhayt/user-storage-service/internal/metrics"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	e := echo.New()
+	e.Use(Metrics, RequestLogger(zap.NewNop()))
+	e.GET("/books/:id", func(e echo.Context) error {
+		if e.Param("id") == "0" {
+			return echo.ErrNotFound
+		}
+		return e.NoContent(http.StatusOK)
+	})
+
+	ok := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/books/:id", "200")
+	notFound := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/books/:id", "404")
+	unmatched := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404")
+	before := []float64{testutil.ToFloat64(ok), testutil.ToFloat64(notFound), testutil.ToFloat64(unmatched)}
+
+	for _, path := range []string{"/books/1", "/books/2", "/books/0", "/nowhere/1"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, before[0]+2, testutil.ToFloat64(ok))
+	assert.Equal(t, before[1]+1, testutil.ToFloat64(notFound), "the status written by the error handler")
+	assert.Equal(t, before[2]+1, testutil.ToFloat64(unmatched), "unknown paths share one route label")
+}
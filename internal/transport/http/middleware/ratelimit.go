@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/config"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/ratelimit"
+	"go.uber.org/zap"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+)
+
+// RateLimiter counts requests per client within route groups, and all requests to the API together.
+// A client is the user of a valid JWT, or the client IP for anonymous requests.
+type RateLimiter struct {
+	limiter ratelimit.Limiter
+	auth    *JWTAuth
+	global  ratelimit.Limit
+	groups  map[string]ratelimit.Limit
+	log     *zap.Logger
+}
+
+func NewRateLimiter(cfg *config.Config, logger *zap.Logger, limiter ratelimit.Limiter, auth *JWTAuth) (*RateLimiter, error) {
+	m := &RateLimiter{limiter: limiter, auth: auth, groups: make(map[string]ratelimit.Limit), log: logger}
+
+	limits := map[string]string{
+		"users":  cfg.RateLimitUsers,
+		"books":  cfg.RateLimitBooks,
+		"copies": cfg.RateLimitCopies,
+		"rents":  cfg.RateLimitRents,
+		"admin":  cfg.RateLimitAdmin,
+	}
+
+	for group, s := range limits {
+		limit, err := ratelimit.ParseLimit(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s rate limit: %w", group, err)
+		}
+		m.groups[group] = limit
+	}
+
+	var err error
+	if m.global, err = ratelimit.ParseLimit(cfg.RateLimitGlobal); err != nil {
+		return nil, fmt.Errorf("cannot read global rate limit: %w", err)
+	}
+
+	return m, nil
+}
+
+// Global caps the whole API whoever calls it. Probes and docs outside /api are not counted.
+func (m *RateLimiter) Global(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(e echo.Context) error {
+		if !strings.HasPrefix(e.Request().URL.Path, "/api/") {
+			return next(e)
+		}
+
+		res, ok := m.allow(e, "global", m.global)
+		if !ok {
+			return apperror.Throttled("server is busy, try again later", res.RetryAfter)
+		}
+
+		return next(e)
+	}
+}
+
+// Group limits every client within the named route group separately and tells it where it stands
+// with the RateLimit-* headers.
+func (m *RateLimiter) Group(name string) echo.MiddlewareFunc {
+	limit, ok := m.groups[name]
+	if !ok {
+		panic("middleware: unknown rate limit group " + name)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(e echo.Context) error {
+			res, ok := m.allow(e, name+":"+m.client(e), limit)
+			if res.Limit > 0 {
+				h := e.Response().Header()
+				h.Set(HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+				h.Set(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+				h.Set(HeaderRateLimitReset, seconds(res.Reset))
+			}
+
+			if !ok {
+				return apperror.Throttled("rate limit exceeded", res.RetryAfter)
+			}
+
+			return next(e)
+		}
+	}
+}
+
+// allow lets the request through when the limiter fails, a broken limiter must not take the API down.
+func (m *RateLimiter) allow(e echo.Context, key string, limit ratelimit.Limit) (ratelimit.Result, bool) {
+	if limit.Unlimited() {
+		return ratelimit.Result{Allowed: true}, true
+	}
+
+	res, err := m.limiter.Allow(e.Request().Context(), key, limit)
+	if err != nil {
+		m.log.Error("Rate limit error", zap.String("key", key), zap.Error(err))
+		return ratelimit.Result{}, true
+	}
+
+	return res, res.Allowed
+}
+
+// client is the key the requests of e are counted under. The IP comes from the IPExtractor of the
+// server, a client can't get a fresh bucket by sending another X-Forwarded-For.
+func (m *RateLimiter) client(e echo.Context) string {
+	if token := extractToken(e.Request()); token != "" {
+		if claims, err := m.auth.ValidateToken(token); err == nil {
+			return "user:" + strconv.Itoa(claims.UserID)
+		}
+	}
+
+	return "ip:" + e.RealIP()
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
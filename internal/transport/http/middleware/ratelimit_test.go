@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhayt/user-storage-service/config"
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"github.com/zhayt/user-storage-service/internal/ratelimit"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimiter_Group(t *testing.T) {
+	cfg := &config.Config{JWTKey: "secret", RateLimit: config.RateLimit{RateLimitBooks: "2/m"}}
+	auth := NewJWTAuth(cfg)
+
+	m, err := NewRateLimiter(cfg, zap.NewNop(), ratelimit.NewMemoryLimiter(), auth)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	e := echo.New()
+	handler := m.Group("books")(func(e echo.Context) error { return e.NoContent(http.StatusOK) })
+
+	call := func(token string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/books", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		return rec, handler(e.NewContext(req, rec))
+	}
+
+	rec, err := call("")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", rec.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", rec.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "30", rec.Header().Get(HeaderRateLimitReset))
+
+	_, err = call("")
+	assert.NoError(t, err)
+
+	rec, err = call("")
+	assert.Equal(t, apperror.TooManyRequests, apperror.KindOf(err))
+	assert.Equal(t, "0", rec.Header().Get(HeaderRateLimitRemaining))
+
+	token, err := auth.GenerateJWT("Reader", 7, model.RoleReader)
+	assert.NoError(t, err)
+
+	_, err = call(token)
+	assert.NoError(t, err, "signed in users are counted by user id, not by ip")
+}
+
+func TestNewRateLimiter_InvalidLimit(t *testing.T) {
+	cfg := &config.Config{RateLimit: config.RateLimit{RateLimitRents: "lots"}}
+
+	_, err := NewRateLimiter(cfg, zap.NewNop(), ratelimit.NewMemoryLimiter(), NewJWTAuth(cfg))
+	assert.Error(t, err)
+}
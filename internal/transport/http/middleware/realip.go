@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"net"
+	"strings"
+)
+
+// IPExtractor tells where echo.Context.RealIP takes the client IP from, the sign-in guard and the
+// rate limits key on it. Without trusted proxies it is the address of the peer, any header
+// naming another one could be forged. Behind proxies X-Forwarded-For is read from the right,
+// the first address outside trustedProxies is the client. The proxies are IPs or CIDR ranges.
+func IPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read trusted proxy %q: %w", proxy, err)
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// ClientIP puts the client IP into the request context, the storage keeps the reads of a client
+// that has just written on the primary by it, anonymous ones too.
+func ClientIP(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(e echo.Context) error {
+		ctx := context.WithValue(e.Request().Context(), model.ContextClientIP, e.RealIP())
+		e.SetRequest(e.Request().WithContext(ctx))
+
+		return next(e)
+	}
+}
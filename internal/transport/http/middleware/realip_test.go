@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zhayt/user-storage-service/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPExtractor(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		peer    string
+		xff     string
+		want    string
+	}{
+		{"forged headers without proxies", nil, "203.0.113.7:1234", "198.51.100.1", "203.0.113.7"},
+		{"from a trusted proxy", []string{"10.0.0.0/8"}, "10.0.0.2:1234", "198.51.100.1", "198.51.100.1"},
+		{"forged before the proxy", []string{"10.0.0.2"}, "10.0.0.2:1234", "198.51.100.1, 203.0.113.7", "203.0.113.7"},
+		{"not from a trusted proxy", []string{"10.0.0.0/8"}, "203.0.113.7:1234", "198.51.100.1", "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extract, err := IPExtractor(tt.proxies)
+			require.NoError(t, err)
+
+			e := echo.New()
+			e.IPExtractor = extract
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/users/sign-in", nil)
+			req.RemoteAddr = tt.peer
+			req.Header.Set(echo.HeaderXForwardedFor, tt.xff)
+			req.Header.Set(echo.HeaderXRealIP, "198.51.100.1")
+			c := e.NewContext(req, httptest.NewRecorder())
+
+			assert.Equal(t, tt.want, c.RealIP())
+			assert.Equal(t, "ip:"+tt.want, (&RateLimiter{}).client(c), "the rate limit key follows the client IP")
+
+			require.NoError(t, ClientIP(func(c echo.Context) error {
+				assert.Equal(t, tt.want, c.Request().Context().Value(model.ContextClientIP), "the storage gets the same client IP")
+				return nil
+			})(c))
+		})
+	}
+}
+
+func TestIPExtractor_InvalidProxy(t *testing.T) {
+	_, err := IPExtractor([]string{"proxy.local"})
+	assert.Error(t, err)
+}
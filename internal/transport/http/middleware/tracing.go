@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/zhayt/user-storage-service/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/semconv/v1.17.0/httpconv"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Tracing starts a server span for each request, continuing the trace of the caller if its
+// traceparent header is present. Like Metrics it must run before RequestLogger.
+func Tracing(serverName string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(e echo.Context) error {
+			req := e.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			route := e.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			ctx, span := tracing.Start(ctx, fmt.Sprintf("%s %s", req.Method, route),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(httpconv.ServerRequest(serverName, req)...),
+				trace.WithAttributes(semconv.HTTPRoute(route)))
+			defer span.End()
+
+			e.SetRequest(req.WithContext(ctx))
+
+			err := next(e)
+
+			status := e.Response().Status
+			if err != nil && !e.Response().Committed {
+				status = http.StatusInternalServerError
+				if httpErr, ok := err.(*echo.HTTPError); ok {
+					status = httpErr.Code
+				}
+				span.RecordError(err)
+			}
+
+			span.SetAttributes(semconv.HTTPStatusCode(status))
+			span.SetStatus(httpconv.ServerStatus(status))
+
+			return err
+		}
+	}
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/swaggo/echo-swagger"
+	"github.com/zhayt/user-storage-service/internal/metrics"
 	"net/http"
 )
 
@@ -13,28 +14,48 @@ func (s *Server) SetUpRoute() {
 	s.App.GET("/live", func(e echo.Context) error {
 		return e.NoContent(http.StatusOK)
 	})
+	s.App.GET("/ready", echo.WrapHandler(s.ready))
+	s.App.GET("/metrics", echo.WrapHandler(metrics.Handler()))
 
-	user := v1.Group("/users")
+	user := v1.Group("/users", s.rate.Group("users"))
 	user.POST("/sign-up", s.handler.SignUp)
 	user.POST("/sign-in", s.handler.SignIn)
-	user.GET("/:id", s.handler.ShowUser)
+	user.POST("/password/forgot", s.handler.ForgotPassword)
+	user.POST("/password/reset", s.handler.ResetPassword)
+	user.GET("/verify", s.handler.VerifyEmail)
+	user.POST("/verify/resend", s.handler.ResendVerification)
+	user.GET("/:id", s.handler.ShowUser, s.mid.ValidateAuth)
 
 	setting := user.Group("/settings", s.mid.ValidateAuth)
 	setting.PATCH("/profile", s.handler.UpdateUserFIO)
 	setting.PATCH("/password", s.handler.UpdateUserPassword)
 	setting.DELETE("/profile", s.handler.DeleteUser)
 
-	book := v1.Group("/books")
+	book := v1.Group("/books", s.rate.Group("books"))
 	book.POST("", s.handler.CreateBook)
 	book.GET("", s.handler.ShowAllBooks)
+	book.POST("/import", s.handler.ImportBooks, s.mid.ValidateAuth, s.mid.RequireAdmin)
+	book.GET("/import/:id", s.handler.ShowImportJob, s.mid.ValidateAuth, s.mid.RequireAdmin).Name = "show-import-job"
 	book.GET("/:id", s.handler.ShowBook)
 	book.PATCH("/:id", s.handler.UpdateBook)
 	book.DELETE("/:id", s.handler.DeleteBook)
+	book.POST("/:id/copies", s.handler.CreateBookCopy, s.mid.ValidateAuth, s.mid.RequireAdmin)
+	book.GET("/:id/copies", s.handler.ShowBookCopies, s.mid.ValidateAuth, s.mid.RequireAuth)
 
-	history := v1.Group("/rents")
+	bookCopy := v1.Group("/copies", s.rate.Group("copies"), s.mid.ValidateAuth, s.mid.RequireAuth)
+	bookCopy.GET("/:barcode", s.handler.ShowBookCopy)
+	bookCopy.PATCH("/:barcode", s.handler.UpdateBookCopyStatus, s.mid.RequireAdmin)
+
+	admin := v1.Group("/admin", s.rate.Group("admin"), s.mid.ValidateAuth, s.mid.RequireAdmin)
+	admin.POST("/books/:id/restore", s.handler.RestoreBook)
+	admin.POST("/users/:id/restore", s.handler.RestoreUser)
+
+	history := v1.Group("/rents", s.rate.Group("rents"))
 	history.POST("", s.handler.CreateBIHistory, s.mid.ValidateAuth)
 	history.GET("", s.handler.ShowCurrentBorrowedBooks)
 	history.GET("/months", s.handler.ShowBIHistoryLastMonth)
-	history.PATCH("/:id", s.handler.UpdateBIHistory)
-	history.DELETE("/:id", s.handler.DeleteBIHistory)
+	history.POST("/checkout", s.handler.Checkout, s.mid.ValidateAuth, s.mid.RequireAuth)
+	history.POST("/checkin", s.handler.Checkin, s.mid.ValidateAuth, s.mid.RequireAuth)
+	history.PATCH("/:id", s.handler.UpdateBIHistory, s.mid.ValidateAuth, s.mid.RequireAdmin)
+	history.DELETE("/:id", s.handler.DeleteBIHistory, s.mid.ValidateAuth, s.mid.RequireAdmin)
 }
@@ -8,6 +8,8 @@ import (
 	"github.com/zhayt/user-storage-service/config"
 	"github.com/zhayt/user-storage-service/internal/transport/http/handler"
 	middleware2 "github.com/zhayt/user-storage-service/internal/transport/http/middleware"
+	"go.uber.org/zap"
+	"net/http"
 	"time"
 )
 
@@ -20,28 +22,50 @@ type Server struct {
 	cfg             *config.Config
 	handler         *handler.Handler
 	mid             *middleware2.JWTAuth
+	rate            *middleware2.RateLimiter
+	ready           http.Handler
+	ipExtractor     echo.IPExtractor
+	log             *zap.Logger
 	notify          chan error
 	shutdownTimeout time.Duration
 }
 
-func NewServer(cfg *config.Config, handler *handler.Handler, mid *middleware2.JWTAuth) *Server {
+func NewServer(cfg *config.Config, logger *zap.Logger, handler *handler.Handler, mid *middleware2.JWTAuth, rate *middleware2.RateLimiter, ready http.Handler) (*Server, error) {
+	ipExtractor, err := middleware2.IPExtractor(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	srv := &Server{
 		cfg:             cfg,
 		handler:         handler,
 		shutdownTimeout: _defaultShutdownTimeout,
 		notify:          make(chan error, 1),
 		mid:             mid,
+		rate:            rate,
+		ready:           ready,
+		ipExtractor:     ipExtractor,
+		log:             logger,
 	}
 
-	return srv
+	return srv, nil
 }
 
 func (s *Server) BuildingEngine() *echo.Echo {
 	e := echo.New()
+	e.IPExtractor = s.ipExtractor
+	e.HTTPErrorHandler = s.handler.HTTPErrorHandler
+	e.Use(middleware.RequestID())
+	e.Use(middleware2.Tracing(s.cfg.ServiceName))
+	e.Use(middleware2.Metrics)
+	e.Use(middleware2.RequestLogger(s.log))
+	e.Use(middleware2.ClientIP)
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{"*"},
+		AllowOrigins:  []string{"*"},
+		AllowHeaders:  []string{"*"},
+		ExposeHeaders: []string{middleware2.HeaderRateLimitLimit, middleware2.HeaderRateLimitRemaining, middleware2.HeaderRateLimitReset, echo.HeaderRetryAfter},
 	}))
+	e.Use(s.rate.Global)
 
 	return e
 }
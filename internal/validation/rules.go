@@ -0,0 +1,219 @@
+package validation
+
+import (
+	"fmt"
+	"github.com/zhayt/user-storage-service/internal/catalog"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Rules are declared in the validate tag of model fields, separated by commas:
+//
+//	required      string is not blank, number is not zero, slice is not empty
+//	omitempty     skip the other rules when the value is zero
+//	len=min:max   number of characters of the trimmed string
+//	min=n, max=n  range of a number
+//	positive      number is greater than zero
+//	email         email address
+//	isbn          ISBN-10 or ISBN-13
+//	oneof=a b     one of the listed strings
+//	pattern=name  matches a pattern registered in Patterns
+//	dive          validate every element of a slice of structs
+//
+// Violations name the field by its json tag, nested ones like books[0].quantity.
+const _tag = "validate"
+
+// Patterns lists the named patterns the pattern rule can refer to.
+var Patterns = map[string]*regexp.Regexp{
+	"barcode": regexp.MustCompile(`^[A-Za-z0-9\-]{1,32}$`),
+}
+
+type rule struct {
+	name string
+	arg  string
+}
+
+type field struct {
+	index int
+	name  string
+	rules []rule
+}
+
+var fieldsCache sync.Map // reflect.Type -> []field
+
+// Struct checks every rule declared on the fields of v, a struct or a pointer to one.
+// It returns a validation error holding every violation, nil if v is valid.
+func Struct(v interface{}) error {
+	val := New()
+	val.Struct(v)
+
+	return val.Err()
+}
+
+// Struct adds the violations of the declared rules of s, so cross-field checks can follow with Check.
+func (v *Validator) Struct(s interface{}) {
+	v.walk("", reflect.Indirect(reflect.ValueOf(s)))
+}
+
+func (v *Validator) walk(prefix string, value reflect.Value) {
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validation: %s is not a struct", value.Type()))
+	}
+
+	for _, f := range typeFields(value.Type()) {
+		v.field(prefix+f.name, value.Field(f.index), f.rules)
+	}
+}
+
+func (v *Validator) field(name string, value reflect.Value, rules []rule) {
+	for _, r := range rules {
+		switch r.name {
+		case "omitempty":
+			if value.IsZero() {
+				return
+			}
+		case "required":
+			v.Check(!isBlank(value), name, "is required")
+		case "len":
+			min, max := parseRange(r.arg)
+			n := len([]rune(strings.TrimSpace(value.String())))
+			v.Check(n >= min && n <= max, name, fmt.Sprintf("must be %d to %d characters", min, max))
+		case "min":
+			v.Check(number(value) >= parseFloat(r.arg), name, "must be at least "+r.arg)
+		case "max":
+			v.Check(number(value) <= parseFloat(r.arg), name, "must be at most "+r.arg)
+		case "positive":
+			v.Check(number(value) > 0, name, "must be positive")
+		case "email":
+			v.Check(IsEmail(value.String()), name, "must be a valid email address")
+		case "isbn":
+			_, err := catalog.NormalizeISBN(value.String())
+			v.Check(err == nil, name, "must be a valid ISBN-10 or ISBN-13")
+		case "oneof":
+			options := strings.Fields(r.arg)
+			v.Check(contains(options, value.String()), name, "must be one of "+strings.Join(options, ", "))
+		case "pattern":
+			v.Check(Patterns[r.arg].MatchString(value.String()), name, "has invalid format")
+		case "dive":
+			for i := 0; i < value.Len(); i++ {
+				elem := reflect.Indirect(value.Index(i))
+				if !elem.IsValid() {
+					v.Check(false, fmt.Sprintf("%s[%d]", name, i), "is required")
+					continue
+				}
+				v.walk(fmt.Sprintf("%s[%d].", name, i), elem)
+			}
+		}
+	}
+}
+
+func typeFields(t reflect.Type) []field {
+	if cached, ok := fieldsCache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get(_tag)
+		if tag == "" || !sf.IsExported() {
+			continue
+		}
+
+		fields = append(fields, field{index: i, name: fieldName(sf), rules: parseRules(t, sf, tag)})
+	}
+
+	fieldsCache.Store(t, fields)
+	return fields
+}
+
+func parseRules(t reflect.Type, sf reflect.StructField, tag string) []rule {
+	var rules []rule
+	for _, part := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "omitempty", "required", "positive", "email", "isbn", "dive":
+		case "len":
+			parseRange(arg)
+		case "min", "max":
+			parseFloat(arg)
+		case "oneof":
+		case "pattern":
+			if Patterns[arg] == nil {
+				panic(fmt.Sprintf("validation: unknown pattern %q on %s.%s", arg, t, sf.Name))
+			}
+		default:
+			panic(fmt.Sprintf("validation: unknown rule %q on %s.%s", name, t, sf.Name))
+		}
+
+		rules = append(rules, rule{name: name, arg: arg})
+	}
+
+	return rules
+}
+
+func fieldName(sf reflect.StructField) string {
+	name := strings.Split(sf.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+
+	return name
+}
+
+func isBlank(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	default:
+		return value.IsZero()
+	}
+}
+
+func number(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	default:
+		panic(fmt.Sprintf("validation: %s is not a number", value.Type()))
+	}
+}
+
+func parseRange(arg string) (int, int) {
+	minArg, maxArg, ok := strings.Cut(arg, ":")
+	min, errMin := strconv.Atoi(minArg)
+	max, errMax := strconv.Atoi(maxArg)
+	if !ok || errMin != nil || errMax != nil {
+		panic(fmt.Sprintf("validation: invalid len %q", arg))
+	}
+
+	return min, max
+}
+
+func parseFloat(arg string) float64 {
+	f, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validation: invalid number %q", arg))
+	}
+
+	return f
+}
+
+func contains(options []string, value string) bool {
+	for _, option := range options {
+		if option == value {
+			return true
+		}
+	}
+
+	return false
+}
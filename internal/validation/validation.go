@@ -0,0 +1,53 @@
+// Package validation checks client input field by field and reports every
+// failed rule at once, so the client can point at each wrong field.
+package validation
+
+import (
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"net/mail"
+	"regexp"
+)
+
+var EmailRX = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
+
+// Validator collects the violations of one input, the zero value is ready to use.
+type Validator struct {
+	violations []apperror.Violation
+}
+
+func New() *Validator {
+	return &Validator{}
+}
+
+// Check adds the violation when ok is false.
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.violations = append(v.violations, apperror.Violation{Field: field, Message: message})
+	}
+}
+
+// Valid reports whether no rule has failed so far.
+func (v *Validator) Valid() bool {
+	return len(v.violations) == 0
+}
+
+// Err returns a validation error holding every violation, nil if the input is valid.
+func (v *Validator) Err() error {
+	if v.Valid() {
+		return nil
+	}
+
+	return apperror.Invalid(v.violations...)
+}
+
+func IsEmail(value string) bool {
+	if value == "" {
+		return false
+	}
+
+	if _, err := mail.ParseAddress(value); err != nil {
+		return false
+	}
+
+	return EmailRX.MatchString(value)
+}
@@ -0,0 +1,210 @@
+package validation
+
+import (
+	"github.com/zhayt/user-storage-service/internal/apperror"
+	"reflect"
+	"testing"
+)
+
+type ruleCase struct {
+	name  string
+	input interface{}
+	want  []apperror.Violation
+}
+
+func runRuleCases(t *testing.T, tests []ruleCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apperror.Violations(Struct(tt.input)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Struct() violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func violation(field, message string) []apperror.Violation {
+	return []apperror.Violation{{Field: field, Message: message}}
+}
+
+func TestRequired(t *testing.T) {
+	type input struct {
+		Name  string `json:"name" validate:"required"`
+		Count int    `json:"count" validate:"required"`
+		Items []int  `json:"items" validate:"required"`
+	}
+
+	runRuleCases(t, []ruleCase{
+		{"All set", input{Name: "a", Count: 1, Items: []int{1}}, nil},
+		{"Blank string", input{Name: "  ", Count: 1, Items: []int{1}}, violation("name", "is required")},
+		{"Zero number", input{Name: "a", Items: []int{1}}, violation("count", "is required")},
+		{"Empty slice", input{Name: "a", Count: 1, Items: []int{}}, violation("items", "is required")},
+	})
+}
+
+func TestOmitempty(t *testing.T) {
+	type input struct {
+		ISBN string `json:"isbn" validate:"omitempty,isbn"`
+	}
+
+	runRuleCases(t, []ruleCase{
+		{"Empty is skipped", input{}, nil},
+		{"Set is checked", input{ISBN: "123"}, violation("isbn", "must be a valid ISBN-10 or ISBN-13")},
+	})
+}
+
+func TestLength(t *testing.T) {
+	type input struct {
+		FIO string `json:"fio" validate:"len=3:6"`
+	}
+
+	runRuleCases(t, []ruleCase{
+		{"Too short", input{FIO: "sh"}, violation("fio", "must be 3 to 6 characters")},
+		{"Shortest", input{FIO: "abc"}, nil},
+		{"Spaces are trimmed", input{FIO: "  ab  "}, violation("fio", "must be 3 to 6 characters")},
+		{"Runes are counted", input{FIO: "Айбек"}, nil},
+		{"Longest", input{FIO: "abcdef"}, nil},
+		{"Too long", input{FIO: "abcdefg"}, violation("fio", "must be 3 to 6 characters")},
+	})
+}
+
+func TestRange(t *testing.T) {
+	type input struct {
+		Price float64 `json:"price" validate:"min=0,max=100"`
+	}
+
+	runRuleCases(t, []ruleCase{
+		{"Lowest", input{Price: 0}, nil},
+		{"Highest", input{Price: 100}, nil},
+		{"Negative", input{Price: -0.5}, violation("price", "must be at least 0")},
+		{"Too high", input{Price: 100.01}, violation("price", "must be at most 100")},
+	})
+}
+
+func TestPositive(t *testing.T) {
+	type input struct {
+		Quantity int `json:"quantity" validate:"positive"`
+	}
+
+	runRuleCases(t, []ruleCase{
+		{"Positive", input{Quantity: 1}, nil},
+		{"Zero", input{Quantity: 0}, violation("quantity", "must be positive")},
+		{"Negative", input{Quantity: -2}, violation("quantity", "must be positive")},
+	})
+}
+
+func TestEmail(t *testing.T) {
+	type input struct {
+		Email string `json:"email" validate:"email"`
+	}
+
+	invalid := violation("email", "must be a valid email address")
+	runRuleCases(t, []ruleCase{
+		{"Valid email", input{Email: "example@email.ru"}, nil},
+		{"Invalid email missing .", input{Email: "example@emailru"}, invalid},
+		{"Invalid email missing @", input{Email: "exampleemailru"}, invalid},
+		{"Invalid email has only домен", input{Email: "@mail.ru"}, invalid},
+		{"Valid email", input{Email: "example@gemail.com"}, nil},
+		{"Empty email", input{}, invalid},
+	})
+}
+
+func TestISBN(t *testing.T) {
+	type input struct {
+		ISBN string `json:"isbn" validate:"isbn"`
+	}
+
+	invalid := violation("isbn", "must be a valid ISBN-10 or ISBN-13")
+	runRuleCases(t, []ruleCase{
+		{"ISBN-13", input{ISBN: "978-0-441-01359-3"}, nil},
+		{"ISBN-10", input{ISBN: "0441013597"}, nil},
+		{"Wrong check digit", input{ISBN: "9780441013594"}, invalid},
+		{"Empty", input{}, invalid},
+	})
+}
+
+func TestOneOf(t *testing.T) {
+	type input struct {
+		Status string `json:"status" validate:"oneof=available lost"`
+	}
+
+	runRuleCases(t, []ruleCase{
+		{"Listed", input{Status: "lost"}, nil},
+		{"Not listed", input{Status: "on_loan"}, violation("status", "must be one of available, lost")},
+	})
+}
+
+func TestPattern(t *testing.T) {
+	type input struct {
+		Barcode string `json:"barcode" validate:"pattern=barcode"`
+	}
+
+	runRuleCases(t, []ruleCase{
+		{"Matches", input{Barcode: "LIB-000123"}, nil},
+		{"Has spaces", input{Barcode: "LIB 000123"}, violation("barcode", "has invalid format")},
+	})
+}
+
+func TestDive(t *testing.T) {
+	type item struct {
+		ID       int `json:"id" validate:"positive"`
+		Quantity int `json:"quantity" validate:"positive"`
+	}
+	type input struct {
+		Items []*item `json:"items" validate:"required,dive"`
+	}
+
+	runRuleCases(t, []ruleCase{
+		{"Valid items", &input{Items: []*item{{ID: 1, Quantity: 2}}}, nil},
+		{"Nested field", input{Items: []*item{{ID: 1, Quantity: 1}, {ID: 2}}},
+			violation("items[1].quantity", "must be positive")},
+		{"Nil element", input{Items: []*item{nil}}, violation("items[0]", "is required")},
+		{"No items", input{}, violation("items", "is required")},
+	})
+}
+
+func TestValidatorCollectsEveryViolation(t *testing.T) {
+	type input struct {
+		FIO      string `json:"fio" validate:"len=3:50"`
+		Email    string `json:"email" validate:"email"`
+		Password string `json:"password" validate:"len=3:50"`
+		Repeat   string `json:"passwordRepeat"`
+	}
+
+	v := New()
+	if err := v.Err(); err != nil {
+		t.Fatalf("Err() = %v, want nil", err)
+	}
+
+	in := input{FIO: "sh", Email: "invalid@mailru", Password: "secret", Repeat: "secreT"}
+	v.Struct(in)
+	v.Check(in.Password == in.Repeat, "passwordRepeat", "must match password")
+
+	err := v.Err()
+	if apperror.KindOf(err) != apperror.Validation {
+		t.Fatalf("KindOf() = %v, want %v", apperror.KindOf(err), apperror.Validation)
+	}
+
+	want := []apperror.Violation{
+		{Field: "fio", Message: "must be 3 to 50 characters"},
+		{Field: "email", Message: "must be a valid email address"},
+		{Field: "passwordRepeat", Message: "must match password"},
+	}
+	if got := apperror.Violations(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("Violations() = %v, want %v", got, want)
+	}
+}
+
+func TestUnknownRulePanics(t *testing.T) {
+	type input struct {
+		Name string `validate:"uuid"`
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Struct() with unknown rule did not panic")
+		}
+	}()
+
+	_ = Struct(input{})
+}
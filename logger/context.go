@@ -0,0 +1,26 @@
+package logger
+
+import (
+	"context"
+	"go.uber.org/zap"
+)
+
+type contextKey struct{}
+
+// WithContext stores the request scoped logger, the layers below pick it up with FromContext.
+func WithContext(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx, or fallback if there is none or ctx is nil.
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if ctx == nil {
+		return fallback
+	}
+
+	if l, ok := ctx.Value(contextKey{}).(*zap.Logger); ok {
+		return l
+	}
+
+	return fallback
+}